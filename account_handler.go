@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/NickP005/go_mcminterface"
 )
@@ -12,6 +13,8 @@ import (
 type AccountBalanceRequest struct {
 	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
 	AccountIdentifier AccountIdentifier `json:"account_identifier"`
+	BlockIdentifier   *BlockIdentifier  `json:"block_identifier,omitempty"` // A past height is read from the ledger archive
+	LedgerSnapshot    bool              `json:"ledger_snapshot,omitempty"`  // Read the balance from the cached ledger.dat
 }
 
 type AccountBalanceResponse struct {
@@ -20,7 +23,7 @@ type AccountBalanceResponse struct {
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
 }
 
-func accountBalanceHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) accountBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	var req AccountBalanceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		mlog(4, "§baccountBalanceHandler(): §4Error decoding request: §c%s", err)
@@ -29,38 +32,55 @@ func accountBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the account identifier is a tag or a WOTS address
-	var balance uint64
-	var err error
-	if len(req.AccountIdentifier.Address) == go_mcminterface.TXTAGLEN*2+2 {
-		// Resolve the tag to a WOTS address
-		tag, err := hex.DecodeString(req.AccountIdentifier.Address[2:])
-		if err != nil {
-			giveError(w, ErrInvalidAccountFormat)
-			return
+	if len(req.AccountIdentifier.Address) != go_mcminterface.TXTAGLEN*2+2 &&
+		len(req.AccountIdentifier.Address) != go_mcminterface.TXADDRLEN*2+2 {
+		mlog(4, "§baccountBalanceHandler(): §4Invalid account format")
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+	address, err := hex.DecodeString(req.AccountIdentifier.Address[2:])
+	if err != nil {
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+
+	// Past balances come from the archived ledger snapshots
+	if req.BlockIdentifier != nil && req.BlockIdentifier.Index > 0 && isPastLedgerHeight(uint64(req.BlockIdentifier.Index)) {
+		giveArchivedBalance(w, uint64(req.BlockIdentifier.Index), address)
+		return
+	}
+
+	// Offline deployments only have the ledger
+	if req.LedgerSnapshot || !Globals.OnlineMode {
+		if !giveLedgerBalance(w, address) {
+			giveError(w, ErrAccountNotFound)
 		}
+		return
+	}
 
-		mlog(5, "§baccountBalanceHandler(): §7Resolving tag %s", hex.EncodeToString(tag))
-		wotsAddr, err := go_mcminterface.QueryTagResolve(tag)
+	var balance uint64
+	if len(address) == go_mcminterface.TXTAGLEN {
+		// Resolve the tag to a WOTS address
+		mlog(5, "§baccountBalanceHandler(): §7Resolving tag %s", hex.EncodeToString(address))
+		wotsAddr, err := s.node.QueryTagResolve(address)
 		if err != nil {
-			giveError(w, ErrAccountNotFound)
+			mlog(4, "§baccountBalanceHandler(): §4Error resolving tag: §c%s", err)
+			giveNodeBalanceError(w, err, address)
 			return
 		}
 		balance = wotsAddr.GetAmount()
-	} else if len(req.AccountIdentifier.Address) == go_mcminterface.TXADDRLEN*2+2 {
+	} else {
 		// Directly query the balance for the WOTS address
 		//wots addr is req.AccountIdentifier.Address without the 0x as string
 		wotsAddr := req.AccountIdentifier.Address[2:]
 
 		mlog(5, "§baccountBalanceHandler(): §7Querying balance for WOTS address %s", wotsAddr)
-		balance, err = go_mcminterface.QueryBalance(wotsAddr)
+		balance, err = s.node.QueryBalance(wotsAddr)
 		if err != nil {
-			giveError(w, ErrAccountNotFound)
+			mlog(4, "§baccountBalanceHandler(): §4Error querying balance: §c%s", err)
+			giveNodeBalanceError(w, err, address)
 			return
 		}
-	} else {
-		mlog(4, "§baccountBalanceHandler(): §4Invalid account format")
-		giveError(w, ErrInvalidAccountFormat)
-		return
 	}
 
 	// Construct the response
@@ -81,3 +101,95 @@ func accountBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// giveNodeBalanceError answers a balance query the node failed. Only a node
+// that could not be reached is replaced by the ledger snapshot: its answers,
+// such as an unknown account, and quorum disagreements are returned as is.
+func giveNodeBalanceError(w http.ResponseWriter, err error, address []byte) {
+	if isNodeUnreachable(err) {
+		if giveLedgerBalance(w, address) {
+			return
+		}
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+	giveError(w, quorumError(err, ErrAccountNotFound))
+}
+
+// giveLedgerBalance answers with the balance of address in the cached
+// ledger, at the block the ledger was read. It returns false without
+// writing anything if no ledger is cached or the address is not in it.
+func giveLedgerBalance(w http.ResponseWriter, address []byte) bool {
+	entry, ok, available := LookupLedgerBalance(address)
+	if !available {
+		mlog(4, "§bgiveLedgerBalance(): §4Ledger cache not available")
+		return false
+	}
+	if !ok {
+		mlog(5, "§bgiveLedgerBalance(): §7Address §60x%s§7 not in the ledger", hex.EncodeToString(address))
+		return false
+	}
+
+	cache := GlobalLedgerCache.Load()
+	writeLedgerBalance(w, entry, "ledger", cache.LastBlockNumber, "0x"+hex.EncodeToString(cache.LastBlockHash[:]), cache.LastUpdated)
+	return true
+}
+
+// isPastLedgerHeight tells whether height is below the current ledger
+func isPastLedgerHeight(height uint64) bool {
+	tip := Globals.LatestBlockNum
+	if !Globals.OnlineMode {
+		tip = 0
+		if cache := GlobalLedgerCache.Load(); cache != nil {
+			tip = cache.LastBlockNumber
+		}
+	}
+	return height < tip
+}
+
+// giveArchivedBalance answers with the balance of address in the latest
+// archived ledger at or below height
+func giveArchivedBalance(w http.ResponseWriter, height uint64, address []byte) {
+	if LEDGER_ARCHIVE == nil {
+		mlog(4, "§bgiveArchivedBalance(): §4Ledger archive is disabled")
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+	info, entry, ok, err := LEDGER_ARCHIVE.Balance(height, address)
+	if err != nil {
+		mlog(4, "§bgiveArchivedBalance(): §4No ledger snapshot for block §e%d§4: §c%s", height, err)
+		giveError(w, ErrBlockNotFound)
+		return
+	}
+	if !ok {
+		mlog(5, "§bgiveArchivedBalance(): §7Address §60x%s§7 not in the ledger of block §e%d", hex.EncodeToString(address), info.Block)
+		giveError(w, ErrAccountNotFound)
+		return
+	}
+	writeLedgerBalance(w, entry, "ledger_archive", info.Block, info.Hash, info.Time)
+}
+
+// writeLedgerBalance writes a balance read from a ledger at blockNum
+func writeLedgerBalance(w http.ResponseWriter, entry go_mcminterface.LedgerEntry, source string, blockNum uint64, blockHash string, updated time.Time) {
+	response := AccountBalanceResponse{
+		BlockIdentifier: BlockIdentifier{
+			Index: int(blockNum),
+			Hash:  blockHash,
+		},
+		Balances: []Amount{
+			{
+				Value:    fmt.Sprintf("%d", entry.Balance),
+				Currency: MCMCurrency,
+			},
+		},
+		Metadata: map[string]interface{}{
+			"source":         source,
+			"snapshot_block": blockNum,
+			"last_updated":   updated.Format(time.RFC3339),
+			"address":        "0x" + hex.EncodeToString(entry.Address[:]),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// ledgerEntry returns an entry whose address is tag, hash
+func ledgerEntry(tag byte, hash byte, balance uint64) go_mcminterface.LedgerEntry {
+	entry := go_mcminterface.LedgerEntry{Balance: balance}
+	copy(entry.Address[:], strings.Repeat(string([]byte{tag}), go_mcminterface.TXTAGLEN)+
+		strings.Repeat(string([]byte{hash}), go_mcminterface.TXADDRLEN-go_mcminterface.TXTAGLEN))
+	return entry
+}
+
+// encodeLedger encodes entries as ledger.dat records
+func encodeLedger(entries []go_mcminterface.LedgerEntry) []byte {
+	data := make([]byte, 0, len(entries)*ledgerRecordSize)
+	for _, entry := range entries {
+		data = append(data, entry.Address[:]...)
+		data = binary.LittleEndian.AppendUint64(data, entry.Balance)
+	}
+	return data
+}
+
+// writeLedger writes entries as a ledger.dat file written at time written
+func writeLedger(t *testing.T, entries []go_mcminterface.LedgerEntry, written time.Time) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ledger.dat")
+	if err := os.WriteFile(path, encodeLedger(entries), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, written, written); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// withLedger loads entries as the ledger cache, written when block bnum of
+// node was solved
+func withLedger(t *testing.T, node *FakeNode, bnum int, entries []go_mcminterface.LedgerEntry) {
+	t.Helper()
+	stime := binary.LittleEndian.Uint32(node.blocks[bnum].Trailer.Stime[:])
+	ledgerPath, snapshotDir := Globals.LedgerPath, LEDGER_SNAPSHOT_DIR
+	Globals.LedgerPath = writeLedger(t, entries, time.Unix(int64(stime), 0))
+	LEDGER_SNAPSHOT_DIR = t.TempDir()
+	t.Cleanup(func() {
+		Globals.LedgerPath, LEDGER_SNAPSHOT_DIR = ledgerPath, snapshotDir
+		publishLedgerCache(nil)
+		publishLedgerCache(nil)
+	})
+	if err := RefreshLedgerCache(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// brokenNode fails tag and balance queries with err
+type brokenNode struct {
+	*FakeNode
+	err error
+}
+
+func (n brokenNode) QueryTagResolve(tag []byte) (go_mcminterface.WotsAddress, error) {
+	return go_mcminterface.WotsAddress{}, n.err
+}
+
+func (n brokenNode) QueryBalance(wotsAddr string) (uint64, error) {
+	return 0, n.err
+}
+
+func TestLedgerSnapshotBlock(t *testing.T) {
+	node, _, _ := newTestServer(t, 10)
+	stime := func(bnum int) time.Time {
+		return time.Unix(int64(binary.LittleEndian.Uint32(node.blocks[bnum].Trailer.Stime[:])), 0)
+	}
+
+	// A ledger written between two blocks holds the balances of the first
+	bnum, bhash, err := ledgerSnapshotBlock(stime(4).Add(time.Second), TFILE_PATH)
+	if err != nil || bnum != 4 || bhash != node.blocks[4].Trailer.Bhash {
+		t.Fatalf("ledger written after block 4: block %d, %v", bnum, err)
+	}
+	if bnum, _, _ := ledgerSnapshotBlock(stime(10).Add(time.Hour), TFILE_PATH); bnum != 10 {
+		t.Fatalf("ledger written after the tip: block %d", bnum)
+	}
+	if _, _, err := ledgerSnapshotBlock(stime(0).Add(-time.Second), TFILE_PATH); err == nil {
+		t.Fatal("ledger older than the tfile matched a block")
+	}
+}
+
+func TestRefreshLedgerCacheBlock(t *testing.T) {
+	node, _, _ := newTestServer(t, 10)
+	Globals.LatestBlockNum = 10
+	withLedger(t, node, 7, []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, 100)})
+	cache := GlobalLedgerCache.Load()
+	if cache.LastBlockNumber != 7 || cache.LastBlockHash != node.blocks[7].Trailer.Bhash {
+		t.Fatalf("ledger of block %d, want the block it was written after, 7", cache.LastBlockNumber)
+	}
+}
+
+func TestAccountBalanceFallback(t *testing.T) {
+	node, _, _ := newTestServer(t, 10)
+	known := node.Tags()[1]
+	unknown := ledgerEntry(0xee, 1, 4242)
+	withLedger(t, node, 9, []go_mcminterface.LedgerEntry{unknown})
+
+	balance := func(node NodeClient, tag []byte) (AccountBalanceResponse, int) {
+		var response AccountBalanceResponse
+		code := post(t, NewServer(node).Router(), "/account/balance", map[string]interface{}{
+			"account_identifier": map[string]string{"address": "0x" + hex.EncodeToString(tag)},
+		}, &response)
+		return response, code
+	}
+	unknownTag := unknown.Address[:go_mcminterface.TXTAGLEN]
+
+	// The node answers
+	want, _ := node.QueryTagResolve(known)
+	if response, code := balance(node, known); code != 0 || response.Balances[0].Value != fmt.Sprint(want.GetAmount()) || response.Metadata != nil {
+		t.Fatalf("balance from the node: error %d, %+v", code, response)
+	}
+	if _, code := balance(node, unknownTag); code != ErrAccountNotFound.Code {
+		t.Fatalf("tag unknown to the node: error %d, want %d and not the ledger balance", code, ErrAccountNotFound.Code)
+	}
+
+	// Only an unreachable node is replaced by the ledger
+	down := brokenNode{node, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	response, code := balance(down, unknownTag)
+	if code != 0 || response.Balances[0].Value != "4242" || response.Metadata["source"] != "ledger" || response.BlockIdentifier.Index != 9 {
+		t.Fatalf("balance with the node down: error %d, %+v", code, response)
+	}
+	if _, code := balance(down, known); code != ErrServiceUnavailable.Code {
+		t.Fatalf("tag missing from the ledger with the node down: error %d, want %d", code, ErrServiceUnavailable.Code)
+	}
+
+	disagreement := brokenNode{node, fmt.Errorf("%w on tag", errQuorumNotReached)}
+	if _, code := balance(disagreement, unknownTag); code != ErrQuorumNotReached.Code {
+		t.Fatalf("quorum disagreement: error %d, want %d", code, ErrQuorumNotReached.Code)
+	}
+	noQuorum := brokenNode{node, fmt.Errorf("%w on tag: %w", errQuorumNotReached, errNodeUnreachable)}
+	if _, code := balance(noQuorum, unknownTag); code != 0 {
+		t.Fatalf("every quorum node down: error %d, want the ledger balance", code)
+	}
+	if !isNodeUnreachable(errors.Join(errors.New("read"), syscall.ECONNRESET)) || isNodeUnreachable(errors.New("tag not found")) {
+		t.Fatal("isNodeUnreachable misclassifies errors")
+	}
+}
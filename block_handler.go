@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+
+	"mochimo-mesh/blocktype"
 
 	"github.com/NickP005/go_mcminterface"
 )
@@ -20,14 +23,14 @@ type BlockResponse struct {
 	Error string `json:"error,omitempty"`
 }
 
-func blockHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) blockHandler(w http.ResponseWriter, r *http.Request) {
 	req, err := checkIdentifier(r)
 	if err != nil {
 		mlog(3, "§bblockHandler(): §4Error checking identifiers: §c%s", err)
 		giveError(w, ErrWrongNetwork)
 		return
 	}
-	block, err := getBlock(req.BlockIdentifier)
+	block, err := s.getBlock(req.BlockIdentifier)
 	if err != nil {
 		mlog(3, "§bblockHandler(): §4Error fetching block: §c%s", err)
 		giveError(w, ErrBlockNotFound)
@@ -54,32 +57,34 @@ func blockHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func getBlock(blockIdentifier BlockIdentifier) (Block, error) {
-	var blockData go_mcminterface.Block
-	var err error
+func (s *Server) getBlock(blockIdentifier BlockIdentifier) (Block, error) {
+	blockData, err := s.getMochimoBlock(blockIdentifier)
+	if err != nil {
+		return Block{}, err
+	}
+	return blockFromMochimo(blockData), nil
+}
 
+// getMochimoBlock finds the block of a block identifier: by index, else by
+// hash, and the current block when neither is set (index 0 without a hash)
+func (s *Server) getMochimoBlock(blockIdentifier BlockIdentifier) (go_mcminterface.Block, error) {
 	// Query block by number or hash
 	if blockIdentifier.Index != 0 { /* Fetch block by number */
-		mlog(5, "§bgetBlock(): §7Fetching block §9%d", blockIdentifier.Index)
-		blockData, err = go_mcminterface.QueryBlockFromNumber(uint64(blockIdentifier.Index))
-		if err != nil {
-			return Block{}, err
-		}
+		mlog(5, "§bgetMochimoBlock(): §7Fetching block §9%d", blockIdentifier.Index)
+		return s.getBlockByNumber(uint64(blockIdentifier.Index))
 	} else if blockIdentifier.Hash != "" && len(blockIdentifier.Hash) <= 32*2+2 { /* Fetch block by hash */
 		// first of all check if it's archived in our data folder
-		mlog(5, "§bgetBlock(): §7Fetching block with hash §9%s", blockIdentifier.Hash)
-		blockData, err = getBlockByHexHash(blockIdentifier.Hash)
-		if err != nil {
-			return Block{}, err
-		}
-	} else { /* Fetch the current block */
-		mlog(5, "§bgetBlock(): §7Fetching current block")
-		blockData, err = go_mcminterface.QueryBlockFromNumber(0)
-		if err != nil {
-			return Block{}, err
-		}
+		mlog(5, "§bgetMochimoBlock(): §7Fetching block with hash §9%s", blockIdentifier.Hash)
+		return s.getBlockByHexHash(blockIdentifier.Hash)
 	}
+	/* Fetch the current block */
+	mlog(5, "§bgetMochimoBlock(): §7Fetching current block")
+	return s.fetchLatestVerifiedBlock()
+}
 
+// blockFromMochimo converts a Mochimo block to a Rosetta block
+func blockFromMochimo(blockData go_mcminterface.Block) Block {
+	kind := blocktype.Classify(blockData)
 	metadata := map[string]interface{}{
 		"block_size": len(blockData.GetBytes()),
 		"difficulty": binary.LittleEndian.Uint32(blockData.Trailer.Difficulty[:]),
@@ -88,7 +93,12 @@ func getBlock(blockIdentifier BlockIdentifier) (Block, error) {
 		"fee":        binary.LittleEndian.Uint64(blockData.Trailer.Mfee[:]),
 		"tx_count":   binary.LittleEndian.Uint32(blockData.Trailer.Tcount[:]),
 		"stime":      int64(binary.LittleEndian.Uint32(blockData.Trailer.Stime[:])) * 1000, // Convert to milliseconds
-		"haiku":      blockData.Trailer.GetHaiku(), // TRIGG haiku from proof-of-work
+		"haiku":      blockData.Trailer.GetHaiku(),                                         // TRIGG haiku from proof-of-work
+		"block_type": kind.String(),
+	}
+	// Neogenesis blocks carry the ledger instead of transactions
+	if kind == blocktype.Neogenesis {
+		metadata["ledger"] = neogenesisLedgerSummary(blockData)
 	}
 
 	// Construct the Block struct
@@ -108,31 +118,106 @@ func getBlock(blockIdentifier BlockIdentifier) (Block, error) {
 
 	// Populate transactions
 	block.Transactions = getTransactionsFromBlock(blockData)
-	return block, nil
+	addRelatedTransactions(block.Transactions)
+	return block
+}
+
+// neogenesisLedgerSummary counts the ledger of a neogenesis block, read from
+// the node archive when available since it holds the complete block file
+func neogenesisLedgerSummary(blockData go_mcminterface.Block) blocktype.LedgerSummary {
+	block_bytes := blockData.GetBytes()
+	if NODE_ARCHIVE != nil {
+		if raw, err := NODE_ARCHIVE.ReadRaw(binary.LittleEndian.Uint64(blockData.Trailer.Bnum[:])); err == nil {
+			block_bytes = raw
+		}
+	}
+	return blocktype.SummarizeLedger(block_bytes, BTRAILER_SIZE)
+}
+
+// getBlockByNumber serves a block from the store when the stored block at that
+// height is the one in the tfile (or the only one stored when the tfile
+// lacks that height), otherwise it asks the node and stores it
+func (s *Server) getBlockByNumber(bnum uint64) (go_mcminterface.Block, error) {
+	if NODE_ARCHIVE != nil {
+		blockData, err := NODE_ARCHIVE.GetByNumber(bnum)
+		if err == nil {
+			mlog(5, "§bgetBlockByNumber(): §7Block §9%d§7 served from the node archive", bnum)
+			return blockData, nil
+		}
+		mlog(5, "§bgetBlockByNumber(): §7Block §9%d§7 not in the node archive: §c%s", bnum, err)
+	}
+
+	if BLOCK_STORE != nil {
+		if hexHash, ok := storedBlockAt(bnum); ok {
+			if blockData, err := BLOCK_STORE.Get(hexHash); err == nil {
+				mlog(5, "§bgetBlockByNumber(): §7Block §9%d§7 served from the block store", bnum)
+				return blockData, nil
+			}
+		}
+	}
+
+	blockData, err := s.fetchVerifiedBlock(bnum)
+	if err != nil {
+		return go_mcminterface.Block{}, err
+	}
+	if BLOCK_STORE != nil {
+		if err := BLOCK_STORE.Put(blockData); err != nil {
+			mlog(3, "§bgetBlockByNumber(): §4Error storing block §9%d§4: §c%s", bnum, err)
+		}
+	}
+	return blockData, nil
 }
 
-// GetBlockByHexHash exports the getBlockByHexHash function to be used by other packages
-func GetBlockByHexHash(hexHash string) (go_mcminterface.Block, error) {
-	return getBlockByHexHash(hexHash)
+// storedBlockAt picks the stored block at a height
+func storedBlockAt(bnum uint64) (string, bool) {
+	hashes := BLOCK_STORE.HashesAt(bnum)
+	if len(hashes) == 0 {
+		return "", false
+	}
+	trailer, err := readTfileTrailer(bnum, TFILE_PATH)
+	if err != nil {
+		// Without the tfile a fork at this height cannot be told apart
+		return hashes[0], len(hashes) == 1
+	}
+	canonical := "0x" + hex.EncodeToString(trailer.Bhash[:])
+	for _, hexHash := range hashes {
+		if hexHash == canonical {
+			return hexHash, true
+		}
+	}
+	return "", false
 }
 
-func getBlockByHexHash(hexHash string) (go_mcminterface.Block, error) {
-	blockData, err := getBlockInDataFolder(hexHash)
+func (s *Server) getBlockByHexHash(hexHash string) (go_mcminterface.Block, error) {
+	// Block maps and file names use lowercase 0x prefixed hashes
+	hexHash = strings.ToLower(hexHash)
+	if !strings.HasPrefix(hexHash, "0x") {
+		hexHash = "0x" + hexHash
+	}
+	if NODE_ARCHIVE != nil {
+		blockData, err := NODE_ARCHIVE.GetByHash(hexHash)
+		if err == nil {
+			mlog(5, "§bgetBlockByHexHash(): §7Block §6%s§7 served from the node archive", hexHash)
+			return blockData, nil
+		}
+		mlog(5, "§bgetBlockByHexHash(): §7Block §6%s§7 not in the node archive: §c%s", hexHash, err)
+	}
+
+	var blockData go_mcminterface.Block
+	err := fmt.Errorf("block store disabled")
+	if BLOCK_STORE != nil {
+		blockData, err = BLOCK_STORE.Get(hexHash)
+	}
 	if err != nil {
-		mlog(5, "§bgetBlockByHexHash(): §7Block not found in data folder, fetching from the network. Error: §c%s", err)
-		// check in the Globals.HashToBlockNumber map the block number
-		blockNumber, ok := Globals.HashToBlockNumber[hexHash]
+		mlog(5, "§bgetBlockByHexHash(): §7Block not found in block store, fetching from the network. Error: §c%s", err)
+		// check in the block map the block number
+		blockNumber, ok := blockNumberOfHash(hexHash)
 		if !ok {
 			mlog(5, "§bgetBlockByHexHash(): §7Block §6%s§7 not found in the block map", hexHash)
-			// print the map hash as hex : int
-			/*
-				for k, v := range Globals.HashToBlockNumber {
-					fmt.Println("Hash: ", k, "Block Number: ", v)
-				}*/
 			return go_mcminterface.Block{}, err
 		}
 		mlog(5, "§bgetBlockByHexHash(): §fBlock found in the block map: §6%d", blockNumber)
-		blockData, err = go_mcminterface.QueryBlockFromNumber(uint64(blockNumber))
+		blockData, err = s.fetchVerifiedBlock(uint64(blockNumber))
 		if err != nil {
 			return go_mcminterface.Block{}, err
 		}
@@ -140,8 +225,12 @@ func getBlockByHexHash(hexHash string) (go_mcminterface.Block, error) {
 		if bdata_hexhash != hexHash {
 			return go_mcminterface.Block{}, fmt.Errorf("block hash mismatch")
 		}
-		// backup the block in the data folder
-		saveBlockInDataFolder(blockData)
+		// archive the block in the block store
+		if BLOCK_STORE != nil {
+			if err := BLOCK_STORE.Put(blockData); err != nil {
+				mlog(3, "§bgetBlockByHexHash(): §4Error storing block: §c%s", err)
+			}
+		}
 	}
 	return blockData, nil
 }
@@ -181,10 +270,14 @@ func getTransactionsFromBlock(block go_mcminterface.Block) []Transaction {
 
 // Operations contains the changes to the state (such as deltas), not the final balances.
 // Each TX has the following operations:
-// 1. Source Transfer: -amount
-// 2. Destination Transfer(s): +amount
-// 3. Fee: +fee
-
+//  0. Source Transfer: the source WOTS address is always emptied, so the
+//     operation spends the whole source balance (-(sent+change+fee))
+//  1. Destination Transfer(s): +amount
+//  2. Change: +change credited to the change address
+//  3. Fee: +fee
+//
+// Every operation after the source transfer relates to it. Pending
+// transactions have the same operations, with the PENDING status.
 func getTransactionsFromBlockBody(txentries []go_mcminterface.TXENTRY, maddr go_mcminterface.WotsAddress, is_success bool) []Transaction {
 	var transactions []Transaction
 	var status string = "SUCCESS"
@@ -192,24 +285,51 @@ func getTransactionsFromBlockBody(txentries []go_mcminterface.TXENTRY, maddr go_
 		status = "PENDING"
 	}
 	for _, tx := range txentries {
-		operations := []Operation{}
-		// Sent amount
 		txFee := tx.GetFee()
-		total_sent_amount := txFee
+		changeTotal := tx.GetChangeTotal()
+		sourceTotal := tx.GetSendTotal() + changeTotal + txFee
+
+		source_address := tx.GetSourceAddress().Address
+		source_addrhash := hex.EncodeToString(source_address[20:])
+		change_address := tx.GetChangeAddress().Address
+		change_addrhash := hex.EncodeToString(change_address[20:])
+
+		source := []OperationIdentifier{{Index: 0}}
+
+		// Remove from source
+		operations := []Operation{{
+			OperationIdentifier: OperationIdentifier{
+				Index: 0,
+			},
+			Type:    "SOURCE_TRANSFER",
+			Status:  status,
+			Account: getAccountFromAddress((tx.GetSourceAddress())),
+			Amount: Amount{
+				Value:    fmt.Sprintf("-%d", sourceTotal),
+				Currency: MCMCurrency,
+			},
+			Metadata: map[string]interface{}{
+				"from_address_hash":   "0x" + source_addrhash,
+				"change_address_hash": "0x" + change_addrhash,
+				"source_amount":       fmt.Sprintf("%d", sourceTotal),
+				"change_amount":       fmt.Sprintf("%d", changeTotal),
+			},
+		}}
+
 		// Add every operation in TXENTRY
-		for i, op := range tx.GetDestinations() {
+		for _, op := range tx.GetDestinations() {
 			var sent_amount uint64 = binary.LittleEndian.Uint64(op.Amount[:])
-			total_sent_amount += sent_amount
 			var address go_mcminterface.WotsAddress
 			address.SetTAG(op.Tag[:])
 
 			operations = append(operations, Operation{
 				OperationIdentifier: OperationIdentifier{
-					Index: i,
+					Index: len(operations),
 				},
-				Type:    "DESTINATION_TRANSFER",
-				Status:  status,
-				Account: getAccountFromAddress(address),
+				RelatedOperations: source,
+				Type:              "DESTINATION_TRANSFER",
+				Status:            status,
+				Account:           getAccountFromAddress(address),
 				Amount: Amount{
 					Value:    fmt.Sprintf("%d", sent_amount),
 					Currency: MCMCurrency,
@@ -220,27 +340,21 @@ func getTransactionsFromBlockBody(txentries []go_mcminterface.TXENTRY, maddr go_
 			})
 		}
 
-		source_address := tx.GetSourceAddress().Address
-		source_addrhash := hex.EncodeToString(source_address[20:])
-		change_address := tx.GetChangeAddress().Address
-		change_addrhash := hex.EncodeToString(change_address[20:])
-		// Remove from source
+		// Credit the change to the change address
 		operations = append(operations, Operation{
 			OperationIdentifier: OperationIdentifier{
 				Index: len(operations),
 			},
-			Type:    "SOURCE_TRANSFER",
-			Status:  status,
-			Account: getAccountFromAddress((tx.GetSourceAddress())),
+			RelatedOperations: source,
+			Type:              "CHANGE",
+			Status:            status,
+			Account:           getAccountFromAddress(tx.GetChangeAddress()),
 			Amount: Amount{
-				Value:    fmt.Sprintf("-%d", total_sent_amount),
+				Value:    fmt.Sprintf("%d", changeTotal),
 				Currency: MCMCurrency,
 			},
 			Metadata: map[string]interface{}{
-				"from_address_hash":   "0x" + source_addrhash,
 				"change_address_hash": "0x" + change_addrhash,
-				"source_amount":       fmt.Sprintf("%d", tx.GetChangeTotal()+tx.GetSendTotal()+txFee),
-				"change_amount":       fmt.Sprintf("%d", tx.GetChangeTotal()),
 			},
 		})
 
@@ -249,9 +363,10 @@ func getTransactionsFromBlockBody(txentries []go_mcminterface.TXENTRY, maddr go_
 			OperationIdentifier: OperationIdentifier{
 				Index: len(operations),
 			},
-			Type:    "FEE",
-			Status:  status,
-			Account: getAccountFromAddress(maddr),
+			RelatedOperations: source,
+			Type:              "FEE",
+			Status:            status,
+			Account:           getAccountFromAddress(maddr),
 			Amount: Amount{
 				Value:    fmt.Sprintf("%d", txFee),
 				Currency: MCMCurrency,
@@ -282,7 +397,7 @@ type BlockTransactionResponse struct {
 	Transaction Transaction `json:"transaction"`
 }
 
-func blockTransactionHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) blockTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	var req BlockTransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		mlog(3, "§bblockTransactionHandler(): §4Error decoding request: §c%s", err)
@@ -298,7 +413,7 @@ func blockTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch the block using the block identifier from the request
-	block, err := getBlock(req.BlockIdentifier)
+	block, err := s.getBlock(req.BlockIdentifier)
 	if err != nil {
 		mlog(3, "§bblockTransactionHandler(): §4Error fetching block: §c%s", err)
 		giveError(w, ErrBlockNotFound)
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// checkOperations checks the operation model of a Mochimo transaction: a
+// source spending the whole balance, the destinations, the change and the
+// fee, all related to the source and summing to zero
+func checkOperations(t *testing.T, tx go_mcminterface.TXENTRY, operations []Operation, status string) {
+	t.Helper()
+	destinations := len(tx.GetDestinations())
+	types := []string{"SOURCE_TRANSFER"}
+	for i := 0; i < destinations; i++ {
+		types = append(types, "DESTINATION_TRANSFER")
+	}
+	types = append(types, "CHANGE", "FEE")
+	if len(operations) != len(types) {
+		t.Fatalf("%d operations, want %v", len(operations), types)
+	}
+
+	var sum int64
+	for i, op := range operations {
+		if op.Type != types[i] || op.Status != status || op.OperationIdentifier.Index != i {
+			t.Fatalf("operation %d is %s %s with index %d, want %s %s", i, op.Type, op.Status, op.OperationIdentifier.Index, types[i], status)
+		}
+		if i > 0 && (len(op.RelatedOperations) != 1 || op.RelatedOperations[0].Index != 0) {
+			t.Fatalf("operation %d (%s) is not related to the source: %+v", i, op.Type, op.RelatedOperations)
+		}
+		value, err := strconv.ParseInt(op.Amount.Value, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += value
+	}
+	if sum != 0 {
+		t.Fatalf("operations sum to %d", sum)
+	}
+	if want := "-" + strconv.FormatUint(tx.GetSendTotal()+tx.GetChangeTotal()+tx.GetFee(), 10); operations[0].Amount.Value != want {
+		t.Fatalf("source spends %s, want the whole balance %s", operations[0].Amount.Value, want)
+	}
+	if operations[destinations+1].Amount.Value != strconv.FormatUint(tx.GetChangeTotal(), 10) {
+		t.Fatalf("change of %s, want %d", operations[destinations+1].Amount.Value, tx.GetChangeTotal())
+	}
+}
+
+func TestBlockOperations(t *testing.T) {
+	node, _, handler := newTestServer(t, 20)
+	block, _ := node.QueryBlockFromNumber(6)
+
+	var response BlockResponse
+	if code := post(t, handler, "/block", map[string]interface{}{"block_identifier": map[string]interface{}{"index": 6}}, &response); code != 0 {
+		t.Fatalf("/block: error %d", code)
+	}
+	// After the reward
+	for i, tx := range block.Body {
+		checkOperations(t, tx, response.Block.Transactions[i+1].Operations, "SUCCESS")
+	}
+}
+
+func TestMempoolOperations(t *testing.T) {
+	node, server, handler := newTestServer(t, 5)
+	tx, err := node.Faucet(node.Tags()[1], 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.GetChangeTotal() == 0 {
+		t.Fatal("faucet transaction without change")
+	}
+	server.mempool.Refresh()
+
+	var response MempoolTransactionResponse
+	code := post(t, handler, "/mempool/transaction", map[string]interface{}{"transaction_identifier": map[string]interface{}{"hash": "0x" + hex.EncodeToString(tx.GetID())}}, &response)
+	if code != 0 {
+		t.Fatalf("/mempool/transaction: error %d", code)
+	}
+	checkOperations(t, tx, response.Transaction.Operations, "PENDING")
+}
+
+func TestConstructionParseOperations(t *testing.T) {
+	node, _, handler := newTestServer(t, 5)
+	tx, err := node.Faucet(node.Tags()[1], 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response ConstructionParseResponse
+	code := post(t, handler, "/construction/parse", map[string]interface{}{"signed": true, "transaction": hex.EncodeToString(tx.Bytes())}, &response)
+	if code != 0 {
+		t.Fatalf("/construction/parse: error %d", code)
+	}
+	checkOperations(t, tx, response.Operations, "PENDING")
+	if len(response.AccountIdentifierSigners) != 1 || response.AccountIdentifierSigners[0].Address != response.Operations[0].Account.Address {
+		t.Fatalf("signers %+v", response.AccountIdentifierSigners)
+	}
+}
+
+func TestConstructionPayloadsChange(t *testing.T) {
+	_, _, handler := newTestServer(t, 5)
+	source := "0x" + strings.Repeat("11", go_mcminterface.TXTAGLEN)
+	destination := "0x" + strings.Repeat("22", go_mcminterface.TXTAGLEN)
+
+	payloads := func(balance string, change string) int {
+		operations := []map[string]interface{}{
+			{"operation_identifier": map[string]int{"index": 0}, "type": "SOURCE_TRANSFER", "account": map[string]string{"address": source}, "amount": map[string]interface{}{"value": "-" + balance, "currency": MCMCurrency}},
+			{"operation_identifier": map[string]int{"index": 1}, "type": "DESTINATION_TRANSFER", "account": map[string]string{"address": destination}, "amount": map[string]interface{}{"value": "1000", "currency": MCMCurrency}, "metadata": map[string]string{"memo": ""}},
+			{"operation_identifier": map[string]int{"index": 2}, "type": "FEE", "account": map[string]string{"address": source}, "amount": map[string]interface{}{"value": "500", "currency": MCMCurrency}},
+		}
+		if change != "" {
+			operations = append(operations, map[string]interface{}{"operation_identifier": map[string]int{"index": 3}, "type": "CHANGE", "account": map[string]string{"address": source}, "amount": map[string]interface{}{"value": change, "currency": MCMCurrency}})
+		}
+		return post(t, handler, "/construction/payloads", map[string]interface{}{
+			"operations": operations,
+			"metadata": map[string]interface{}{
+				"source_balance": balance,
+				"change_pk":      "0x" + strings.Repeat("33", go_mcminterface.TXADDRLEN-go_mcminterface.TXTAGLEN),
+				"block_to_live":  "0",
+			},
+			"public_keys": []map[string]string{{"hex_bytes": strings.Repeat("44", 2144), "curve_type": "wotsp"}},
+		}, nil)
+	}
+
+	if code := payloads("5000", ""); code != 0 {
+		t.Fatalf("payloads without CHANGE: error %d", code)
+	}
+	if code := payloads("5000", "3500"); code != 0 {
+		t.Fatalf("payloads with the CHANGE the balance leaves: error %d", code)
+	}
+	if code := payloads("5000", "3000"); code != ErrInvalidRequest.Code {
+		t.Fatalf("payloads with a wrong CHANGE: error %d, want %d", code, ErrInvalidRequest.Code)
+	}
+	if code := payloads("1200", ""); code != ErrInvalidRequest.Code {
+		t.Fatalf("payloads spending more than the balance: error %d, want %d", code, ErrInvalidRequest.Code)
+	}
+}
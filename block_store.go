@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Block store settings, set by the -block_store* flags
+var BLOCK_STORE_PATH = ""
+var BLOCK_STORE_COMPRESS = false
+var BLOCK_STORE_MAX_MB int64 = 1024
+var BLOCK_STORE_MAX_AGE time.Duration = 0
+var BLOCK_STORE_WINDOW uint64 = 0
+
+// BLOCK_STORE is the local block archive, nil if disabled
+var BLOCK_STORE *BlockStore
+
+// BlockStore keeps blocks on disk keyed by their hash (<bnum>.0x<bhash>.bc,
+// or .bc.gz when compressed) with an in-memory height index and a retention
+// policy on total size, age and distance from the tip. Files are verified
+// when they are read, not when the store is opened.
+type BlockStore struct {
+	mu         sync.Mutex
+	dir        string
+	compress   bool
+	maxBytes   int64
+	maxAge     time.Duration
+	window     uint64
+	entries    map[string]*storedBlock
+	heights    map[uint64][]string
+	totalBytes int64
+}
+
+type storedBlock struct {
+	Hash   string
+	Height uint64
+	Size   int64
+	Stored time.Time
+	Path   string
+}
+
+// blockHashFromBytes computes the block hash: sha256 of the whole block
+// except the trailing 32 bytes that hold the hash itself
+func blockHashFromBytes(block_bytes []byte) ([32]byte, error) {
+	if len(block_bytes) < BTRAILER_SIZE {
+		return [32]byte{}, fmt.Errorf("block too short: %d bytes", len(block_bytes))
+	}
+	return sha256.Sum256(block_bytes[:len(block_bytes)-32]), nil
+}
+
+// blockFileName is the file name of a stored block
+func blockFileName(height uint64, hexHash string) string {
+	return fmt.Sprintf("%d.%s.bc", height, hexHash)
+}
+
+// parseBlockFileName returns the height and hash in a block file name. Files
+// stored before the height was part of the name have no height.
+func parseBlockFileName(name string) (height uint64, hexHash string, hasHeight bool, ok bool) {
+	if !strings.HasSuffix(name, ".bc") && !strings.HasSuffix(name, ".bc.gz") {
+		return 0, "", false, false
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".bc")
+	prefix, hexHash, found := strings.Cut(base, ".")
+	if !found {
+		return 0, base, false, strings.HasPrefix(base, "0x")
+	}
+	height, err := strconv.ParseUint(prefix, 10, 64)
+	if err != nil || !strings.HasPrefix(hexHash, "0x") {
+		return 0, "", false, false
+	}
+	return height, hexHash, true, true
+}
+
+// OpenBlockStore opens (creating it if needed) a block store and indexes its
+// content from the file names
+func OpenBlockStore(dir string, compress bool, maxBytes int64, maxAge time.Duration, window uint64) (*BlockStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &BlockStore{
+		dir:      dir,
+		compress: compress,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		window:   window,
+		entries:  make(map[string]*storedBlock),
+		heights:  make(map[uint64][]string),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		height, hexHash, hasHeight, ok := parseBlockFileName(file.Name())
+		if file.IsDir() || !ok {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		if !hasHeight {
+			if path, height, err = renameLegacyBlockFile(path, hexHash); err != nil {
+				mlog(3, "§bOpenBlockStore(): §4Removing invalid block file §8%s§4: §c%s", file.Name(), err)
+				os.Remove(path)
+				continue
+			}
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		s.index(&storedBlock{
+			Hash:   hexHash,
+			Height: height,
+			Size:   info.Size(),
+			Stored: info.ModTime(),
+			Path:   path,
+		})
+	}
+
+	mlog(3, "§bOpenBlockStore(): §7Block store §8%s§7 opened with §e%d§7 blocks (§e%d§7 bytes)", dir, len(s.entries), s.totalBytes)
+	return s, nil
+}
+
+// renameLegacyBlockFile adds the height, read from the trailer, to the name
+// of a file stored as 0x<bhash>.bc
+func renameLegacyBlockFile(path string, hexHash string) (string, uint64, error) {
+	block_bytes, err := readBlockFile(path)
+	if err != nil {
+		return path, 0, err
+	}
+	if err := verifyBlockBytes(block_bytes, hexHash); err != nil {
+		return path, 0, err
+	}
+	trailer := block_bytes[len(block_bytes)-BTRAILER_SIZE:]
+	height := binary.LittleEndian.Uint64(trailer[32:40])
+	renamed := filepath.Join(filepath.Dir(path), blockFileName(height, hexHash))
+	if strings.HasSuffix(path, ".gz") {
+		renamed += ".gz"
+	}
+	if err := os.Rename(path, renamed); err != nil {
+		return path, 0, err
+	}
+	return renamed, height, nil
+}
+
+func readBlockFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	return io.ReadAll(reader)
+}
+
+// verifyBlockBytes checks that the bytes hash to hexHash and carry it in the trailer
+func verifyBlockBytes(block_bytes []byte, hexHash string) error {
+	bhash, err := blockHashFromBytes(block_bytes)
+	if err != nil {
+		return err
+	}
+	if "0x"+hex.EncodeToString(bhash[:]) != hexHash {
+		return fmt.Errorf("block hash mismatch")
+	}
+	if !bytes.Equal(block_bytes[len(block_bytes)-32:], bhash[:]) {
+		return fmt.Errorf("trailer hash mismatch")
+	}
+	return nil
+}
+
+func (s *BlockStore) index(entry *storedBlock) {
+	s.entries[entry.Hash] = entry
+	s.heights[entry.Height] = append(s.heights[entry.Height], entry.Hash)
+	s.totalBytes += entry.Size
+}
+
+func (s *BlockStore) remove(hexHash string) {
+	entry, ok := s.entries[hexHash]
+	if !ok {
+		return
+	}
+	os.Remove(entry.Path)
+	delete(s.entries, hexHash)
+	s.totalBytes -= entry.Size
+
+	hashes := s.heights[entry.Height]
+	for i, h := range hashes {
+		if h == hexHash {
+			hashes = append(hashes[:i], hashes[i+1:]...)
+			break
+		}
+	}
+	if len(hashes) == 0 {
+		delete(s.heights, entry.Height)
+	} else {
+		s.heights[entry.Height] = hashes
+	}
+}
+
+// Get returns a stored block, verifying its integrity
+func (s *BlockStore) Get(hexHash string) (go_mcminterface.Block, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[hexHash]
+	if !ok {
+		return go_mcminterface.Block{}, fmt.Errorf("block %s not in store", hexHash)
+	}
+	block_bytes, err := readBlockFile(entry.Path)
+	if err == nil {
+		err = verifyBlockBytes(block_bytes, hexHash)
+	}
+	if err != nil {
+		mlog(3, "§bBlockStore.Get(): §4Dropping corrupted block §6%s§4: §c%s", hexHash, err)
+		s.remove(hexHash)
+		return go_mcminterface.Block{}, err
+	}
+	return go_mcminterface.BlockFromBytes(block_bytes), nil
+}
+
+// HashesAt returns the hashes of the stored blocks at a height
+func (s *BlockStore) HashesAt(height uint64) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.heights[height]...)
+}
+
+// Put stores a block under its hash after checking that the hash is right
+func (s *BlockStore) Put(block go_mcminterface.Block) error {
+	block_bytes := block.GetBytes()
+	hexHash := "0x" + hex.EncodeToString(block.Trailer.Bhash[:])
+	if err := verifyBlockBytes(block_bytes, hexHash); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[hexHash]; ok {
+		return nil
+	}
+
+	height := binary.LittleEndian.Uint64(block.Trailer.Bnum[:])
+	path := filepath.Join(s.dir, blockFileName(height, hexHash))
+	data := block_bytes
+	if s.compress {
+		var buf bytes.Buffer
+		gz, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+		gz.Write(block_bytes)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		path += ".gz"
+		data = buf.Bytes()
+	}
+
+	// Write to a temporary file first so readers never see partial blocks
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	mlog(5, "§bBlockStore.Put(): §7Stored block §6%s§7 (§e%d§7 bytes)", hexHash, len(data))
+	s.index(&storedBlock{
+		Hash:   hexHash,
+		Height: height,
+		Size:   int64(len(data)),
+		Stored: time.Now(),
+		Path:   path,
+	})
+	s.prune(Globals.LatestBlockNum)
+	return nil
+}
+
+// Prune applies the retention policy given the current tip
+func (s *BlockStore) Prune(tip uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(tip)
+}
+
+func (s *BlockStore) prune(tip uint64) {
+	removed := 0
+
+	if s.window > 0 && tip > s.window {
+		for height, hashes := range s.heights {
+			if height < tip-s.window {
+				for _, h := range append([]string{}, hashes...) {
+					s.remove(h)
+					removed++
+				}
+			}
+		}
+	}
+
+	if s.maxAge > 0 {
+		cutoff := time.Now().Add(-s.maxAge)
+		for h, entry := range s.entries {
+			if entry.Stored.Before(cutoff) {
+				s.remove(h)
+				removed++
+			}
+		}
+	}
+
+	// Evict the lowest heights first until the store fits
+	if s.maxBytes > 0 && s.totalBytes > s.maxBytes {
+		heights := make([]uint64, 0, len(s.heights))
+		for height := range s.heights {
+			heights = append(heights, height)
+		}
+		sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+		for _, height := range heights {
+			if s.totalBytes <= s.maxBytes {
+				break
+			}
+			for _, h := range append([]string{}, s.heights[height]...) {
+				s.remove(h)
+				removed++
+			}
+		}
+	}
+
+	if removed > 0 {
+		mlog(4, "§bBlockStore.prune(): §7Pruned §e%d§7 blocks, §e%d§7 left (§e%d§7 bytes)", removed, len(s.entries), s.totalBytes)
+	}
+}
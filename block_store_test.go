@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseBlockFileName(t *testing.T) {
+	tests := []struct {
+		name      string
+		height    uint64
+		hexHash   string
+		hasHeight bool
+		ok        bool
+	}{
+		{"42.0xabcd.bc", 42, "0xabcd", true, true},
+		{"42.0xabcd.bc.gz", 42, "0xabcd", true, true},
+		{"0xabcd.bc", 0, "0xabcd", false, true},
+		{"0xabcd.bc.tmp", 0, "", false, false},
+		{"x.0xabcd.bc", 0, "", false, false},
+		{"notes.txt", 0, "", false, false},
+	}
+	for _, test := range tests {
+		height, hexHash, hasHeight, ok := parseBlockFileName(test.name)
+		if ok != test.ok || (ok && (height != test.height || hexHash != test.hexHash || hasHeight != test.hasHeight)) {
+			t.Errorf("parseBlockFileName(%q) = %d, %q, %v, %v", test.name, height, hexHash, hasHeight, ok)
+		}
+	}
+}
+
+func TestBlockStorePutGet(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		node := NewFakeNode(1, 10)
+		store, err := OpenBlockStore(t.TempDir(), compress, 0, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := node.QueryBlockFromNumber(7)
+		if err := store.Put(block); err != nil {
+			t.Fatal(err)
+		}
+		hexHash := fmt.Sprintf("0x%x", block.Trailer.Bhash[:])
+		if hashes := store.HashesAt(7); len(hashes) != 1 || hashes[0] != hexHash {
+			t.Fatalf("HashesAt(7) = %v, want [%s]", hashes, hexHash)
+		}
+		stored, err := store.Get(hexHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Trailer != block.Trailer || len(stored.Body) != len(block.Body) {
+			t.Fatalf("compress %v: stored block differs from the original", compress)
+		}
+	}
+}
+
+func TestBlockStoreOpenIsLazy(t *testing.T) {
+	dir := t.TempDir()
+	node := NewFakeNode(1, 10)
+	store, err := OpenBlockStore(dir, false, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := node.QueryBlockFromNumber(3)
+	if err := store.Put(block); err != nil {
+		t.Fatal(err)
+	}
+	hexHash := fmt.Sprintf("0x%x", block.Trailer.Bhash[:])
+
+	// A corrupted file is still indexed from its name when the store opens...
+	path := filepath.Join(dir, blockFileName(3, hexHash))
+	if err := os.WriteFile(path, []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err = OpenBlockStore(dir, false, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.HashesAt(3)) != 1 {
+		t.Fatal("the reopened store lost block 3")
+	}
+	// ...and dropped when it is read
+	if _, err := store.Get(hexHash); err == nil {
+		t.Fatal("Get() served a corrupted block")
+	}
+	if len(store.HashesAt(3)) != 0 {
+		t.Fatal("the corrupted block is still indexed")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("the corrupted file was not removed")
+	}
+}
+
+func TestBlockStoreLegacyNames(t *testing.T) {
+	dir := t.TempDir()
+	node := NewFakeNode(1, 10)
+	block, _ := node.QueryBlockFromNumber(5)
+	hexHash := fmt.Sprintf("0x%x", block.Trailer.Bhash[:])
+	if err := os.WriteFile(filepath.Join(dir, hexHash+".bc"), block.GetBytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenBlockStore(dir, false, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes := store.HashesAt(5); len(hashes) != 1 || hashes[0] != hexHash {
+		t.Fatalf("HashesAt(5) = %v, want the legacy block", hashes)
+	}
+	if _, err := os.Stat(filepath.Join(dir, blockFileName(5, hexHash))); err != nil {
+		t.Fatalf("legacy file not renamed: %s", err)
+	}
+}
+
+func TestBlockStorePrune(t *testing.T) {
+	node := NewFakeNode(1, 20)
+	store, err := OpenBlockStore(t.TempDir(), false, 0, 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for bnum := uint64(1); bnum <= 20; bnum++ {
+		block, _ := node.QueryBlockFromNumber(bnum)
+		if err := store.Put(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Prune(20)
+	for bnum := uint64(1); bnum <= 20; bnum++ {
+		if kept := len(store.HashesAt(bnum)) > 0; kept != (bnum >= 15) {
+			t.Errorf("block %d kept %v with a window of 5 below 20", bnum, kept)
+		}
+	}
+}
+
+func TestGetBlockByNumberFromStore(t *testing.T) {
+	node, server, _ := newTestServer(t, 20)
+	store, err := OpenBlockStore(t.TempDir(), false, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := BLOCK_STORE
+	BLOCK_STORE = store
+	t.Cleanup(func() { BLOCK_STORE = previous })
+
+	block, _ := node.QueryBlockFromNumber(4)
+	if err := store.Put(block); err != nil {
+		t.Fatal(err)
+	}
+	// Old blocks leave the sync map, the store still serves them by height
+	setBlockMap(map[string]uint32{})
+
+	// A node that forgot the block proves it came from the store
+	node.blocks[4].Trailer.Nonce[0] ^= 1
+	served, err := server.getBlockByNumber(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if served.Trailer != block.Trailer {
+		t.Fatal("getBlockByNumber(4) did not serve the stored block")
+	}
+	if bnum := binary.LittleEndian.Uint64(served.Trailer.Bnum[:]); bnum != 4 {
+		t.Fatalf("getBlockByNumber(4) served block %d", bnum)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"mochimo-mesh/blocktype"
+	"mochimo-mesh/merkle"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// How many times a block failing verification is fetched again, set by -block_verify_retries
+var BLOCK_VERIFY_RETRIES = 3
+
+// blockMerkleProof returns what the node hashes into the Merkle root of a
+// block: its header and its transactions as written in the block file
+func blockMerkleProof(block go_mcminterface.Block, index int) merkle.Proof {
+	block_bytes := block.GetBytes()
+	proof := merkle.Proof{
+		Header:       block_bytes[:min(int(block.Header.Hdrlen), len(block_bytes))],
+		Transactions: make([][]byte, len(block.Body)),
+		Index:        index,
+	}
+	for i := range block.Body {
+		proof.Transactions[i] = block.Body[i].Bytes()
+	}
+	return proof
+}
+
+// blockMerkleRoot computes the Merkle root of a block like the node does
+func blockMerkleRoot(block go_mcminterface.Block) [32]byte {
+	proof := blockMerkleProof(block, 0)
+	return merkle.Root(binary.LittleEndian.Uint64(block.Trailer.Bnum[:]), proof.Header, proof.Transactions)
+}
+
+// verifyBlock checks a block before it is served, cached or indexed: the
+// hash of its bytes, the transaction count and Merkle root of its body and,
+// when the tfile has them, its trailer and the link to its parent. raw is
+// the block file when it was read from disk, nil when only the parsed block
+// is known.
+func verifyBlock(block go_mcminterface.Block, raw []byte) error {
+	bnum := binary.LittleEndian.Uint64(block.Trailer.Bnum[:])
+	trailer, tfileErr := readTfileTrailer(bnum, TFILE_PATH)
+	neogenesis := blocktype.Classify(block) == blocktype.Neogenesis
+
+	if raw == nil && neogenesis {
+		// A parsed neogenesis block lacks the ledger of its block file, so
+		// its bytes cannot hash to bhash: only the tfile can vouch for it
+		if tfileErr != nil {
+			return fmt.Errorf("neogenesis block %d cannot be checked without the tfile: %w", bnum, tfileErr)
+		}
+		if trailer != block.Trailer {
+			return fmt.Errorf("neogenesis block %d differs from the tfile", bnum)
+		}
+	} else {
+		if raw == nil {
+			raw = block.GetBytes()
+		}
+		bhash, err := blockHashFromBytes(raw)
+		if err != nil {
+			return err
+		}
+		if bhash != block.Trailer.Bhash {
+			return fmt.Errorf("block hash mismatch")
+		}
+	}
+
+	// Neogenesis blocks hold the ledger where transactions would be, and
+	// pseudo-blocks hold nothing: neither has a Merkle root to check
+	tcount := binary.LittleEndian.Uint32(block.Trailer.Tcount[:])
+	if !neogenesis && int(tcount) != len(block.Body) {
+		return fmt.Errorf("block %d has %d transactions, trailer says %d", bnum, len(block.Body), tcount)
+	}
+	if !neogenesis && len(block.Body) > 0 && blockMerkleRoot(block) != block.Trailer.Mroot {
+		return fmt.Errorf("block %d merkle root mismatch", bnum)
+	}
+
+	if tfileErr == nil {
+		if trailer.Bhash != block.Trailer.Bhash {
+			return fmt.Errorf("block %d is not the one in the tfile", bnum)
+		}
+		if !bytes.Equal(trailer.Tcount[:], block.Trailer.Tcount[:]) {
+			return fmt.Errorf("block %d transaction count differs from the tfile", bnum)
+		}
+	}
+	if bnum > 0 {
+		if parent, err := readTfileTrailer(bnum-1, TFILE_PATH); err == nil && parent.Bhash != block.Trailer.Phash {
+			return fmt.Errorf("block %d does not link to its parent in the tfile", bnum)
+		}
+	}
+
+	return nil
+}
+
+// fetchVerifiedBlock queries block bnum to the node, fetching it again while
+// it fails verification
+func (s *Server) fetchVerifiedBlock(bnum uint64) (go_mcminterface.Block, error) {
+	block, err := fetchVerified(func() (go_mcminterface.Block, error) {
+		return s.node.QueryBlockFromNumber(bnum)
+	})
+	if err != nil {
+		return go_mcminterface.Block{}, fmt.Errorf("block %d: %w", bnum, err)
+	}
+	// To the node 0 is the latest block, a client passing it on would answer the tip
+	if got := binary.LittleEndian.Uint64(block.Trailer.Bnum[:]); got != bnum {
+		return go_mcminterface.Block{}, fmt.Errorf("block %d: node answered block %d", bnum, got)
+	}
+	return block, nil
+}
+
+// fetchLatestVerifiedBlock queries the latest block to the node, fetching it
+// again while it fails verification
+func (s *Server) fetchLatestVerifiedBlock() (go_mcminterface.Block, error) {
+	block, err := fetchVerified(s.node.QueryLatestBlock)
+	if err != nil {
+		return go_mcminterface.Block{}, fmt.Errorf("latest block: %w", err)
+	}
+	return block, nil
+}
+
+// fetchVerified runs query until its block passes verification, at most
+// BLOCK_VERIFY_RETRIES more times
+func fetchVerified(query func() (go_mcminterface.Block, error)) (go_mcminterface.Block, error) {
+	var lastErr error
+	for attempt := 0; attempt <= BLOCK_VERIFY_RETRIES; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+		block, err := query()
+		if err != nil {
+			return go_mcminterface.Block{}, err
+		}
+		if lastErr = verifyBlock(block, nil); lastErr == nil {
+			return block, nil
+		}
+		mlog(3, "§bfetchVerified(): §4Block §9%d§4 failed verification (attempt %d/%d): §c%s", binary.LittleEndian.Uint64(block.Trailer.Bnum[:]), attempt+1, BLOCK_VERIFY_RETRIES+1, lastErr)
+	}
+	return go_mcminterface.Block{}, fmt.Errorf("rejected: %w", lastErr)
+}
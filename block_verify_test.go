@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mochimo-mesh/blocktype"
+	"mochimo-mesh/merkle"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// withTfile points TFILE_PATH at path for the duration of the test
+func withTfile(t *testing.T, path string) {
+	previous := TFILE_PATH
+	TFILE_PATH = path
+	t.Cleanup(func() { TFILE_PATH = previous })
+}
+
+func TestBlockMerkleRootRule(t *testing.T) {
+	block, _ := NewFakeNode(1, 10).QueryBlockFromNumber(3)
+	if len(block.Body) == 0 {
+		t.Fatal("block 3 of the fake chain has no transactions")
+	}
+
+	var txs []byte
+	for _, tx := range block.Body {
+		txs = append(txs, tx.Bytes()...)
+	}
+	header := block.GetBytes()[:block.Header.Hdrlen]
+
+	// Before V23Trigger only the transactions are hashed
+	binary.LittleEndian.PutUint64(block.Trailer.Bnum[:], merkle.V23Trigger-1)
+	if blockMerkleRoot(block) != sha256.Sum256(txs) {
+		t.Fatal("the root before V23Trigger is not sha256(transactions)")
+	}
+	// From V23Trigger on the header comes first
+	binary.LittleEndian.PutUint64(block.Trailer.Bnum[:], merkle.V23Trigger)
+	if blockMerkleRoot(block) != sha256.Sum256(append(header, txs...)) {
+		t.Fatal("the root from V23Trigger on is not sha256(header || transactions)")
+	}
+}
+
+func TestVerifyBlock(t *testing.T) {
+	node := NewFakeNode(1, 10)
+	tfile := filepath.Join(t.TempDir(), "tfile.dat")
+	if err := node.WriteTfile(tfile); err != nil {
+		t.Fatal(err)
+	}
+	withTfile(t, tfile)
+
+	block, _ := node.QueryBlockFromNumber(3)
+	if err := verifyBlock(block, nil); err != nil {
+		t.Fatalf("valid block rejected: %s", err)
+	}
+
+	tampered := block
+	tampered.Body = append([]go_mcminterface.TXENTRY{}, block.Body...)
+	tampered.Body[0].SetFee(tampered.Body[0].GetFee() + 1)
+	if err := verifyBlock(tampered, nil); err == nil {
+		t.Fatal("block with a modified transaction accepted")
+	}
+
+	tampered = block
+	tampered.Body = block.Body[1:]
+	if err := verifyBlock(tampered, nil); err == nil {
+		t.Fatal("block missing a transaction accepted")
+	}
+
+	// A block from another chain at the same height is not the tfile's
+	other, _ := NewFakeNode(2, 10).QueryBlockFromNumber(3)
+	if err := verifyBlock(other, nil); err == nil {
+		t.Fatal("block of another chain accepted")
+	}
+}
+
+func TestVerifyBlockWithoutTransactions(t *testing.T) {
+	node := NewFakeNode(1, 10)
+	withTfile(t, filepath.Join(t.TempDir(), "missing.dat"))
+
+	// The genesis block carries no transactions and no Merkle root
+	genesis, _ := node.QueryBlockFromNumber(0)
+	if len(genesis.Body) != 0 {
+		t.Fatal("fake genesis block has transactions")
+	}
+	if err := verifyBlock(genesis, nil); err != nil {
+		t.Fatalf("block without transactions rejected: %s", err)
+	}
+}
+
+// neogenesisFile builds the raw file of a neogenesis block: the header
+// length, the ledger and the trailer
+func neogenesisFile(bnum uint64, phash [32]byte, balances []uint64) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(4+len(balances)*blocktype.LedgerEntrySize))
+	for i, balance := range balances {
+		var address [go_mcminterface.TXADDRLEN]byte
+		address[0] = byte(i + 1)
+		buf.Write(address[:])
+		binary.Write(&buf, binary.LittleEndian, balance)
+	}
+	var trailer go_mcminterface.BTRAILER
+	trailer.Phash = phash
+	binary.LittleEndian.PutUint64(trailer.Bnum[:], bnum)
+	binary.Write(&buf, binary.LittleEndian, trailer)
+	raw := buf.Bytes()
+	bhash := sha256.Sum256(raw[:len(raw)-32])
+	copy(raw[len(raw)-32:], bhash[:])
+	return raw
+}
+
+func TestVerifyNeogenesisBlock(t *testing.T) {
+	node := NewFakeNode(1, 260)
+	tfile := filepath.Join(t.TempDir(), "tfile.dat")
+	if err := node.WriteTfile(tfile); err != nil {
+		t.Fatal(err)
+	}
+
+	// Parsed from the node, a neogenesis block is vouched for by the tfile only
+	neogenesis, _ := node.QueryBlockFromNumber(256)
+	if blocktype.Classify(neogenesis) != blocktype.Neogenesis {
+		t.Fatal("block 256 is not a neogenesis block")
+	}
+	withTfile(t, tfile)
+	if err := verifyBlock(neogenesis, nil); err != nil {
+		t.Fatalf("neogenesis block matching the tfile rejected: %s", err)
+	}
+	forged := neogenesis
+	forged.Trailer.Mroot[0] ^= 1
+	if err := verifyBlock(forged, nil); err == nil {
+		t.Fatal("neogenesis block differing from the tfile accepted")
+	}
+	withTfile(t, filepath.Join(t.TempDir(), "missing.dat"))
+	if err := verifyBlock(neogenesis, nil); err == nil {
+		t.Fatal("neogenesis block accepted without a tfile to check it")
+	}
+
+	// Read from disk, the whole block file is hashed
+	raw := neogenesisFile(512, neogenesis.Trailer.Bhash, []uint64{100, 200, 300})
+	block := go_mcminterface.BlockFromBytes(raw)
+	if err := verifyBlock(block, raw); err != nil {
+		t.Fatalf("neogenesis block file rejected: %s", err)
+	}
+	raw[10] ^= 1
+	if err := verifyBlock(block, raw); err == nil {
+		t.Fatal("corrupted neogenesis block file accepted")
+	}
+}
+
+func TestMainnetBlocks(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "mainnet", "*.bc"))
+	if len(files) == 0 {
+		t.Skip("no mainnet block files in testdata/mainnet")
+	}
+	withTfile(t, filepath.Join(t.TempDir(), "missing.dat"))
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := go_mcminterface.BlockFromBytes(raw)
+		if err := verifyBlock(block, raw); err != nil {
+			t.Errorf("%s: %s", file, err)
+		}
+		if len(block.Body) > 0 && blockMerkleRoot(block) != block.Trailer.Mroot {
+			t.Errorf("%s: computed Merkle root differs from the trailer", file)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Limits of the /blocks endpoint
+const (
+	BLOCKS_MAX_RANGE   = 1000 // blocks per request
+	BLOCKS_CONCURRENCY = 4    // blocks fetched at the same time
+)
+
+// BlocksRequest is the request structure for the /blocks endpoint
+type BlocksRequest struct {
+	NetworkIdentifier NetworkIdentifier  `json:"network_identifier"`
+	StartIndex        uint64             `json:"start_index"`
+	EndIndex          uint64             `json:"end_index"` // inclusive
+	AccountIdentifier *AccountIdentifier `json:"account_identifier,omitempty"`
+}
+
+// BlocksError is the last NDJSON line when a block of the range cannot be fetched
+type BlocksError struct {
+	BlockIdentifier BlockIdentifier `json:"block_identifier"`
+	Error           APIError        `json:"error"`
+}
+
+type fetchedBlock struct {
+	block go_mcminterface.Block
+	err   error
+}
+
+// filterTransactions keeps the transactions with an operation on address
+func filterTransactions(transactions []Transaction, address string) []Transaction {
+	filtered := []Transaction{}
+	for _, tx := range transactions {
+		for _, op := range tx.Operations {
+			if strings.EqualFold(op.Account.Address, address) {
+				filtered = append(filtered, tx)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// blocksHandler streams a height range of blocks as NDJSON, one Rosetta
+// block per line and in height order. Blocks are fetched BLOCKS_CONCURRENCY
+// at a time through the block sources of /block, and fetching stops as soon
+// as the client goes away.
+func (s *Server) blocksHandler(w http.ResponseWriter, r *http.Request) {
+	var req BlocksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bblocksHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bblocksHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	if req.EndIndex < req.StartIndex || req.EndIndex-req.StartIndex >= BLOCKS_MAX_RANGE {
+		mlog(3, "§bblocksHandler(): §4Invalid range §e%d§4-§e%d", req.StartIndex, req.EndIndex)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+	if req.EndIndex > Globals.LatestBlockNum {
+		if req.StartIndex > Globals.LatestBlockNum {
+			giveError(w, ErrBlockNotFound)
+			return
+		}
+		req.EndIndex = Globals.LatestBlockNum
+	}
+	filter := ""
+	if req.AccountIdentifier != nil {
+		filter = req.AccountIdentifier.Address
+	}
+
+	count := int(req.EndIndex - req.StartIndex + 1)
+	mlog(4, "§bblocksHandler(): §7Streaming blocks §9%d§7-§9%d§7 to §9%s", req.StartIndex, req.EndIndex, r.RemoteAddr)
+
+	// Returning stops the dispatch and waits for the fetches in flight, so
+	// no fetch outlives the request
+	ctx, cancel := context.WithCancel(r.Context())
+	var fetchers sync.WaitGroup
+	defer fetchers.Wait()
+	defer cancel()
+	slots := make([]chan fetchedBlock, count)
+	for i := range slots {
+		slots[i] = make(chan fetchedBlock, 1)
+	}
+
+	// The writer frees a slot of sem for every block it sends, so at most
+	// BLOCKS_CONCURRENCY blocks are in flight or waiting in memory
+	sem := make(chan struct{}, BLOCKS_CONCURRENCY)
+	fetchers.Add(1)
+	go func() {
+		defer fetchers.Done()
+		for i := 0; i < count; i++ {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			fetchers.Add(1)
+			go func(i int) {
+				defer fetchers.Done()
+				block, err := s.getBlockByNumber(req.StartIndex + uint64(i))
+				slots[i] <- fetchedBlock{block, err}
+			}(i)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	for i := 0; i < count; i++ {
+		var fetched fetchedBlock
+		select {
+		case fetched = <-slots[i]:
+		case <-ctx.Done():
+			mlog(4, "§bblocksHandler(): §7Client §9%s§7 disconnected after §e%d§7 blocks", r.RemoteAddr, i)
+			return
+		}
+		<-sem
+
+		if fetched.err != nil {
+			bnum := req.StartIndex + uint64(i)
+			mlog(3, "§bblocksHandler(): §4Error fetching block §9%d§4: §c%s", bnum, fetched.err)
+			enc.Encode(BlocksError{
+				BlockIdentifier: BlockIdentifier{Index: int(bnum)},
+				Error:           quorumError(fetched.err, ErrBlockNotFound),
+			})
+			return
+		}
+
+		block := blockFromMochimo(fetched.block)
+		// Lines are in height order: height 0 is genesis, never the tip
+		if block.BlockIdentifier.Index != i+int(req.StartIndex) {
+			mlog(3, "§bblocksHandler(): §4Got block §9%d§4 for height §9%d", block.BlockIdentifier.Index, req.StartIndex+uint64(i))
+			enc.Encode(BlocksError{
+				BlockIdentifier: BlockIdentifier{Index: int(req.StartIndex) + i},
+				Error:           ErrBlockNotFound,
+			})
+			return
+		}
+		if filter != "" {
+			block.Transactions = filterTransactions(block.Transactions, filter)
+		}
+		if err := enc.Encode(block); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// streamBlocks posts a /blocks request and decodes every NDJSON line
+func streamBlocks(t *testing.T, handler http.Handler, body map[string]interface{}) ([]json.RawMessage, int) {
+	t.Helper()
+	body["network_identifier"] = Constants.NetworkIdentifier
+	request, _ := json.Marshal(body)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/blocks", bytes.NewReader(request)))
+	if recorder.Header().Get("Content-Type") != "application/x-ndjson" {
+		return nil, decodeAnswer(t, recorder, "/blocks", nil)
+	}
+	var lines []json.RawMessage
+	scanner := bufio.NewScanner(recorder.Body)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		lines = append(lines, append(json.RawMessage{}, scanner.Bytes()...))
+	}
+	return lines, 0
+}
+
+func TestBlocksHandler(t *testing.T) {
+	node, _, handler := newTestServer(t, 30)
+	Globals.LatestBlockNum = 30
+
+	// From genesis, clamped to the tip, in height order
+	lines, code := streamBlocks(t, handler, map[string]interface{}{"start_index": 0, "end_index": 40})
+	if code != 0 || len(lines) != 31 {
+		t.Fatalf("/blocks 0-40: error %d, %d lines", code, len(lines))
+	}
+	for i, line := range lines {
+		var block Block
+		if err := json.Unmarshal(line, &block); err != nil {
+			t.Fatal(err)
+		}
+		want, _ := node.QueryBlockFromNumber(uint64(i))
+		if block.BlockIdentifier.Index != i || block.BlockIdentifier.Hash != fmt.Sprintf("0x%x", want.Trailer.Bhash[:]) {
+			t.Fatalf("line %d is block %+v", i, block.BlockIdentifier)
+		}
+	}
+
+	if _, code := streamBlocks(t, handler, map[string]interface{}{"start_index": 31, "end_index": 35}); code != ErrBlockNotFound.Code {
+		t.Fatalf("/blocks past the tip: error %d, want %d", code, ErrBlockNotFound.Code)
+	}
+	if _, code := streamBlocks(t, handler, map[string]interface{}{"start_index": 0, "end_index": BLOCKS_MAX_RANGE}); code != ErrInvalidRequest.Code {
+		t.Fatalf("/blocks over the maximum range: error %d, want %d", code, ErrInvalidRequest.Code)
+	}
+}
+
+func TestBlocksHandlerAccountFilter(t *testing.T) {
+	_, _, handler := newTestServer(t, 20)
+	Globals.LatestBlockNum = 20
+
+	lines, _ := streamBlocks(t, handler, map[string]interface{}{"start_index": 1, "end_index": 20})
+	var address string
+	for _, line := range lines {
+		var block Block
+		json.Unmarshal(line, &block)
+		if len(block.Transactions) > 1 {
+			address = block.Transactions[1].Operations[0].Account.Address
+			break
+		}
+	}
+	if address == "" {
+		t.Fatal("the fake chain has no transactions")
+	}
+
+	lines, code := streamBlocks(t, handler, map[string]interface{}{
+		"start_index": 1, "end_index": 20,
+		"account_identifier": map[string]interface{}{"address": address},
+	})
+	if code != 0 || len(lines) != 20 {
+		t.Fatalf("/blocks filtered: error %d, %d lines", code, len(lines))
+	}
+	matched := 0
+	for _, line := range lines {
+		var block Block
+		json.Unmarshal(line, &block)
+		for _, tx := range block.Transactions {
+			touches := false
+			for _, op := range tx.Operations {
+				touches = touches || op.Account.Address == address
+			}
+			if !touches {
+				t.Fatalf("block %d keeps transaction %s not touching %s", block.BlockIdentifier.Index, tx.TransactionIdentifier.Hash, address)
+			}
+			matched++
+		}
+	}
+	if matched == 0 {
+		t.Fatalf("no transaction of %s kept", address)
+	}
+}
+
+// tipForZero answers the tip for block 0, like the node does
+type tipForZero struct{ *FakeNode }
+
+func (n tipForZero) QueryBlockFromNumber(bnum uint64) (go_mcminterface.Block, error) {
+	if bnum == 0 {
+		return n.QueryLatestBlock()
+	}
+	return n.FakeNode.QueryBlockFromNumber(bnum)
+}
+
+func TestBlocksHandlerGenesisNotTip(t *testing.T) {
+	node, _, _ := newTestServer(t, 10)
+	Globals.LatestBlockNum = 10
+	handler := NewServer(tipForZero{node}).Router()
+
+	lines, code := streamBlocks(t, handler, map[string]interface{}{"start_index": 0, "end_index": 5})
+	if code != 0 || len(lines) != 1 {
+		t.Fatalf("/blocks from 0: error %d, %d lines, want a single error line", code, len(lines))
+	}
+	var blocksError BlocksError
+	if err := json.Unmarshal(lines[0], &blocksError); err != nil || blocksError.Error.Code != ErrBlockNotFound.Code || blocksError.BlockIdentifier.Index != 0 {
+		t.Fatalf("first line %s, want the error of block 0", lines[0])
+	}
+}
+
+func TestBlocksHandlerDisconnect(t *testing.T) {
+	_, _, handler := newTestServer(t, 50)
+	Globals.LatestBlockNum = 50
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request, _ := json.Marshal(map[string]interface{}{
+		"network_identifier": Constants.NetworkIdentifier,
+		"start_index":        1,
+		"end_index":          50,
+	})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/blocks", bytes.NewReader(request)).WithContext(ctx))
+	if lines := bytes.Count(recorder.Body.Bytes(), []byte("\n")); lines == 50 {
+		t.Fatal("every block sent to a client that went away")
+	}
+}
+
+// The syncer refreshes the block map while /blocks looks hashes up
+func TestBlockMapConcurrentRefresh(t *testing.T) {
+	node, server, handler := newTestServer(t, 30)
+	Globals.LatestBlockNum = 30
+	block, _ := node.QueryBlockFromNumber(12)
+	hash := fmt.Sprintf("0x%x", block.Trailer.Bhash[:])
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			blockmap, _ := readBlockMap(100, TFILE_PATH)
+			mergeBlockMap(blockmap)
+			PurgeBlockMap(0)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, err := server.getBlockByHexHash(hash); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	streamBlocks(t, handler, map[string]interface{}{"start_index": 0, "end_index": 30})
+	wg.Wait()
+}
@@ -0,0 +1,81 @@
+// Package blocktype tells apart the kinds of Mochimo blocks. It is shared by
+// the /block handlers and the indexer so both label blocks the same way.
+package blocktype
+
+import (
+	"encoding/binary"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Kind is the kind of a block
+type Kind uint16
+
+// Kinds of blocks, with the same values as the indexer's block_types table
+const (
+	Genesis    Kind = 1
+	Standard   Kind = 2
+	Neogenesis Kind = 3
+	Pseudo     Kind = 4
+)
+
+// LedgerEntrySize is the size of a ledger entry in a neogenesis block:
+// the address followed by its 8 bytes balance
+const LedgerEntrySize = go_mcminterface.TXADDRLEN + 8
+
+func (k Kind) String() string {
+	switch k {
+	case Genesis:
+		return "genesis"
+	case Neogenesis:
+		return "neogenesis"
+	case Pseudo:
+		return "pseudo"
+	default:
+		return "standard"
+	}
+}
+
+// ClassifyTrailer tells the kind of a block from its trailer. Block 0 is the
+// genesis block, every 256th block is a neogenesis block carrying the
+// ledger, and a block without transactions is a pseudo-block, which the
+// network produces when no block is solved in time.
+func ClassifyTrailer(trailer go_mcminterface.BTRAILER) Kind {
+	bnum := binary.LittleEndian.Uint64(trailer.Bnum[:])
+	switch {
+	case bnum == 0:
+		return Genesis
+	case bnum&0xFF == 0:
+		return Neogenesis
+	case binary.LittleEndian.Uint32(trailer.Tcount[:]) == 0:
+		return Pseudo
+	default:
+		return Standard
+	}
+}
+
+// Classify tells the kind of a block
+func Classify(block go_mcminterface.Block) Kind {
+	return ClassifyTrailer(block.Trailer)
+}
+
+// LedgerSummary describes the ledger carried by a neogenesis block
+type LedgerSummary struct {
+	Entries     uint64 `json:"entries"`
+	TotalSupply uint64 `json:"total_supply"`
+}
+
+// SummarizeLedger reads the ledger section of raw neogenesis block bytes,
+// which sits between the 4 bytes header length and the trailer
+func SummarizeLedger(block_bytes []byte, trailerSize int) LedgerSummary {
+	var summary LedgerSummary
+	if len(block_bytes) < 4+trailerSize {
+		return summary
+	}
+	ledger := block_bytes[4 : len(block_bytes)-trailerSize]
+	for pos := 0; pos+LedgerEntrySize <= len(ledger); pos += LedgerEntrySize {
+		summary.Entries++
+		summary.TotalSupply += binary.LittleEndian.Uint64(ledger[pos+go_mcminterface.TXADDRLEN : pos+LedgerEntrySize])
+	}
+	return summary
+}
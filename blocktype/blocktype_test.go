@@ -0,0 +1,74 @@
+package blocktype
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+func trailer(bnum uint64, tcount uint32) go_mcminterface.BTRAILER {
+	var t go_mcminterface.BTRAILER
+	binary.LittleEndian.PutUint64(t.Bnum[:], bnum)
+	binary.LittleEndian.PutUint32(t.Tcount[:], tcount)
+	return t
+}
+
+func TestClassifyTrailer(t *testing.T) {
+	tests := []struct {
+		bnum   uint64
+		tcount uint32
+		want   Kind
+	}{
+		{0, 0, Genesis},
+		{1, 3, Standard},
+		{255, 1, Standard},
+		{256, 0, Neogenesis},
+		{0x54300, 0, Neogenesis},
+		{257, 0, Pseudo},
+		{0x54321, 0, Pseudo},
+	}
+	for _, test := range tests {
+		if got := ClassifyTrailer(trailer(test.bnum, test.tcount)); got != test.want {
+			t.Errorf("block %d with %d transactions is %s, want %s", test.bnum, test.tcount, got, test.want)
+		}
+	}
+	if Classify(go_mcminterface.Block{Trailer: trailer(512, 0)}) != Neogenesis {
+		t.Error("Classify() disagrees with ClassifyTrailer()")
+	}
+}
+
+func TestKindString(t *testing.T) {
+	for kind, want := range map[Kind]string{Genesis: "genesis", Standard: "standard", Neogenesis: "neogenesis", Pseudo: "pseudo"} {
+		if kind.String() != want {
+			t.Errorf("kind %d is %q, want %q", kind, kind.String(), want)
+		}
+	}
+}
+
+func TestSummarizeLedger(t *testing.T) {
+	const trailerSize = 160
+	balances := []uint64{100, 2000, 30000}
+	raw := make([]byte, 4)
+	for i, balance := range balances {
+		entry := make([]byte, LedgerEntrySize)
+		entry[0] = byte(i + 1)
+		binary.LittleEndian.PutUint64(entry[go_mcminterface.TXADDRLEN:], balance)
+		raw = append(raw, entry...)
+	}
+	raw = append(raw, make([]byte, trailerSize)...)
+
+	summary := SummarizeLedger(raw, trailerSize)
+	if summary.Entries != 3 || summary.TotalSupply != 32100 {
+		t.Fatalf("SummarizeLedger() = %+v, want 3 entries and 32100", summary)
+	}
+
+	// A block shorter than its trailer, or a partial last entry
+	if summary := SummarizeLedger(raw[:100], trailerSize); summary.Entries != 0 {
+		t.Fatalf("SummarizeLedger() of a truncated block = %+v", summary)
+	}
+	partial := append(append([]byte{}, raw[:4+2*LedgerEntrySize+10]...), make([]byte, trailerSize)...)
+	if summary := SummarizeLedger(partial, trailerSize); summary.Entries != 2 || summary.TotalSupply != 2100 {
+		t.Fatalf("SummarizeLedger() with a partial entry = %+v", summary)
+	}
+}
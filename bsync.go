@@ -5,11 +5,10 @@ import (
 	"encoding/hex"
 	"log"
 	"sort"
+	"sync"
 	"time"
 
 	"mochimo-mesh/indexer"
-
-	"github.com/NickP005/go_mcminterface"
 )
 
 var REFRESH_SYNC_INTERVAL time.Duration = 10
@@ -19,11 +18,15 @@ var SETTINGS_PATH string = "interface_settings.json"
 
 var INDEXER_DB *indexer.Database
 
-func Init() {
+func (s *Server) Init() {
+	// Keep the mempool snapshot, and when pending transactions were first
+	// seen, up to date
+	go s.mempool.Run(MEMPOOL_REFRESH_INTERVAL)
+
 	// Start in another separate thread the syncer.
 	go func() {
 		// Call sync until it is successful
-		for !Sync() {
+		for !s.Sync() {
 			mlog(3, "§bInit(): §4Sync() failed§f (Node offline?), retrying in §9%d seconds", int(REFRESH_SYNC_INTERVAL.Seconds()))
 			time.Sleep(REFRESH_SYNC_INTERVAL)
 		}
@@ -61,7 +64,7 @@ func Init() {
 		defer ticker.Stop()
 
 		for range ticker.C {
-			err := RefreshSync()
+			err := s.RefreshSync()
 			if err != nil {
 				mlog(2, "§bInit(): §4RefreshSync() failed (Node offline?): §c%s", err)
 			}
@@ -70,7 +73,7 @@ func Init() {
 
 }
 
-func Sync() bool {
+func (s *Server) Sync() bool {
 	mlog(1, "§bSync(): §aSyncing started")
 
 	Globals.IsSynced = false
@@ -81,7 +84,7 @@ func Sync() bool {
 	// Set the hash of the genesis block
 	mlog(5, "§bSync(): §7Fetching genesis block trailer")
 	Globals.LastSyncStage = "genesis check"
-	first_trailer, err := getBTrailer(0)
+	first_trailer, err := getBTrailer(s.node, 0)
 	if err != nil {
 		mlog(3, "§bSync(): §4Error fetching genesis block trailer: §c%s", err)
 		return false
@@ -97,9 +100,9 @@ func Sync() bool {
 		mlog(3, "§bSync(): §4Error reading block map: §c%s", err)
 		return false
 	}
-	Globals.HashToBlockNumber = blockmap
+	setBlockMap(blockmap)
 
-	err = RefreshSync()
+	err = s.RefreshSync()
 	if err != nil {
 		mlog(3, "§bSync(): §4Error refreshing sync: §c%s", err)
 		return false
@@ -119,13 +122,16 @@ func Sync() bool {
 	return true
 }
 
-func RefreshSync() error {
+func (s *Server) RefreshSync() error {
 	// Set the latest block number
 	//mlog(5, "§bRefreshSync(): §7Fetching latest block number")
-	latest_block, error := go_mcminterface.QueryLatestBlockNumber()
+	latest_block, error := s.node.QueryLatestBlockNumber()
 	if error != nil {
 		mlog(3, "§bRefreshSync(): §4Error fetching latest block number: §c%s", error)
 		Globals.LastSyncStage = "latest block error"
+		if quorumEnabled() {
+			Globals.LastSyncStage = "quorum disagreement"
+		}
 		Globals.IsSynced = false
 		return error
 	}
@@ -145,10 +151,14 @@ func RefreshSync() error {
 
 	// Set the hash of the latest block and the Solve Timestamp (Stime)
 	mlog(5, "§bRefreshSync(): §7Fetching latest block trailer")
-	latest_trailer, error := getBTrailer(uint32(latest_block))
+	latest_trailer, error := getBTrailer(s.node, uint32(latest_block))
 	if error != nil {
 		mlog(3, "§bRefreshSync(): §4Error fetching latest block trailer: §c%s", error)
 		Globals.LastSyncStage = "latest trailer error"
+		if quorumEnabled() {
+			Globals.LastSyncStage = "quorum disagreement"
+			Globals.IsSynced = false
+		}
 		return error
 	}
 
@@ -178,10 +188,15 @@ func RefreshSync() error {
 		Globals.LastSyncStage = "block map error"
 		return error
 	}
-	for k, v := range blockmap {
-		Globals.HashToBlockNumber[k] = v
+	mergeBlockMap(blockmap)
+	// Short chains, like the FakeNode's, have nothing to purge
+	if latest_block > 10000 {
+		PurgeBlockMap(uint32(latest_block - 10000))
+	}
+	go refreshChainIntegrity()
+	if BLOCK_STORE != nil {
+		BLOCK_STORE.Prune(latest_block)
 	}
-	PurgeBlockMap(uint32(latest_block - 10000))
 
 	// get the last 10 minimum mining fees and set the suggested fee accordingly to SUGGESTED_FEE_PERC
 	Globals.LastSyncStage = "min fee"
@@ -228,7 +243,7 @@ func RefreshSync() error {
 			}
 
 			mlog(5, "§bRefreshSync(): §7Querying block §e%d§7 data for indexer", Globals.LatestBlockNum)
-			block, err := go_mcminterface.QueryBlockFromNumber(Globals.LatestBlockNum)
+			block, err := s.fetchVerifiedBlock(Globals.LatestBlockNum)
 			if err != nil {
 				mlog(3, "§bRefreshSync(): §4Error querying block: §c%s", err)
 				return
@@ -242,24 +257,45 @@ func RefreshSync() error {
 	return nil
 }
 
-func CheckSync() {
+func (s *Server) CheckSync() {
 	// if last sync is more than 10 seconds ago, sync again
 	if time.Now().UnixMilli()-int64(Globals.CurrentBlockUnixMilli) > 10000 {
-		Sync()
+		s.Sync()
 	}
 }
 
-func getBTrailer(bnum uint32) (go_mcminterface.BTRAILER, error) {
-	btrailers, error := go_mcminterface.QueryBTrailers(bnum, 1)
-	if error != nil {
-		return go_mcminterface.BTRAILER{}, error
-	}
+// blockMapMu guards Globals.HashToBlockNumber, written by the syncer while
+// handlers look hashes up
+var blockMapMu sync.RWMutex
+
+// blockNumberOfHash looks a 0x prefixed lowercase hash up in the block map
+func blockNumberOfHash(hexHash string) (uint32, bool) {
+	blockMapMu.RLock()
+	defer blockMapMu.RUnlock()
+	bnum, ok := Globals.HashToBlockNumber[hexHash]
+	return bnum, ok
+}
 
-	return btrailers[0], nil
+// setBlockMap replaces the block map
+func setBlockMap(blockmap map[string]uint32) {
+	blockMapMu.Lock()
+	defer blockMapMu.Unlock()
+	Globals.HashToBlockNumber = blockmap
+}
+
+// mergeBlockMap adds the hashes of blockmap to the block map
+func mergeBlockMap(blockmap map[string]uint32) {
+	blockMapMu.Lock()
+	defer blockMapMu.Unlock()
+	for k, v := range blockmap {
+		Globals.HashToBlockNumber[k] = v
+	}
 }
 
 // PurgeBlockMap removes all the block hashes from the block map that are older than the given block number
 func PurgeBlockMap(blocknum uint32) {
+	blockMapMu.Lock()
+	defer blockMapMu.Unlock()
 	for k, v := range Globals.HashToBlockNumber {
 		if v < blocknum {
 			delete(Globals.HashToBlockNumber, k)
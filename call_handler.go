@@ -23,7 +23,7 @@ type CallResponse struct {
 }
 
 // callHandler handles the /call endpoint
-func callHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) callHandler(w http.ResponseWriter, r *http.Request) {
 	var req CallRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		mlog(3, "§bcallHandler(): §4Error decoding request: §c%s", err)
@@ -65,10 +65,10 @@ func callHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Resolve tag using go_mcminterface
-		wotsAddr, err := go_mcminterface.QueryTagResolve(tag)
+		wotsAddr, err := s.node.QueryTagResolve(tag)
 		if err != nil {
 			mlog(3, "§bcallHandler(): §4Tag §6%s not found: §c%s", tagHex, err)
-			giveError(w, ErrAccountNotFound)
+			giveError(w, quorumError(err, ErrAccountNotFound))
 			return
 		}
 
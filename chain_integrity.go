@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mochimo-mesh/lightclient"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Whether the tfile check requires a haiku in every mined trailer, set by -chain_check_haiku
+var CHAIN_CHECK_HAIKU = true
+
+// ChainIntegrityStatus is reported inside SyncStatus
+type ChainIntegrityStatus struct {
+	Valid         bool   `json:"valid"`
+	CheckedHeight uint64 `json:"checked_height"`
+	ClaimedWork   string `json:"claimed_work"` // from the difficulty of the trailers, not verified
+	FailedAt      *int64 `json:"failed_at,omitempty"`
+	Error         string `json:"error,omitempty"`
+	LastCheck     int64  `json:"last_check,omitempty"`
+}
+
+var chainIntegrity struct {
+	mu        sync.Mutex
+	validator *lightclient.Validator
+	// status is read by /network/status while a long check holds mu
+	status atomic.Pointer[ChainIntegrityStatus]
+}
+
+// checkTrailerHaiku makes sure the nonce of a mined trailer decodes to a
+// haiku. It is a syntax check, the proof-of-work hash is not computed.
+func checkTrailerHaiku(t lightclient.Trailer, raw []byte) error {
+	var btrailer go_mcminterface.BTRAILER
+	if err := binary.Read(bytes.NewReader(raw), binary.LittleEndian, &btrailer); err != nil {
+		return err
+	}
+	if btrailer.GetHaiku() == "" {
+		return fmt.Errorf("nonce is not a valid haiku")
+	}
+	return nil
+}
+
+func chainIntegrityOptions() lightclient.Options {
+	opts := lightclient.DefaultOptions()
+	if CHAIN_CHECK_HAIKU {
+		opts.CheckNonce = checkTrailerHaiku
+	}
+	return opts
+}
+
+// refreshChainIntegrity validates the trailers appended to the tfile since
+// the last call. The whole tfile is validated again if the trailer it
+// stopped at was replaced (chain reorganization).
+func refreshChainIntegrity() {
+	// A check still running (the first one reads the whole tfile) is enough
+	if !chainIntegrity.mu.TryLock() {
+		return
+	}
+	defer chainIntegrity.mu.Unlock()
+
+	tfile, err := os.Open(TFILE_PATH)
+	if err != nil {
+		mlog(3, "§brefreshChainIntegrity(): §4Error opening tfile: §c%s", err)
+		return
+	}
+	defer tfile.Close()
+
+	fi, err := tfile.Stat()
+	if err != nil {
+		return
+	}
+
+	v := chainIntegrity.validator
+	var start int64
+	if v != nil && v.Last() != nil {
+		last := v.Last()
+		trailer, err := readTfileTrailer(last.Bnum, TFILE_PATH)
+		if err != nil || trailer.Bhash != last.Bhash {
+			mlog(3, "§brefreshChainIntegrity(): §6Block §e%d§6 changed in the tfile, validating it again", last.Bnum)
+			v = nil
+		} else {
+			start = int64(last.Bnum+1) * BTRAILER_SIZE
+		}
+	}
+	if v == nil {
+		v = lightclient.NewValidator(chainIntegrityOptions())
+		start = 0
+		mlog(4, "§brefreshChainIntegrity(): §7Validating §e%d§7 trailers of §8%s", fi.Size()/BTRAILER_SIZE, TFILE_PATH)
+	}
+	chainIntegrity.validator = v
+
+	// Skip a trailer the node may still be writing
+	end := fi.Size() - fi.Size()%BTRAILER_SIZE
+	if end < start {
+		end = start
+	}
+	err = v.ValidateReader(io.NewSectionReader(tfile, start, end-start))
+
+	status := v.Status()
+	result := &ChainIntegrityStatus{
+		Valid:         err == nil,
+		CheckedHeight: status.Last,
+		ClaimedWork:   status.ClaimedWork.String(),
+		LastCheck:     time.Now().UnixMilli(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		var verr *lightclient.ValidationError
+		if errors.As(err, &verr) {
+			failed := int64(verr.Bnum)
+			result.FailedAt = &failed
+		}
+		mlog(2, "§brefreshChainIntegrity(): §4Tfile failed validation: §c%s", err)
+	}
+	chainIntegrity.status.Store(result)
+}
+
+// getChainIntegrityStatus returns the last chain integrity result, nil if no check ran yet
+func getChainIntegrityStatus() *ChainIntegrityStatus {
+	return chainIntegrity.status.Load()
+}
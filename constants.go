@@ -54,6 +54,9 @@ var Globals = GlobalsType{
 	LedgerPath:                 "",
 	LedgerCacheRefreshInterval: 900, // 15 minutes
 	HashToBlockNumber:          make(map[string]uint32),
+	QuorumSize:                 0,
+	QuorumMin:                  0,
+	Regtest:                    false,
 }
 
 type ConstantType struct {
@@ -101,4 +104,8 @@ type GlobalsType struct {
 	EnableLedgerCache          bool
 	LedgerCacheRefreshInterval int
 	CertManager                *CertManager
+	QuorumSize                 int
+	QuorumMin                  int
+	QuorumNodes                []string
+	Regtest                    bool
 }
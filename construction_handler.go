@@ -102,7 +102,7 @@ type ConstructionPreprocessResponse struct {
 }
 
 // constructionPreprocessHandler is the HTTP handler for the `/construction/preprocess` endpoint.
-func constructionPreprocessHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) constructionPreprocessHandler(w http.ResponseWriter, r *http.Request) {
 	var req ConstructionPreprocessRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		mlog(3, "§bconstructionPreprocessHandler(): §4Error decoding request: §c%s", err)
@@ -146,6 +146,13 @@ func constructionPreprocessHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The CHANGE operation /construction/parse returns is optional
+	if operationTypes["CHANGE"] > 1 {
+		mlog(3, "§bconstructionPreprocessHandler(): §4More than one CHANGE")
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
 	var source_operation Operation
 	for _, op := range req.Operations {
 		if op.Type == "SOURCE_TRANSFER" {
@@ -188,6 +195,33 @@ func constructionPreprocessHandler(w http.ResponseWriter, r *http.Request) {
 		giveError(w, ErrInvalidRequest)
 		return
 	}
+
+	// Refuse to build a transaction for a WOTS+ address that already signed one.
+	// The source address hash is taken from metadata or resolved from the tag,
+	// and the check fails closed when it cannot be determined.
+	var source_hash string
+	if source_pk, ok := req.Metadata["source_pk"].(string); ok && len(source_pk) == 20*2+2 {
+		source_hash = source_pk[2:]
+	} else if Globals.OnlineMode && len(source_operation.Account.Address) == 20*2+2 {
+		source_tag, err := hex.DecodeString(source_operation.Account.Address[2:])
+		if err == nil {
+			if source_wots, err := s.node.QueryTagResolve(source_tag); err == nil {
+				source_hash = hex.EncodeToString(source_wots.Address[20:])
+			}
+		}
+	}
+	if Globals.OnlineMode || Globals.EnableIndexer {
+		if source_hash == "" {
+			mlog(2, "§bconstructionPreprocessHandler(): §4Cannot determine the source address hash to check for WOTS+ key reuse")
+			giveError(w, ErrServiceUnavailable)
+			return
+		}
+		if err := s.checkWotsReuse(source_hash, ""); err != nil {
+			mlog(2, "§bconstructionPreprocessHandler(): §4WOTS+ key reuse refused: §c%s", err)
+			giveError(w, wotsReuseError(err))
+			return
+		}
+	}
 	// Construct the response
 	response := ConstructionPreprocessResponse{
 		Options:            options,
@@ -212,7 +246,7 @@ type ConstructionMetadataResponse struct {
 	SuggestedFee []Amount               `json:"suggested_fee,omitempty"`
 }
 
-func constructionMetadataHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) constructionMetadataHandler(w http.ResponseWriter, r *http.Request) {
 	var req ConstructionMetadataRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		mlog(3, "§bconstructionMetadataHandler(): §4Error decoding request: §c%s", err)
@@ -235,7 +269,13 @@ func constructionMetadataHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//source_balance, err := go_mcminterface.QueryBalance(req.Options["source_addr"].(string)[2:])
-	source_wots, err := go_mcminterface.QueryTagResolveHex(req.Options["source_addr"].(string)[2:])
+	source_tag, err := hex.DecodeString(req.Options["source_addr"].(string)[2:])
+	if err != nil {
+		mlog(3, "§bconstructionMetadataHandler(): §4Error decoding source address: §c%s", err)
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+	source_wots, err := s.node.QueryTagResolve(source_tag)
 	if err != nil {
 		mlog(3, "§bconstructionMetadataHandler(): §4Source balance not found: §c%s", err)
 		giveError(w, ErrAccountNotFound)
@@ -336,6 +376,12 @@ func constructionPayloadsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if operationTypes["CHANGE"] > 1 {
+		mlog(3, "§bconstructionPayloadsHandler(): §4More than one CHANGE")
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
 	// Check if there are public keys - TO MOVE TO PAYLOADS
 	if len(req.PublicKeys) != 1 {
 		mlog(3, "§bconstructionPayloadsHandler(): §4Invalid number of public keys")
@@ -403,9 +449,23 @@ func constructionPayloadsHandler(w http.ResponseWriter, r *http.Request) {
 
 	txentry.SetSendTotal(send_total)
 
+	if source_total < send_total+txentry.GetFee() {
+		mlog(3, "§bconstructionPayloadsHandler(): §4Source balance §e%d§4 is less than §e%d", source_total, send_total+txentry.GetFee())
+		giveError(w, ErrInvalidRequest)
+		return
+	}
 	change_total = source_total - (send_total + txentry.GetFee())
 	txentry.SetChangeTotal(change_total)
 
+	// The change is what the source balance leaves, a CHANGE operation must agree
+	for _, op := range req.Operations {
+		if op.Type == "CHANGE" && op.Amount.Value != strconv.FormatUint(change_total, 10) {
+			mlog(3, "§bconstructionPayloadsHandler(): §4CHANGE of §e%s§4, the source balance leaves §e%d", op.Amount.Value, change_total)
+			giveError(w, ErrInvalidRequest)
+			return
+		}
+	}
+
 	// Set block to live
 	//block_to_live := req.Metadata["block_to_live"].(uint64)
 	block_to_live, _ := strconv.ParseUint(req.Metadata["block_to_live"].(string), 10, 64)
@@ -576,7 +636,7 @@ func constructionParseHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Construct metadata
 	metadata := make(map[string]interface{})
-	metadata["block_to_live"] = string(tx_entries[0].GetBlockToLive())
+	metadata["block_to_live"] = fmt.Sprintf("%d", tx_entries[0].GetBlockToLive())
 
 	// Construct the signers by finding the source address
 	var signers []AccountIdentifier
@@ -650,7 +710,7 @@ type ConstructionSubmitResponse struct {
 	Metadata              map[string]interface{} `json:"metadata,omitempty"`
 }
 
-func constructionSubmitHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) constructionSubmitHandler(w http.ResponseWriter, r *http.Request) {
 	var req ConstructionSubmitRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		mlog(3, "§bconstructionSubmitHandler(): §4Error decoding request: §c%s", err)
@@ -670,8 +730,26 @@ func constructionSubmitHandler(w http.ResponseWriter, r *http.Request) {
 	// Submit the transaction to the Mochimo blockchain
 	transaction := go_mcminterface.TransactionFromHex(req.SignedTransaction)
 
+	// Never relay a second signature of the same WOTS+ key
+	source := transaction.GetSourceAddress()
+	if err := s.checkWotsReuse(hex.EncodeToString(source.Address[20:]), hex.EncodeToString(transaction.GetID())); err != nil {
+		mlog(2, "§bconstructionSubmitHandler(): §4WOTS+ key reuse refused: §c%s", err)
+		giveError(w, wotsReuseError(err))
+		return
+	}
+
+	// Warn about pending transactions spending the same tag, only one of them can be mined
+	metadata := map[string]interface{}{}
+	if mempool, err := s.mempool.Snapshot(); err == nil {
+		if conflicts := findMempoolConflicts(mempool.Entries, transaction); len(conflicts) > 0 {
+			mlog(2, "§bconstructionSubmitHandler(): §6Transaction conflicts with §e%d§6 pending transactions of tag §60x%x", len(conflicts), source.GetTAG())
+			metadata["warning"] = "the source tag already has pending transactions, only one can be mined"
+			metadata["conflicts"] = conflicts
+		}
+	}
+
 	mlog(5, "§bconstructionSubmitHandler(): §7Submitting transaction with hash §60x%s", hex.EncodeToString(transaction.Hash()))
-	err := go_mcminterface.SubmitTransaction(transaction)
+	err := s.node.SubmitTransaction(transaction)
 	if err != nil {
 		mlog(3, "§bconstructionSubmitHandler(): §4Error submitting transaction: §c%s", err)
 		giveError(w, ErrInternalError)
@@ -689,7 +767,7 @@ func constructionSubmitHandler(w http.ResponseWriter, r *http.Request) {
 		TransactionIdentifier: TransactionIdentifier{
 			Hash: hex.EncodeToString(transaction.Hash()),
 		},
-		Metadata: map[string]interface{}{}, // Add any additional metadata if necessary
+		Metadata: metadata,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
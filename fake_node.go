@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+const (
+	FAKE_GENESIS_TIME   = 1700000000   // Stime of the synthetic genesis block
+	FAKE_BLOCK_TIME     = 60           // Seconds between synthetic blocks
+	FAKE_BLOCK_REWARD   = 5000000000   // 5 MCM per synthetic block
+	FAKE_ACCOUNT_COUNT  = 16           // Funded tags in the synthetic genesis ledger
+	FAKE_GENESIS_AMOUNT = 100000000000 // 100 MCM per funded tag
+	FAKE_MIN_FEE        = 500
+)
+
+// txSignatureSize is the size of the WOTS+ signature data of a transaction,
+// between its destinations and its nonce and ID
+const txSignatureSize = 2208
+
+// FakeNode is an in-memory Mochimo node serving a deterministic synthetic
+// chain, ledger and mempool. It implements NodeClient so that mesh can run
+// without any network access.
+type FakeNode struct {
+	mu      sync.Mutex
+	rng     *rand.Rand
+	blocks  []go_mcminterface.Block
+	ledger  map[string]go_mcminterface.WotsAddress // hex tag -> address and balance
+	tags    [][]byte
+	miner   []byte
+	mempool []go_mcminterface.TXENTRY
+}
+
+// NewFakeNode builds a synthetic chain of the given height. The same seed
+// always produces the same blocks, hashes and balances.
+func NewFakeNode(seed int64, height uint64) *FakeNode {
+	f := &FakeNode{
+		rng:    rand.New(rand.NewSource(seed)),
+		ledger: make(map[string]go_mcminterface.WotsAddress),
+	}
+
+	f.miner = f.randomBytes(go_mcminterface.TXTAGLEN)
+	for i := 0; i < FAKE_ACCOUNT_COUNT; i++ {
+		tag := f.randomBytes(go_mcminterface.TXTAGLEN)
+		f.tags = append(f.tags, tag)
+		f.setAccount(tag, f.randomBytes(go_mcminterface.TXADDRLEN-go_mcminterface.TXTAGLEN), FAKE_GENESIS_AMOUNT)
+	}
+
+	// Genesis block carries no transactions
+	var genesis go_mcminterface.Block
+	binary.LittleEndian.PutUint32(genesis.Trailer.Stime[:], FAKE_GENESIS_TIME)
+	f.sealBlock(&genesis)
+	f.blocks = append(f.blocks, genesis)
+
+	for uint64(len(f.blocks)) <= height {
+		bnum := uint64(len(f.blocks))
+		if bnum&0xFF != 0 {
+			for i := f.rng.Intn(4); i > 0; i-- {
+				if tx, err := f.randomTransfer(); err == nil {
+					f.mempool = append(f.mempool, tx)
+				}
+			}
+		}
+		f.mineBlock()
+	}
+
+	return f
+}
+
+func (f *FakeNode) randomBytes(n int) []byte {
+	b := make([]byte, n)
+	f.rng.Read(b)
+	return b
+}
+
+func (f *FakeNode) setAccount(tag []byte, hash []byte, amount uint64) {
+	var addr go_mcminterface.WotsAddress
+	addr.SetTAG(tag)
+	addr.SetAddress(hash)
+	addr.SetAmount(amount)
+	f.ledger[hex.EncodeToString(tag)] = addr
+}
+
+// randomTransfer builds a valid transaction between two funded tags
+func (f *FakeNode) randomTransfer() (go_mcminterface.TXENTRY, error) {
+	src := f.tags[f.rng.Intn(len(f.tags))]
+	dst := f.tags[f.rng.Intn(len(f.tags))]
+	var amount uint64
+	if balance := f.pendingBalance(src); balance > FAKE_MIN_FEE {
+		amount = uint64(f.rng.Int63n(int64((balance-FAKE_MIN_FEE)/4) + 1))
+	}
+	return f.NewTransfer(src, dst, amount, FAKE_MIN_FEE)
+}
+
+// pendingBalance is the balance of a tag once the mempool is mined
+func (f *FakeNode) pendingBalance(tag []byte) uint64 {
+	account := f.ledger[hex.EncodeToString(tag)]
+	balance := account.GetAmount()
+	for _, tx := range f.mempool {
+		source := tx.GetSourceAddress()
+		if bytes.Equal(source.GetTAG(), tag) {
+			balance = tx.GetChangeTotal()
+		}
+	}
+	return balance
+}
+
+// NewTransfer returns a transaction moving amount from the current address
+// of src to dst, with the change on a fresh address. The synthetic chain has
+// no keys: the transaction carries a placeholder signature.
+func (f *FakeNode) NewTransfer(src []byte, dst []byte, amount uint64, fee uint64) (go_mcminterface.TXENTRY, error) {
+	current := f.ledger[hex.EncodeToString(src)]
+	balance := f.pendingBalance(src)
+	if balance < amount+fee {
+		return go_mcminterface.TXENTRY{}, fmt.Errorf("balance of %d too low to send %d with a fee of %d", balance, amount, fee)
+	}
+	for _, tx := range f.mempool {
+		source := tx.GetSourceAddress()
+		if bytes.Equal(source.GetTAG(), src) {
+			current = tx.GetChangeAddress()
+		}
+	}
+
+	tx := go_mcminterface.NewTXENTRY()
+	tx.SetSignatureScheme("wotsp")
+	tx.SetSourceAddress(current)
+
+	var change go_mcminterface.WotsAddress
+	change.SetTAG(src)
+	change.SetAddress(f.randomBytes(go_mcminterface.TXADDRLEN - go_mcminterface.TXTAGLEN))
+	tx.SetChangeAddress(change)
+
+	tx.AddDestination(go_mcminterface.NewDSTFromString(hex.EncodeToString(dst), "", amount))
+	tx.SetSendTotal(amount)
+	tx.SetFee(fee)
+	tx.SetChangeTotal(balance - amount - fee)
+	tx.SetBlockToLive(0)
+	tx.SetNonce(uint64(len(f.blocks)))
+	tx = fakeSign(tx)
+	copy(tx.Tlr.ID[:], tx.Hash())
+	return tx, nil
+}
+
+// txSignature returns the signature data of a transaction
+func txSignature(tx go_mcminterface.TXENTRY) []byte {
+	raw := tx.Bytes()
+	if len(raw) < txSignatureSize+40 {
+		return nil
+	}
+	return raw[len(raw)-40-txSignatureSize : len(raw)-40]
+}
+
+// fakeSign fills the signature data of a transaction with bytes derived
+// from the transaction, leaving the random source of the chain untouched
+func fakeSign(tx go_mcminterface.TXENTRY) go_mcminterface.TXENTRY {
+	raw := tx.Bytes()
+	hash := sha256.Sum256(raw[:len(raw)-40-txSignatureSize])
+	copy(raw[len(raw)-40-txSignatureSize:], bytes.Repeat(hash[:], txSignatureSize/len(hash)))
+	return go_mcminterface.TransactionFromBytes(raw)
+}
+
+// isSigned tells whether a transaction carries signature data. The
+// signature itself is not verified.
+func isSigned(tx go_mcminterface.TXENTRY) bool {
+	signature := txSignature(tx)
+	return len(signature) == txSignatureSize && !bytes.Equal(signature, make([]byte, txSignatureSize))
+}
+
+// validTransfer checks a transaction against the current ledger
+func (f *FakeNode) validTransfer(tx go_mcminterface.TXENTRY) error {
+	source := tx.GetSourceAddress()
+	account, ok := f.ledger[hex.EncodeToString(source.GetTAG())]
+	if !ok {
+		return fmt.Errorf("source tag not found")
+	}
+	if !isSigned(tx) {
+		return fmt.Errorf("transaction not signed")
+	}
+	if account.Address != source.Address {
+		return fmt.Errorf("source address already spent")
+	}
+	if account.GetAmount() != tx.GetSendTotal()+tx.GetChangeTotal()+tx.GetFee() {
+		return fmt.Errorf("source amount mismatch")
+	}
+	if tx.GetFee() < FAKE_MIN_FEE {
+		return fmt.Errorf("fee too low")
+	}
+	return nil
+}
+
+// applyTransfer moves the balances of a valid transaction in the ledger
+func (f *FakeNode) applyTransfer(tx go_mcminterface.TXENTRY) {
+	change := tx.GetChangeAddress()
+	f.setAccount(change.GetTAG(), change.Address[go_mcminterface.TXTAGLEN:], tx.GetChangeTotal())
+	for _, dst := range tx.GetDestinations() {
+		key := hex.EncodeToString(dst.Tag[:])
+		amount := binary.LittleEndian.Uint64(dst.Amount[:])
+		if account, ok := f.ledger[key]; ok {
+			account.SetAmount(account.GetAmount() + amount)
+			f.ledger[key] = account
+		} else {
+			f.setAccount(dst.Tag[:], dst.Tag[:], amount)
+		}
+	}
+}
+
+// mineBlock turns the valid part of the mempool into the next block
+func (f *FakeNode) mineBlock() go_mcminterface.Block {
+	prev := f.blocks[len(f.blocks)-1]
+	bnum := uint64(len(f.blocks))
+
+	var block go_mcminterface.Block
+	binary.LittleEndian.PutUint64(block.Trailer.Bnum[:], bnum)
+	copy(block.Trailer.Phash[:], prev.Trailer.Bhash[:])
+	copy(block.Trailer.Time0[:], prev.Trailer.Stime[:])
+	binary.LittleEndian.PutUint32(block.Trailer.Stime[:], binary.LittleEndian.Uint32(prev.Trailer.Stime[:])+FAKE_BLOCK_TIME)
+	binary.LittleEndian.PutUint32(block.Trailer.Difficulty[:], 1)
+
+	// Neogenesis blocks carry the ledger, not transactions
+	if bnum&0xFF != 0 {
+		block.Header.Hdrlen = 32
+		copy(block.Header.Maddr[:], f.miner)
+		block.Header.Mreward = FAKE_BLOCK_REWARD
+		binary.LittleEndian.PutUint64(block.Trailer.Mfee[:], FAKE_MIN_FEE)
+
+		var fees uint64
+		var pending []go_mcminterface.TXENTRY
+		for _, tx := range f.mempool {
+			if err := f.validTransfer(tx); err != nil {
+				pending = append(pending, tx)
+				continue
+			}
+			f.applyTransfer(tx)
+			fees += tx.GetFee()
+			block.Body = append(block.Body, tx)
+		}
+		f.mempool = pending
+
+		miner := hex.EncodeToString(f.miner)
+		if account, ok := f.ledger[miner]; ok {
+			account.SetAmount(account.GetAmount() + FAKE_BLOCK_REWARD + fees)
+			f.ledger[miner] = account
+		} else {
+			f.setAccount(f.miner, f.miner, FAKE_BLOCK_REWARD+fees)
+		}
+	}
+
+	f.sealBlock(&block)
+	f.blocks = append(f.blocks, block)
+	return block
+}
+
+// sealBlock sets the transaction count, merkle root and block hash
+func (f *FakeNode) sealBlock(block *go_mcminterface.Block) {
+	binary.LittleEndian.PutUint32(block.Trailer.Tcount[:], uint32(len(block.Body)))
+	if len(block.Body) > 0 {
+		block.Trailer.Mroot = blockMerkleRoot(*block)
+	}
+
+	block_bytes := block.GetBytes()
+	bhash := sha256.Sum256(block_bytes[:len(block_bytes)-32])
+	block.Trailer.Bhash = bhash
+}
+
+// MineBlock mines the mempool into a new block and returns it
+func (f *FakeNode) MineBlock() go_mcminterface.Block {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mineBlock()
+}
+
+// Faucet queues a transfer of amount from the miner's tag to tag. The miner
+// is funded by the block rewards of the synthetic chain.
+func (f *FakeNode) Faucet(tag []byte, amount uint64) (go_mcminterface.TXENTRY, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tx, err := f.NewTransfer(f.miner, tag, amount, FAKE_MIN_FEE)
+	if err != nil {
+		return go_mcminterface.TXENTRY{}, err
+	}
+	f.mempool = append(f.mempool, tx)
+	return tx, nil
+}
+
+// Tags returns the funded tags of the synthetic genesis ledger
+func (f *FakeNode) Tags() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]byte{}, f.tags...)
+}
+
+// WriteTfile writes the trailers of the synthetic chain as a node tfile.dat
+func (f *FakeNode) WriteTfile(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, block := range f.blocks {
+		if err := binary.Write(&buf, binary.LittleEndian, block.Trailer); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func (f *FakeNode) QueryLatestBlockNumber() (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return uint64(len(f.blocks) - 1), nil
+}
+
+func (f *FakeNode) QueryBTrailers(start uint32, count uint32) ([]go_mcminterface.BTRAILER, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if uint64(start) >= uint64(len(f.blocks)) {
+		return nil, fmt.Errorf("block %d not found", start)
+	}
+	trailers := []go_mcminterface.BTRAILER{}
+	for i := uint64(start); i < uint64(start)+uint64(count) && i < uint64(len(f.blocks)); i++ {
+		trailers = append(trailers, f.blocks[i].Trailer)
+	}
+	return trailers, nil
+}
+
+func (f *FakeNode) QueryLatestBlock() (go_mcminterface.Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.blocks[len(f.blocks)-1], nil
+}
+
+func (f *FakeNode) QueryBlockFromNumber(bnum uint64) (go_mcminterface.Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if bnum >= uint64(len(f.blocks)) {
+		return go_mcminterface.Block{}, fmt.Errorf("block %d not found", bnum)
+	}
+	return f.blocks[bnum], nil
+}
+
+func (f *FakeNode) QueryTagResolve(tag []byte) (go_mcminterface.WotsAddress, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	account, ok := f.ledger[hex.EncodeToString(tag)]
+	if !ok {
+		return go_mcminterface.WotsAddress{}, fmt.Errorf("tag not found")
+	}
+	return account, nil
+}
+
+func (f *FakeNode) QueryBalance(wotsAddr string) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, account := range f.ledger {
+		if hex.EncodeToString(account.Address[:]) == wotsAddr {
+			return account.GetAmount(), nil
+		}
+	}
+	return 0, fmt.Errorf("address not found")
+}
+
+func (f *FakeNode) SubmitTransaction(tx go_mcminterface.TXENTRY) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, pending := range f.mempool {
+		if pending.Tlr.ID == tx.Tlr.ID {
+			return fmt.Errorf("transaction already in mempool")
+		}
+	}
+	if err := f.validTransfer(tx); err != nil {
+		return err
+	}
+	f.mempool = append(f.mempool, tx)
+	return nil
+}
+
+func (f *FakeNode) QueryMempool() ([]go_mcminterface.TXENTRY, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]go_mcminterface.TXENTRY{}, f.mempool...), nil
+}
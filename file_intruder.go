@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -27,11 +28,13 @@ func readBlockMap(count uint32, tfile_path string) (map[string]uint32, error) {
 	}
 	fileSize := fi.Size()
 
+	// Don't read past the beginning of a short tfile
+	if available := fileSize / BTRAILER_SIZE; int64(count) > available {
+		count = uint32(available)
+	}
+
 	// Calculate the starting position
 	startPos := fileSize - int64(count)*BTRAILER_SIZE
-	if startPos < 0 {
-		startPos = 0
-	}
 
 	// Seek to the starting position
 	_, err = tfile.Seek(startPos, os.SEEK_SET)
@@ -78,11 +81,13 @@ func readMinFeeMap(count uint32, tfile_path string) (map[uint32]uint64, error) {
 	}
 	fileSize := fi.Size()
 
+	// Don't read past the beginning of a short tfile
+	if available := fileSize / BTRAILER_SIZE; int64(count) > available {
+		count = uint32(available)
+	}
+
 	// Calculate the starting position
 	startPos := fileSize - int64(count)*BTRAILER_SIZE
-	if startPos < 0 {
-		startPos = 0
-	}
 
 	// Seek to the starting position
 	_, err = tfile.Seek(startPos, os.SEEK_SET)
@@ -113,58 +118,109 @@ func readMinFeeMap(count uint32, tfile_path string) (map[uint32]uint64, error) {
 	return minFeeMap, nil
 }
 
-// 0xhash.bc
-func getBlockInDataFolder(bhash string) (go_mcminterface.Block, error) {
-	//check bhash length
-	if len(bhash) != 66 {
-		return go_mcminterface.Block{}, fmt.Errorf("invalid block hash length")
+// read the transaction counts of the last count blocks from the tfile
+func readTxCountMap(count uint32, tfile_path string) (map[uint32]uint32, error) {
+	tfile, err := os.Open(tfile_path)
+	if err != nil {
+		return nil, err
 	}
-	// folder
-	folder := "data/blocks/" + bhash + ".bc"
+	defer tfile.Close()
 
-	// open the file
-	file, err := os.Open(folder)
+	fi, err := tfile.Stat()
 	if err != nil {
-		return go_mcminterface.Block{}, err
+		return nil, err
 	}
-	defer file.Close()
+	fileSize := fi.Size()
 
-	// read the file
-	var block_bytes []byte
-	_, err = file.Read(block_bytes)
+	// Don't read past the beginning of a short tfile
+	if available := fileSize / BTRAILER_SIZE; int64(count) > available {
+		count = uint32(available)
+	}
+
+	_, err = tfile.Seek(fileSize-int64(count)*BTRAILER_SIZE, os.SEEK_SET)
 	if err != nil {
-		return go_mcminterface.Block{}, err
+		return nil, err
 	}
 
-	if len(block_bytes) <= 164 {
-		return go_mcminterface.Block{}, fmt.Errorf("invalid block bytes")
+	txCountMap := make(map[uint32]uint32)
+	for i := uint32(0); i < count; i++ {
+		var btrailer go_mcminterface.BTRAILER
+		err := binary.Read(tfile, binary.LittleEndian, &btrailer)
+		if err != nil {
+			return nil, err
+		}
+		txCountMap[binary.LittleEndian.Uint32(btrailer.Bnum[:])] = binary.LittleEndian.Uint32(btrailer.Tcount[:])
 	}
 
-	// convert the bytes to block
-	return go_mcminterface.BlockFromBytes(block_bytes), nil
+	return txCountMap, nil
 }
 
-func saveBlockInDataFolder(block go_mcminterface.Block) error {
-	// folder
-	mlog(5, "§bSaveBlockInDataFolder(): §7Saving block §e0x%s§7 to data folder", hex.EncodeToString(block.Trailer.Bhash[:]))
-	folder := "data/blocks/0x" + hex.EncodeToString(block.Trailer.Bhash[:]) + ".bc"
+// read the trailer of a single block from the tfile
+func readTfileTrailer(bnum uint64, tfile_path string) (go_mcminterface.BTRAILER, error) {
+	var btrailer go_mcminterface.BTRAILER
+	tfile, err := os.Open(tfile_path)
+	if err != nil {
+		return btrailer, err
+	}
+	defer tfile.Close()
 
-	// open the file
-	file, err := os.Create(folder)
+	buf := make([]byte, BTRAILER_SIZE)
+	if _, err := tfile.ReadAt(buf, int64(bnum)*BTRAILER_SIZE); err != nil {
+		return btrailer, err
+	}
+	err = binary.Read(bytes.NewReader(buf), binary.LittleEndian, &btrailer)
+	return btrailer, err
+}
+
+// scan the last depth trailers of the tfile backwards looking for the block
+// number of a block hash
+func findBlockNumberInTfile(bhash string, tfile_path string, depth uint64) (uint32, error) {
+	if len(bhash) != 66 {
+		return 0, fmt.Errorf("invalid block hash length")
+	}
+	target, err := hex.DecodeString(bhash[2:])
 	if err != nil {
-		mlog(3, "§bSaveBlockInDataFolder(): §4Error creating file: §c%s", err)
-		return err
+		return 0, err
 	}
-	defer file.Close()
 
-	// write the block bytes
-	_, err = file.Write(block.GetBytes())
+	tfile, err := os.Open(tfile_path)
+	if err != nil {
+		return 0, err
+	}
+	defer tfile.Close()
+
+	fi, err := tfile.Stat()
 	if err != nil {
-		mlog(3, "§bSaveBlockInDataFolder(): §4Error writing block bytes: §c%s", err)
-		return err
+		return 0, err
+	}
+
+	// Read 4096 trailers at a time starting from the most recent ones
+	const chunk = 4096 * BTRAILER_SIZE
+	buf := make([]byte, chunk)
+	end := fi.Size() - fi.Size()%BTRAILER_SIZE
+	limit := int64(0)
+	if trailers := uint64(end / BTRAILER_SIZE); depth < trailers {
+		limit = end - int64(depth)*BTRAILER_SIZE
+	}
+	for end > limit {
+		start := end - chunk
+		if start < limit {
+			start = limit
+		}
+		n, err := tfile.ReadAt(buf[:end-start], start)
+		if err != nil && n != int(end-start) {
+			return 0, err
+		}
+		for pos := n - BTRAILER_SIZE; pos >= 0; pos -= BTRAILER_SIZE {
+			// Bhash is the last field of the 160 bytes trailer
+			if bytes.Equal(buf[pos+BTRAILER_SIZE-32:pos+BTRAILER_SIZE], target) {
+				return binary.LittleEndian.Uint32(buf[pos+32 : pos+40]), nil
+			}
+		}
+		end = start
 	}
 
-	return nil
+	return 0, fmt.Errorf("block hash not found in the last %d trailers of the tfile", depth)
 }
 
 func getMempool(mempool_path string) ([]go_mcminterface.TXENTRY, error) {
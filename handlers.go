@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -27,17 +26,16 @@ type AccountIdentifier struct {
 }
 
 // Convert to AccounIdentifier a WotsAddress struct. The tag is considered as the address.
+// Labelled tags carry their label in the metadata.
 func getAccountFromAddress(address go_mcminterface.WotsAddress) AccountIdentifier {
-	tag_hex := "0x" + hex.EncodeToString(address.GetTAG())
-
-	return AccountIdentifier{
-		Address: tag_hex,
-	}
+	return labeledAccount(address.GetTAG())
 }
 
 type SyncStatus struct {
-	Stage  string `json:"stage"`
-	Synced bool   `json:"synced"`
+	Stage          string                `json:"stage"`
+	Synced         bool                  `json:"synced"`
+	Quorum         *QuorumStatus         `json:"quorum,omitempty"`
+	ChainIntegrity *ChainIntegrityStatus `json:"chain_integrity,omitempty"`
 }
 
 type TransactionIdentifier struct {
@@ -48,9 +46,10 @@ type Operation struct {
 	OperationIdentifier struct {
 		Index int `json:"index"`
 	} `json:"operation_identifier"`
-	Type    string `json:"type"`
-	Status  string `json:"status"`
-	Account struct {
+	RelatedOperations []OperationIdentifier `json:"related_operations,omitempty"`
+	Type              string                `json:"type"`
+	Status            string                `json:"status"`
+	Account           struct {
 		Address  string                 `json:"address"`
 		Metadata map[string]interface{} `json:"metadata,omitempty"`
 	} `json:"account"`
@@ -67,9 +66,15 @@ type Operation struct {
 type Transaction struct {
 	TransactionIdentifier TransactionIdentifier  `json:"transaction_identifier"`
 	Operations            []Operation            `json:"operations"`
+	RelatedTransactions   []RelatedTransaction   `json:"related_transactions,omitempty"`
 	Metadata              map[string]interface{} `json:"metadata,omitempty"`
 }
 
+type RelatedTransaction struct {
+	TransactionIdentifier TransactionIdentifier `json:"transaction_identifier"`
+	Direction             string                `json:"direction"` // "forward" or "backward"
+}
+
 type Block struct {
 	BlockIdentifier       BlockIdentifier        `json:"block_identifier"`
 	ParentBlockIdentifier BlockIdentifier        `json:"parent_block_identifier"`
@@ -88,7 +93,7 @@ func checkIdentifier(r *http.Request) (BlockRequest, error) {
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return BlockRequest{}, fmt.Errorf("invalid request body")
 	}
-	if req.NetworkIdentifier.Blockchain != "mochimo" || req.NetworkIdentifier.Network != "mainnet" {
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain || req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
 		return BlockRequest{}, fmt.Errorf("invalid network identifier")
 	}
 	return req, nil
@@ -135,6 +140,9 @@ var (
 	ErrWrongCurveType       = APIError{7, "Wrong curve type", false}
 	ErrInvalidAccountFormat = APIError{8, "Invalid account format", false}
 	ErrServiceUnavailable   = APIError{9, "Service unavailable", true}
+	ErrQuorumNotReached     = APIError{10, "Node quorum not reached", true}
+	ErrWotsReuse            = APIError{11, "WOTS+ address already spent", false}
+	ErrUnauthorized         = APIError{12, "Unauthorized", false}
 )
 
 func giveError(w http.ResponseWriter, err APIError) {
@@ -127,6 +127,7 @@ SELECT * FROM (
    UNION ALL SELECT 2, 'SOURCE'
    UNION ALL SELECT 3, 'DESTINATION'
    UNION ALL SELECT 4, 'FEE'
+   UNION ALL SELECT 5, 'CHANGE'
 ) AS types
 WHERE NOT EXISTS (
    SELECT 1 FROM transfer_types
@@ -271,4 +272,31 @@ JOIN transaction_metadata
    ON transaction_transfer.id_metadata = transaction_metadata.id
 JOIN accounts
    ON transaction_transfer.id_account = accounts.id
-ORDER BY transaction_metadata.created_on DESC;
\ No newline at end of file
+ORDER BY transaction_metadata.created_on DESC;
+-- ------------------------ --
+-- -- Tag Lineage Tables -- --
+-- ------------------------ --
+
+-- CREATE Tag Lineage table (the spends that moved a tag between WOTS addresses)
+CREATE TABLE tag_lineage (
+   id BIGINT AUTO_INCREMENT PRIMARY KEY,
+   id_block BIGINT NOT NULL REFERENCES block_metadata(id),
+   id_account BIGINT NOT NULL REFERENCES accounts(id),
+   transaction_id CHAR(64) NOT NULL,
+   source_hash CHAR(40) NOT NULL, -- hash of the WOTS address the spend emptied
+   change_hash CHAR(40) NOT NULL, -- hash of the WOTS address now holding the tag
+   -- One row per block the spend is in, only those on chain count
+   CONSTRAINT tag_lineage_block_tx_ukey UNIQUE (id_block, transaction_id),
+   INDEX tag_lineage_change_idx (id_account, change_hash),
+   INDEX tag_lineage_tx_idx (transaction_id)
+);
+
+-- CREATE WOTS Spends table (every spend of a WOTS+ one-time address)
+CREATE TABLE wots_spends (
+   id BIGINT AUTO_INCREMENT PRIMARY KEY,
+   address_hash CHAR(40) NOT NULL, -- hash of the spent WOTS address
+   transaction_id CHAR(64) NOT NULL,
+   block_height BIGINT NOT NULL,
+   -- More than one row per address is a key reuse incident
+   CONSTRAINT wots_spends_address_tx_ukey UNIQUE (address_hash, transaction_id)
+);
@@ -6,28 +6,20 @@ import (
 	"encoding/hex"
 	"time"
 
+	"mochimo-mesh/blocktype"
+
 	"github.com/NickP005/go_mcminterface"
 )
 
 var GetBlockByHexHash func(hexHash string) (go_mcminterface.Block, error)
 
 func (d *Database) PushBlock(block go_mcminterface.Block) {
-	var blockType uint16
-	var blockStatus uint16
-
 	// Determine block type and status
-	if block.Header.Hdrlen == 32 && binary.LittleEndian.Uint32(block.Trailer.Tcount[:]) == 0 {
-		blockType = BlockTypePseudo
+	kind := blocktype.Classify(block)
+	blockType := uint16(kind)
+	var blockStatus uint16 = StatusTypeAccepted
+	if kind == blocktype.Pseudo {
 		blockStatus = StatusTypePending // Pseudo blocks start as pending
-	} else if binary.LittleEndian.Uint64(block.Trailer.Bnum[:])&0xFF == 0 {
-		blockType = BlockTypeNeogen
-		blockStatus = StatusTypeAccepted // Neogen blocks are always accepted
-	} else if block.Header.Hdrlen == 32 {
-		blockType = BlockTypeStandard
-		blockStatus = StatusTypeAccepted // TO REVIEW THIS LOGIC
-	} else {
-		blockType = BlockTypeGenesis
-		blockStatus = StatusTypeAccepted // Genesis block is always accepted
 	}
 
 	blockTime := time.Unix(int64(binary.LittleEndian.Uint32(block.Trailer.Time0[:])), 0)
@@ -94,7 +86,7 @@ func (d *Database) PushBlock(block go_mcminterface.Block) {
 		for _, tx := range block.Body {
 			txHash := hex.EncodeToString(tx.GetID())
 			mlog(5, "§bIndexer.PushBlock(): §7Pushing transaction §9%s", txHash)
-			err := d.PushTransaction(tx, blockID, blockStatus, miner_account_id) // Pass blockID and status
+			err := d.PushTransaction(tx, blockID, blockMetadata.BlockHeight, blockStatus, miner_account_id) // Pass blockID and status
 			if err != nil {
 				mlog(3, "§bIndexer.PushBlock(): §4Error pushing transaction: §c%s", err)
 			}
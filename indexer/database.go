@@ -74,6 +74,7 @@ const (
 	TransferTypeSource      = 2
 	TransferTypeDestination = 3
 	TransferTypeFee         = 4
+	TransferTypeChange      = 5
 
 	TransactionTypeStandard = 1
 	TransactionTypeMultiDst = 2
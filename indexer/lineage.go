@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// execer runs statements on the database or inside one of its transactions
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// LineageEntry is a WOTS address that held a tag
+type LineageEntry struct {
+	AddressHash         string
+	FirstHeight         *int64
+	FundingTransaction  *string
+	SpentHeight         *int64
+	SpendingTransaction *string
+}
+
+// tagSpend is a row of tag_lineage: in a block, a transaction moved the tag
+// from its source address to its change address
+type tagSpend struct {
+	TransactionID string
+	SourceHash    string
+	ChangeHash    string
+	Height        int64
+}
+
+// addressHash returns the hex hash part of a WOTS address (after the tag)
+func addressHash(address go_mcminterface.WotsAddress) string {
+	return hex.EncodeToString(address.Address[go_mcminterface.TXTAGLEN:])
+}
+
+// recordTagSpend records that tx, in block blockID, emptied the source
+// address of its tag and moved the tag to the change address. Spends are
+// kept per block, so that a spend only counts while its block is on chain.
+func recordTagSpend(q execer, tx go_mcminterface.TXENTRY, accountID int64, blockID int64) error {
+	_, err := q.Exec(`
+		INSERT IGNORE INTO tag_lineage (
+			id_block, id_account, transaction_id, source_hash, change_hash
+		) VALUES (?, ?, ?, ?, ?)`,
+		blockID, accountID, hex.EncodeToString(tx.GetID()),
+		addressHash(tx.GetSourceAddress()), addressHash(tx.GetChangeAddress()))
+	if err != nil {
+		return fmt.Errorf("error recording tag spend: %w", err)
+	}
+	return nil
+}
+
+// lineageFromSpends chains the spends of a tag, oldest first, into the
+// addresses that held it
+func lineageFromSpends(spends []tagSpend) []LineageEntry {
+	lineage := []LineageEntry{}
+	held := make(map[string]int) // address hash to its entry
+	for i := range spends {
+		spend := &spends[i]
+		source, ok := held[spend.SourceHash]
+		if !ok {
+			// The address got the tag before indexing
+			lineage = append(lineage, LineageEntry{AddressHash: spend.SourceHash})
+			source = len(lineage) - 1
+		}
+		lineage[source].SpentHeight = &spend.Height
+		lineage[source].SpendingTransaction = &spend.TransactionID
+
+		lineage = append(lineage, LineageEntry{
+			AddressHash:        spend.ChangeHash,
+			FirstHeight:        &spend.Height,
+			FundingTransaction: &spend.TransactionID,
+		})
+		held[spend.ChangeHash] = len(lineage) - 1
+	}
+	return lineage
+}
+
+// GetTagLineage returns the addresses that held a tag, oldest first. Spends
+// in split or orphaned blocks are left out.
+func (d *Database) GetTagLineage(tag []byte) ([]LineageEntry, error) {
+	base58Tag, err := AddrTagToBase58(tag)
+	if err != nil {
+		return nil, fmt.Errorf("error converting to base58: %w", err)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT tl.transaction_id, tl.source_hash, tl.change_hash, bm.block_height
+		FROM tag_lineage tl
+		JOIN accounts a ON tl.id_account = a.id
+		JOIN block_metadata bm ON tl.id_block = bm.id
+		WHERE a.account_tag = ? AND bm.id_status NOT IN (?, ?)
+		ORDER BY bm.block_height, tl.id`, base58Tag, StatusTypeSplit, StatusTypeOrphaned)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spends []tagSpend
+	for rows.Next() {
+		var spend tagSpend
+		if err := rows.Scan(&spend.TransactionID, &spend.SourceHash, &spend.ChangeHash, &spend.Height); err != nil {
+			return nil, err
+		}
+		spends = append(spends, spend)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lineageFromSpends(spends), nil
+}
+
+// GetPreviousSpends returns, for each of txIDs, the spend that gave the tag
+// to the address it emptied. Transactions without a known previous spend
+// are left out of the map.
+func (d *Database) GetPreviousSpends(txIDs []string) (map[string]string, error) {
+	previous := make(map[string]string)
+	if len(txIDs) == 0 {
+		return previous, nil
+	}
+
+	args := []interface{}{StatusTypeSplit, StatusTypeOrphaned}
+	for _, txID := range txIDs {
+		args = append(args, txID)
+	}
+	rows, err := d.db.Query(`
+		SELECT DISTINCT cur.transaction_id, prev.transaction_id
+		FROM tag_lineage cur
+		JOIN tag_lineage prev
+			ON prev.id_account = cur.id_account
+			AND prev.change_hash = cur.source_hash
+		JOIN block_metadata bm ON prev.id_block = bm.id
+		WHERE bm.id_status NOT IN (?, ?)
+			AND cur.transaction_id IN (?`+strings.Repeat(", ?", len(txIDs)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var txID, prevID string
+		if err := rows.Scan(&txID, &prevID); err != nil {
+			return nil, err
+		}
+		previous[txID] = prevID
+	}
+	return previous, rows.Err()
+}
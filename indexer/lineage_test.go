@@ -0,0 +1,32 @@
+package indexer
+
+import "testing"
+
+func TestLineageFromSpends(t *testing.T) {
+	// The tag moved a -> b -> c, a holding it before indexing
+	lineage := lineageFromSpends([]tagSpend{
+		{TransactionID: "t1", SourceHash: "a", ChangeHash: "b", Height: 10},
+		{TransactionID: "t2", SourceHash: "b", ChangeHash: "c", Height: 25},
+	})
+	if len(lineage) != 3 {
+		t.Fatalf("%d addresses, want 3", len(lineage))
+	}
+
+	a, b, c := lineage[0], lineage[1], lineage[2]
+	if a.AddressHash != "a" || a.FirstHeight != nil || a.FundingTransaction != nil {
+		t.Fatalf("first address %+v, want a with no known funding", a)
+	}
+	if *a.SpentHeight != 10 || *a.SpendingTransaction != "t1" {
+		t.Fatalf("a spent at %d by %s", *a.SpentHeight, *a.SpendingTransaction)
+	}
+	if b.AddressHash != "b" || *b.FirstHeight != 10 || *b.FundingTransaction != "t1" || *b.SpentHeight != 25 || *b.SpendingTransaction != "t2" {
+		t.Fatalf("second address %+v", b)
+	}
+	if c.AddressHash != "c" || *c.FirstHeight != 25 || *c.FundingTransaction != "t2" || c.SpentHeight != nil {
+		t.Fatalf("current address %+v, want c still holding the tag", c)
+	}
+
+	if lineage := lineageFromSpends(nil); len(lineage) != 0 {
+		t.Fatalf("lineage without spends %+v", lineage)
+	}
+}
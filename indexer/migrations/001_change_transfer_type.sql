@@ -0,0 +1,32 @@
+-- Migration 001: CHANGE transfer type
+--
+-- Change credits used to be recorded as DESTINATION transfers back to the
+-- source tag. They now have a transfer type of their own, like the CHANGE
+-- operations of /block. Safe to run more than once.
+
+INSERT INTO transfer_types (id, transfer_type)
+SELECT 5, 'CHANGE'
+WHERE NOT EXISTS (
+   SELECT 1 FROM transfer_types
+   WHERE transfer_types.id = 5
+);
+
+-- The change was the last DESTINATION transfer of a transaction, credited
+-- to the source account with the change total and no reference
+UPDATE transaction_transfer change_tt
+JOIN (
+   SELECT id_metadata, MAX(id) AS id
+   FROM transaction_transfer
+   WHERE id_type = 3
+   GROUP BY id_metadata
+) last_dst ON last_dst.id = change_tt.id
+JOIN transaction_transfer source_tt
+   ON source_tt.id_metadata = change_tt.id_metadata
+   AND source_tt.id_type = 2
+   AND source_tt.id_account = change_tt.id_account
+JOIN transaction_metadata tm
+   ON tm.id = change_tt.id_metadata
+SET change_tt.id_type = 5
+WHERE change_tt.amount = tm.change_total
+   AND tm.change_total > 0
+   AND (change_tt.reference IS NULL OR change_tt.reference = '');
@@ -0,0 +1,22 @@
+-- Migration 002: tag lineage
+--
+-- Records the spends that moved a tag from one WOTS address to the next,
+-- one row per block holding the spend. Blocks indexed before this migration
+-- have no lineage until they are indexed again. Safe to run more than once.
+--
+-- A tag_lineage table with address_hash and first_height columns comes from
+-- a development schema and holds no block references: drop it first with
+--    DROP TABLE tag_lineage;
+
+CREATE TABLE IF NOT EXISTS tag_lineage (
+   id BIGINT AUTO_INCREMENT PRIMARY KEY,
+   id_block BIGINT NOT NULL REFERENCES block_metadata(id),
+   id_account BIGINT NOT NULL REFERENCES accounts(id),
+   transaction_id CHAR(64) NOT NULL,
+   source_hash CHAR(40) NOT NULL, -- hash of the WOTS address the spend emptied
+   change_hash CHAR(40) NOT NULL, -- hash of the WOTS address now holding the tag
+   -- One row per block the spend is in, only those on chain count
+   CONSTRAINT tag_lineage_block_tx_ukey UNIQUE (id_block, transaction_id),
+   INDEX tag_lineage_change_idx (id_account, change_hash),
+   INDEX tag_lineage_tx_idx (transaction_id)
+);
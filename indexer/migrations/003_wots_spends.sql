@@ -0,0 +1,16 @@
+-- Migration 003: WOTS+ spends
+--
+-- Records every spend of a WOTS+ one-time address. With the indexer
+-- enabled, /construction/preprocess and /construction/submit refuse to
+-- build or submit while this table cannot be read, so databases from an
+-- older schema need it. Blocks indexed before this migration have no spends
+-- until they are indexed again. Safe to run more than once.
+
+CREATE TABLE IF NOT EXISTS wots_spends (
+   id BIGINT AUTO_INCREMENT PRIMARY KEY,
+   address_hash CHAR(40) NOT NULL, -- hash of the spent WOTS address
+   transaction_id CHAR(64) NOT NULL,
+   block_height BIGINT NOT NULL,
+   -- More than one row per address is a key reuse incident
+   CONSTRAINT wots_spends_address_tx_ukey UNIQUE (address_hash, transaction_id)
+);
@@ -149,6 +149,7 @@ func (d *Database) SearchTransactions(maxBlock *int64, offset int64, limit int64
 			tx.Operations = append(tx.Operations, operation)
 			opIndex++
 		}
+		relateToSource(tx.Operations)
 
 		transactions = append(transactions, tx)
 	}
@@ -186,6 +187,23 @@ func (d *Database) SearchTransactions(maxBlock *int64, offset int64, limit int64
 	return transactions, totalCount, nextOffset, nil
 }
 
+// relateToSource links every operation of a transaction to its
+// SOURCE_TRANSFER, as /block does
+func relateToSource(operations []Operation) {
+	for _, op := range operations {
+		if op.Type != "SOURCE_TRANSFER" {
+			continue
+		}
+		source := []OperationIdentifier{op.OperationIdentifier}
+		for i := range operations {
+			if operations[i].Type != "SOURCE_TRANSFER" {
+				operations[i].RelatedOperations = source
+			}
+		}
+		return
+	}
+}
+
 // Helper functions to convert string types to internal IDs
 func getTransferTypeFromString(opType string) int16 {
 	switch opType {
@@ -195,6 +213,8 @@ func getTransferTypeFromString(opType string) int16 {
 		return TransferTypeSource
 	case "DESTINATION_TRANSFER":
 		return TransferTypeDestination
+	case "CHANGE":
+		return TransferTypeChange
 	case "FEE":
 		return TransferTypeFee
 	default:
@@ -237,6 +257,7 @@ type OperationIdentifier struct {
 // Operation represents a transaction operation
 type Operation struct {
 	OperationIdentifier OperationIdentifier    `json:"operation_identifier"`
+	RelatedOperations   []OperationIdentifier  `json:"related_operations,omitempty"`
 	Type                string                 `json:"type"`
 	Status              string                 `json:"status"`
 	Account             AccountIdentifier      `json:"account"`
@@ -263,6 +284,8 @@ func getTransferTypeString(typeID int16) string {
 		return "SOURCE_TRANSFER"
 	case TransferTypeDestination:
 		return "DESTINATION_TRANSFER"
+	case TransferTypeChange:
+		return "CHANGE"
 	case TransferTypeFee:
 		return "FEE"
 	default:
@@ -0,0 +1,40 @@
+package indexer
+
+import "testing"
+
+func TestTransferTypeStrings(t *testing.T) {
+	for _, typeID := range []int16{TransferTypeReward, TransferTypeSource, TransferTypeDestination, TransferTypeChange, TransferTypeFee} {
+		name := getTransferTypeString(typeID)
+		if name == "UNKNOWN" || getTransferTypeFromString(name) != typeID {
+			t.Errorf("transfer type %d is %q, which maps back to %d", typeID, name, getTransferTypeFromString(name))
+		}
+	}
+	if getTransferTypeString(TransferTypeChange) != "CHANGE" {
+		t.Error("change transfers are not CHANGE operations")
+	}
+}
+
+func TestRelateToSource(t *testing.T) {
+	operations := []Operation{
+		{OperationIdentifier: OperationIdentifier{Index: 0}, Type: "SOURCE_TRANSFER"},
+		{OperationIdentifier: OperationIdentifier{Index: 1}, Type: "DESTINATION_TRANSFER"},
+		{OperationIdentifier: OperationIdentifier{Index: 2}, Type: "CHANGE"},
+		{OperationIdentifier: OperationIdentifier{Index: 3}, Type: "FEE"},
+	}
+	relateToSource(operations)
+	if operations[0].RelatedOperations != nil {
+		t.Fatalf("the source relates to %+v", operations[0].RelatedOperations)
+	}
+	for _, op := range operations[1:] {
+		if len(op.RelatedOperations) != 1 || op.RelatedOperations[0].Index != 0 {
+			t.Fatalf("%s relates to %+v, want the source", op.Type, op.RelatedOperations)
+		}
+	}
+
+	// A miner reward has no source
+	reward := []Operation{{Type: "REWARD"}}
+	relateToSource(reward)
+	if reward[0].RelatedOperations != nil {
+		t.Fatal("a reward relates to another operation")
+	}
+}
@@ -34,13 +34,17 @@ type TransactionStatus struct {
 
 // InsertTransactionMetadata inserts a new transaction metadata
 func (d *Database) InsertTransactionMetadata(tx *TransactionMetadata) (int64, error) {
+	return insertTransactionMetadata(d.db, tx)
+}
+
+func insertTransactionMetadata(q execer, tx *TransactionMetadata) (int64, error) {
 	query := `
 		INSERT INTO transaction_metadata (
 			id_type, id_dsa, created_on, transaction_id,
 			send_total, change_total, fee_total, block_to_live, payload_count
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := d.db.Exec(query,
+	result, err := q.Exec(query,
 		tx.Type, tx.DSA, tx.CreatedOn, tx.TransactionID,
 		tx.SendTotal, tx.ChangeTotal, tx.FeeTotal,
 		tx.BlockToLive, tx.PayloadCount)
@@ -58,13 +62,17 @@ func (d *Database) InsertTransactionMetadata(tx *TransactionMetadata) (int64, er
 
 // InsertTransactionStatus inserts a new transaction status, ensuring no duplicates directly in SQL
 func (d *Database) InsertTransactionStatus(status *TransactionStatus) error {
+	return insertTransactionStatus(d.db, status)
+}
+
+func insertTransactionStatus(q execer, status *TransactionStatus) error {
 	// First check if a status already exists for this transaction in this block
 	checkQuery := `
 		SELECT COUNT(*) FROM transaction_status 
 		WHERE id_transaction = ? AND id_block = ?`
 
 	var count int
-	err := d.db.QueryRow(checkQuery, status.TransactionID, status.BlockID).Scan(&count)
+	err := q.QueryRow(checkQuery, status.TransactionID, status.BlockID).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("error checking existing transaction status: %w", err)
 	}
@@ -79,7 +87,7 @@ func (d *Database) InsertTransactionStatus(status *TransactionStatus) error {
 			id_block, id_status, id_transaction, file_offset
 		) VALUES (?, ?, ?, ?)`
 
-	_, err = d.db.Exec(query,
+	_, err = q.Exec(query,
 		status.BlockID, status.Status, status.TransactionID, status.FileOffset)
 	if err != nil {
 		return fmt.Errorf("error inserting transaction status: %w", err)
@@ -98,7 +106,7 @@ func (d *Database) InsertTransaction(tx *TransactionMetadata, status *Transactio
 	defer dbTx.Rollback()
 
 	// Insert transaction metadata
-	txID, err := d.InsertTransactionMetadata(tx)
+	txID, err := insertTransactionMetadata(dbTx, tx)
 	if err != nil {
 		return 0, err
 	}
@@ -107,7 +115,7 @@ func (d *Database) InsertTransaction(tx *TransactionMetadata, status *Transactio
 	status.TransactionID = txID
 
 	// Insert transaction status
-	err = d.InsertTransactionStatus(status)
+	err = insertTransactionStatus(dbTx, status)
 	if err != nil {
 		return 0, err
 	}
@@ -142,7 +150,7 @@ func (d *Database) GetTransactionByID(txID string) (*TransactionMetadata, error)
 }
 
 // Modify PushTransaction to accept blockID and status:
-func (d *Database) PushTransaction(tx go_mcminterface.TXENTRY, blockID int64, blockStatus uint16, miner_account_id int64) error {
+func (d *Database) PushTransaction(tx go_mcminterface.TXENTRY, blockID int64, blockHeight uint64, blockStatus uint16, miner_account_id int64) error {
 	txID := hex.EncodeToString(tx.GetID())
 
 	// Check if transaction already exists
@@ -151,6 +159,18 @@ func (d *Database) PushTransaction(tx go_mcminterface.TXENTRY, blockID int64, bl
 		return fmt.Errorf("error checking existing transaction: %w", err)
 	}
 
+	// Process source account
+	sourceAddr := tx.GetSourceAddress()
+	base58_souce, _ := AddrTagToBase58(sourceAddr.GetTAG())
+	sourceAccount := &Account{
+		Type:    AccountTypeStandard,
+		Address: base58_souce,
+	}
+	sourceAccID, err := d.GetOrCreateAccount(sourceAccount)
+	if err != nil {
+		return fmt.Errorf("error processing source account: %w", err)
+	}
+
 	// Modify transaction status to include block reference
 	txStatus := &TransactionStatus{
 		BlockID:    blockID,     // Use passed blockID
@@ -158,17 +178,36 @@ func (d *Database) PushTransaction(tx go_mcminterface.TXENTRY, blockID int64, bl
 		FileOffset: 0,
 	}
 
+	// The status, the tag lineage, the WOTS spend and the transfers are
+	// written together
+	dbTx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+
+	// The spend moves the tag from the source to the change address, in
+	// every block the transaction is found in
+	if err := recordTagSpend(dbTx, tx, sourceAccID, blockID); err != nil {
+		return err
+	}
+
+	// Every spend is kept, also of known transactions, to catch key reuse
+	if err := recordWotsSpend(dbTx, tx, blockHeight); err != nil {
+		return fmt.Errorf("error recording WOTS spend: %w", err)
+	}
+
 	if existing != nil {
 		// Insert a new status for this new block
 		txStatus.TransactionID = existing.ID
-		err = d.InsertTransactionStatus(txStatus)
+		err = insertTransactionStatus(dbTx, txStatus)
 		if err != nil {
 			return fmt.Errorf("error inserting transaction status: %w", err)
 		}
 
 		// Transaction already exists, skip insertion
 		mlog(4, "§bPushTransaction(): §7Transaction §9%s §7already exists", txID)
-		return nil
+		return dbTx.Commit()
 	}
 
 	// If it doesn't exist, insert the transaction metadata and status and get its ID
@@ -185,22 +224,13 @@ func (d *Database) PushTransaction(tx go_mcminterface.TXENTRY, blockID int64, bl
 		PayloadCount:  int32(len(tx.GetDestinations())),
 	}
 
-	var dbTxID int64
-	dbTxID, err = d.InsertTransaction(txMetadata, txStatus)
+	dbTxID, err := insertTransactionMetadata(dbTx, txMetadata)
 	if err != nil {
 		return fmt.Errorf("error inserting transaction: %w", err)
 	}
-
-	// Process source account
-	sourceAddr := tx.GetSourceAddress()
-	base58_souce, _ := AddrTagToBase58(sourceAddr.GetTAG())
-	sourceAccount := &Account{
-		Type:    AccountTypeStandard,
-		Address: base58_souce,
-	}
-	sourceAccID, err := d.GetOrCreateAccount(sourceAccount)
-	if err != nil {
-		return fmt.Errorf("error processing source account: %w", err)
+	txStatus.TransactionID = dbTxID
+	if err := insertTransactionStatus(dbTx, txStatus); err != nil {
+		return fmt.Errorf("error inserting transaction: %w", err)
 	}
 
 	// Create transfers slice
@@ -224,8 +254,7 @@ func (d *Database) PushTransaction(tx go_mcminterface.TXENTRY, blockID int64, bl
 		}
 		destAccID, err := d.GetOrCreateAccount(destAccount)
 		if err != nil {
-			mlog(3, "§bPushTransaction(): §4Error processing destination account: §c%s", err)
-			continue
+			return fmt.Errorf("error processing destination account: %w", err)
 		}
 
 		transfers = append(transfers, Transfer{
@@ -237,12 +266,12 @@ func (d *Database) PushTransaction(tx go_mcminterface.TXENTRY, blockID int64, bl
 		})
 	}
 
-	// Add the change transfer if there's a change
+	// Add the change transfer, the tag moving to the change address
 	if txMetadata.ChangeTotal > 0 {
 		transfers = append(transfers, Transfer{
-			Type:       TransferTypeDestination,
+			Type:       TransferTypeChange,
 			MetadataID: dbTxID,
-			AccountID:  sourceAccID, // Change goes back to source
+			AccountID:  sourceAccID, // Change goes back to the source tag
 			Reference:  "",
 			Amount:     txMetadata.ChangeTotal,
 		})
@@ -260,10 +289,10 @@ func (d *Database) PushTransaction(tx go_mcminterface.TXENTRY, blockID int64, bl
 	}
 
 	// Insert all transfers
-	err = d.InsertTransfers(transfers)
+	err = insertTransfers(dbTx, transfers)
 	if err != nil {
 		return fmt.Errorf("error inserting transfers: %w", err)
 	}
 
-	return nil
+	return dbTx.Commit()
 }
@@ -11,18 +11,25 @@ type Transfer struct {
 
 // InsertTransfers inserts multiple transfers for a transaction
 func (d *Database) InsertTransfers(transfers []Transfer) error {
-	query := `
-		INSERT INTO transaction_transfer (
-			id_type, id_metadata, id_account, reference, amount
-		) VALUES (?, ?, ?, ?, ?)`
-
 	tx, err := d.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(query)
+	if err := insertTransfers(tx, transfers); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertTransfers(q execer, transfers []Transfer) error {
+	query := `
+		INSERT INTO transaction_transfer (
+			id_type, id_metadata, id_account, reference, amount
+		) VALUES (?, ?, ?, ?, ?)`
+
+	stmt, err := q.Prepare(query)
 	if err != nil {
 		return err
 	}
@@ -40,8 +47,7 @@ func (d *Database) InsertTransfers(transfers []Transfer) error {
 			return err
 		}
 	}
-
-	return tx.Commit()
+	return nil
 }
 
 // GetTransfersByTransaction retrieves all transfers for a transaction
@@ -49,7 +55,8 @@ func (d *Database) GetTransfersByTransaction(txID int64) ([]Transfer, error) {
 	query := `
 		SELECT id_type, id_metadata, id_account, reference, amount
 		FROM transaction_transfer 
-		WHERE id_metadata = ?`
+		WHERE id_metadata = ?
+		ORDER BY id`
 
 	rows, err := d.db.Query(query, txID)
 	if err != nil {
@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// WotsSpend is a spend of a WOTS+ address
+type WotsSpend struct {
+	AddressHash   string
+	TransactionID string
+	BlockHeight   int64
+}
+
+// RecordWotsSpend records that tx used the one-time key of its source address
+func (d *Database) RecordWotsSpend(tx go_mcminterface.TXENTRY, height uint64) error {
+	return recordWotsSpend(d.db, tx, height)
+}
+
+func recordWotsSpend(q execer, tx go_mcminterface.TXENTRY, height uint64) error {
+	_, err := q.Exec(`
+		INSERT IGNORE INTO wots_spends (
+			address_hash, transaction_id, block_height
+		) VALUES (?, ?, ?)`,
+		addressHash(tx.GetSourceAddress()), hex.EncodeToString(tx.GetID()), height)
+	return err
+}
+
+// GetWotsSpends returns the spends of an address hash, oldest first
+func (d *Database) GetWotsSpends(addrHash string) ([]WotsSpend, error) {
+	rows, err := d.db.Query(`
+		SELECT address_hash, transaction_id, block_height
+		FROM wots_spends
+		WHERE address_hash = ?
+		ORDER BY block_height, id`, strings.ToLower(strings.TrimPrefix(addrHash, "0x")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spends := []WotsSpend{}
+	for rows.Next() {
+		var spend WotsSpend
+		if err := rows.Scan(&spend.AddressHash, &spend.TransactionID, &spend.BlockHeight); err != nil {
+			return nil, err
+		}
+		spends = append(spends, spend)
+	}
+	return spends, rows.Err()
+}
+
+// GetWotsReuseIncidents returns the spends of addresses that signed more
+// than one transaction, most recent incidents first
+func (d *Database) GetWotsReuseIncidents(offset int64, limit int64) ([]WotsSpend, error) {
+	rows, err := d.db.Query(`
+		SELECT ws.address_hash, ws.transaction_id, ws.block_height
+		FROM wots_spends ws
+		JOIN (
+			SELECT address_hash, MAX(block_height) AS last_height
+			FROM wots_spends
+			GROUP BY address_hash
+			HAVING COUNT(*) > 1
+			ORDER BY last_height DESC
+			LIMIT ? OFFSET ?
+		) reused ON ws.address_hash = reused.address_hash
+		ORDER BY reused.last_height DESC, ws.address_hash, ws.block_height`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spends := []WotsSpend{}
+	for rows.Next() {
+		var spend WotsSpend
+		if err := rows.Scan(&spend.AddressHash, &spend.TransactionID, &spend.BlockHeight); err != nil {
+			return nil, err
+		}
+		spends = append(spends, spend)
+	}
+	return spends, rows.Err()
+}
@@ -0,0 +1,32 @@
+package indexer
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// failingExecer records the statements it is given and fails them all
+type failingExecer struct{ args [][]interface{} }
+
+func (f *failingExecer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	f.args = append(f.args, args)
+	return nil, errors.New("lock wait timeout exceeded")
+}
+
+func (f *failingExecer) QueryRow(query string, args ...interface{}) *sql.Row { return nil }
+
+func (f *failingExecer) Prepare(query string) (*sql.Stmt, error) { return nil, errors.ErrUnsupported }
+
+func TestRecordWotsSpendReturnsError(t *testing.T) {
+	var tx go_mcminterface.TXENTRY
+	q := &failingExecer{}
+	if err := recordWotsSpend(q, tx, 42); err == nil {
+		t.Fatal("failed insert of a WOTS spend returned no error")
+	}
+	if len(q.args) != 1 || q.args[0][2] != uint64(42) {
+		t.Fatalf("statements %v, want one insert at height 42", q.args)
+	}
+}
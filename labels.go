@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Label registry settings, set by the -labels flags
+var LABELS_PATH = "labels.json"
+var LABELS_ADMIN_TOKEN = ""
+
+// Label names a known tag (exchange, pool, dev fund, burn address, ...)
+type Label struct {
+	Tag      string `json:"tag"` // 0x + 20 bytes hex
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// labelRegistry maps tags to labels. The file at LABELS_PATH seeds it and
+// is rewritten by the admin API.
+var labelRegistry = struct {
+	labels  map[[go_mcminterface.TXTAGLEN]byte]Label
+	version uint64 // bumped at every change
+	mu      sync.RWMutex
+}{labels: make(map[[go_mcminterface.TXTAGLEN]byte]Label)}
+
+// parseLabelTag reads a 0x prefixed hex tag
+func parseLabelTag(tag string) ([go_mcminterface.TXTAGLEN]byte, bool) {
+	var key [go_mcminterface.TXTAGLEN]byte
+	tag = strings.TrimPrefix(strings.ToLower(tag), "0x")
+	bytes, err := hex.DecodeString(tag)
+	if err != nil || len(bytes) != go_mcminterface.TXTAGLEN {
+		return key, false
+	}
+	copy(key[:], bytes)
+	return key, true
+}
+
+// LoadLabels reads the label file, a missing file is an empty registry
+func LoadLabels(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var labels []Label
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return err
+	}
+
+	registry := make(map[[go_mcminterface.TXTAGLEN]byte]Label, len(labels))
+	for _, label := range labels {
+		key, ok := parseLabelTag(label.Tag)
+		if !ok {
+			mlog(2, "§bLoadLabels(): §6Skipping label §e%s§6 with invalid tag §e%s", label.Name, label.Tag)
+			continue
+		}
+		label.Tag = "0x" + hex.EncodeToString(key[:])
+		registry[key] = label
+	}
+
+	labelRegistry.mu.Lock()
+	labelRegistry.labels = registry
+	labelRegistry.version++
+	labelRegistry.mu.Unlock()
+
+	mlog(2, "§bLoadLabels(): §2Loaded §e%d§2 labels from §8%s", len(registry), path)
+	return nil
+}
+
+// saveLabels writes a registry to LABELS_PATH
+func saveLabels(registry map[[go_mcminterface.TXTAGLEN]byte]Label) error {
+	labels := make([]Label, 0, len(registry))
+	for _, label := range registry {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Tag < labels[j].Tag })
+
+	data, err := json.MarshalIndent(labels, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(LABELS_PATH), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(LABELS_PATH+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(LABELS_PATH+".tmp", LABELS_PATH)
+}
+
+// updateLabels applies change to a copy of the registry and, when change
+// tells it changed, saves it. The registry only changes once the file is
+// written.
+func updateLabels(change func(registry map[[go_mcminterface.TXTAGLEN]byte]Label) bool) (bool, error) {
+	labelRegistry.mu.Lock()
+	defer labelRegistry.mu.Unlock()
+
+	registry := maps.Clone(labelRegistry.labels)
+	if !change(registry) {
+		return false, nil
+	}
+	if err := saveLabels(registry); err != nil {
+		return true, err
+	}
+	labelRegistry.labels = registry
+	labelRegistry.version++
+	return true, nil
+}
+
+// getLabel returns the label of a tag
+func getLabel(tag []byte) (Label, bool) {
+	if len(tag) < go_mcminterface.TXTAGLEN {
+		return Label{}, false
+	}
+	var key [go_mcminterface.TXTAGLEN]byte
+	copy(key[:], tag)
+
+	labelRegistry.mu.RLock()
+	defer labelRegistry.mu.RUnlock()
+	label, ok := labelRegistry.labels[key]
+	return label, ok
+}
+
+// labelsVersion changes whenever a label is added, changed or removed
+func labelsVersion() uint64 {
+	labelRegistry.mu.RLock()
+	defer labelRegistry.mu.RUnlock()
+	return labelRegistry.version
+}
+
+// labeledAccount renders a tag (or an address starting with it) as an
+// account identifier, with its label in the metadata when it has one
+func labeledAccount(tag []byte) AccountIdentifier {
+	if len(tag) > go_mcminterface.TXTAGLEN {
+		tag = tag[:go_mcminterface.TXTAGLEN]
+	}
+	account := AccountIdentifier{Address: "0x" + hex.EncodeToString(tag)}
+	if label, ok := getLabel(tag); ok {
+		account.Metadata = map[string]interface{}{
+			"label": map[string]string{"name": label.Name, "category": label.Category},
+		}
+	}
+	return account
+}
+
+// labeledAccountHex is labeledAccount for a 0x prefixed hex tag
+func labeledAccountHex(address string) AccountIdentifier {
+	tag, err := hex.DecodeString(strings.TrimPrefix(address, "0x"))
+	if err != nil || len(tag) < go_mcminterface.TXTAGLEN {
+		return AccountIdentifier{Address: address}
+	}
+	account := labeledAccount(tag)
+	account.Address = address
+	return account
+}
+
+// excludedTags returns the tags labelled with one of the categories
+func excludedTags(categories []string) map[[go_mcminterface.TXTAGLEN]byte]bool {
+	if len(categories) == 0 {
+		return nil
+	}
+	excluded := make(map[[go_mcminterface.TXTAGLEN]byte]bool)
+
+	labelRegistry.mu.RLock()
+	defer labelRegistry.mu.RUnlock()
+	for key, label := range labelRegistry.labels {
+		for _, category := range categories {
+			if strings.EqualFold(label.Category, category) {
+				excluded[key] = true
+			}
+		}
+	}
+	return excluded
+}
+
+// isExcluded tells whether a ledger entry belongs to an excluded tag
+func isExcluded(excluded map[[go_mcminterface.TXTAGLEN]byte]bool, entry go_mcminterface.LedgerEntry) bool {
+	if len(excluded) == 0 {
+		return false
+	}
+	var key [go_mcminterface.TXTAGLEN]byte
+	copy(key[:], entry.Address[:go_mcminterface.TXTAGLEN])
+	return excluded[key]
+}
+
+// excludedTotals counts the entries of excluded tags and their balance
+func excludedTotals(entries []go_mcminterface.LedgerEntry, excluded map[[go_mcminterface.TXTAGLEN]byte]bool) (count uint64, balance uint64) {
+	if len(excluded) == 0 {
+		return 0, 0
+	}
+	for _, entry := range entries {
+		if isExcluded(excluded, entry) {
+			count++
+			balance += entry.Balance
+		}
+	}
+	return count, balance
+}
+
+// LabelsRequest is the request structure for the /labels endpoints
+type LabelsRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	Label             *Label            `json:"label,omitempty"` // for /admin/labels/set
+	Tag               string            `json:"tag,omitempty"`   // for /admin/labels/delete
+}
+
+// LabelsResponse is the response structure for the /labels endpoints
+type LabelsResponse struct {
+	Labels []Label `json:"labels"`
+}
+
+// decodeLabelsRequest decodes and checks a labels request, and the admin
+// token when admin is set
+func decodeLabelsRequest(w http.ResponseWriter, r *http.Request, caller string, admin bool) (LabelsRequest, bool) {
+	var req LabelsRequest
+	if admin {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if LABELS_ADMIN_TOKEN == "" || subtle.ConstantTimeCompare([]byte(token), []byte(LABELS_ADMIN_TOKEN)) != 1 {
+			mlog(2, "§b%s(): §4Unauthorized request from §9%s", caller, r.RemoteAddr)
+			giveError(w, ErrUnauthorized)
+			return req, false
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§b%s(): §4Error decoding request: §c%s", caller, err)
+		giveError(w, ErrInvalidRequest)
+		return req, false
+	}
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§b%s(): §4Wrong network identifier", caller)
+		giveError(w, ErrWrongNetwork)
+		return req, false
+	}
+	return req, true
+}
+
+// giveLabels answers with every label, sorted by tag
+func giveLabels(w http.ResponseWriter) {
+	labelRegistry.mu.RLock()
+	response := LabelsResponse{Labels: make([]Label, 0, len(labelRegistry.labels))}
+	for _, label := range labelRegistry.labels {
+		response.Labels = append(response.Labels, label)
+	}
+	labelRegistry.mu.RUnlock()
+	sort.Slice(response.Labels, func(i, j int) bool { return response.Labels[i].Tag < response.Labels[j].Tag })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// labelsHandler lists the labels
+func labelsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := decodeLabelsRequest(w, r, "labelsHandler", false); !ok {
+		return
+	}
+	giveLabels(w)
+}
+
+// labelsSetHandler adds or replaces a label
+func labelsSetHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeLabelsRequest(w, r, "labelsSetHandler", true)
+	if !ok {
+		return
+	}
+	if req.Label == nil || req.Label.Name == "" {
+		mlog(3, "§blabelsSetHandler(): §4Missing label")
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+	key, ok := parseLabelTag(req.Label.Tag)
+	if !ok {
+		mlog(3, "§blabelsSetHandler(): §4Invalid tag §e%s", req.Label.Tag)
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+	label := *req.Label
+	label.Tag = "0x" + hex.EncodeToString(key[:])
+
+	_, err := updateLabels(func(registry map[[go_mcminterface.TXTAGLEN]byte]Label) bool {
+		registry[key] = label
+		return true
+	})
+	if err != nil {
+		mlog(2, "§blabelsSetHandler(): §4Error saving labels: §c%s", err)
+		giveError(w, ErrInternalError)
+		return
+	}
+
+	mlog(2, "§blabelsSetHandler(): §2Label §e%s§2 (§e%s§2) set on §6%s", label.Name, label.Category, label.Tag)
+	giveLabels(w)
+}
+
+// labelsDeleteHandler removes a label
+func labelsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeLabelsRequest(w, r, "labelsDeleteHandler", true)
+	if !ok {
+		return
+	}
+	key, ok := parseLabelTag(req.Tag)
+	if !ok {
+		mlog(3, "§blabelsDeleteHandler(): §4Invalid tag §e%s", req.Tag)
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+
+	found, err := updateLabels(func(registry map[[go_mcminterface.TXTAGLEN]byte]Label) bool {
+		_, found := registry[key]
+		delete(registry, key)
+		return found
+	})
+	if !found {
+		giveError(w, ErrAccountNotFound)
+		return
+	}
+	if err != nil {
+		mlog(2, "§blabelsDeleteHandler(): §4Error saving labels: §c%s", err)
+		giveError(w, ErrInternalError)
+		return
+	}
+
+	mlog(2, "§blabelsDeleteHandler(): §2Label removed from §60x%x", key[:])
+	giveLabels(w)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// withLabels empties the label registry and keeps it in a temporary file,
+// with the admin API enabled by token when it is not empty
+func withLabels(t *testing.T, token string) {
+	path, adminToken := LABELS_PATH, LABELS_ADMIN_TOKEN
+	LABELS_PATH, LABELS_ADMIN_TOKEN = filepath.Join(t.TempDir(), "labels.json"), token
+	reset := func() {
+		labelRegistry.mu.Lock()
+		labelRegistry.labels = make(map[[go_mcminterface.TXTAGLEN]byte]Label)
+		labelRegistry.version++
+		labelRegistry.mu.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		LABELS_PATH, LABELS_ADMIN_TOKEN = path, adminToken
+		reset()
+	})
+}
+
+// labelTag is the 0x prefixed hex of ledgerTag
+func labelTag(tag byte) string {
+	return "0x" + hex.EncodeToString(ledgerTag(tag))
+}
+
+func TestLoadLabels(t *testing.T) {
+	withLabels(t, "")
+	labels, _ := json.Marshal([]Label{
+		{Tag: "0X" + strings.ToUpper(hex.EncodeToString(ledgerTag(0xab))), Name: "Exchange", Category: "exchange"},
+		{Tag: "0x1234", Name: "Short"},
+		{Tag: labelTag(2), Name: "Pool", Category: "pool"},
+	})
+	if err := os.WriteFile(LABELS_PATH, labels, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadLabels(LABELS_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	// The invalid tag is skipped, the others are read whatever their case
+	if label, ok := getLabel(ledgerTag(0xab)); !ok || label.Name != "Exchange" || label.Tag != labelTag(0xab) {
+		t.Fatalf("label of tag 0xab: %+v, %v", label, ok)
+	}
+	entry := ledgerEntry(2, 1, 0)
+	if account := labeledAccount(entry.Address[:]); account.Address != labelTag(2) || account.Metadata == nil {
+		t.Fatalf("labeled address %+v, want its tag with the label", account)
+	}
+	if account := labeledAccount(ledgerTag(3)); account.Metadata != nil {
+		t.Fatalf("unlabeled tag %+v", account)
+	}
+
+	// A missing file keeps the registry
+	version := labelsVersion()
+	if err := LoadLabels(filepath.Join(t.TempDir(), "missing.json")); err != nil || labelsVersion() != version {
+		t.Fatalf("loading a missing file: %v, version %d from %d", err, labelsVersion(), version)
+	}
+	os.WriteFile(LABELS_PATH, []byte("{"), 0644)
+	if err := LoadLabels(LABELS_PATH); err == nil {
+		t.Fatal("invalid label file loaded")
+	}
+}
+
+func TestLabelsAdmin(t *testing.T) {
+	withLabels(t, "secret")
+	_, _, handler := newTestServer(t, 5)
+	admin := func(path string, token string, body map[string]interface{}) (LabelsResponse, int) {
+		body["network_identifier"] = Constants.NetworkIdentifier
+		request, _ := json.Marshal(body)
+		httpRequest := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(request))
+		httpRequest.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httpRequest)
+		var response LabelsResponse
+		return response, decodeAnswer(t, recorder, path, &response)
+	}
+	label := map[string]interface{}{"label": Label{Tag: labelTag(1), Name: "Dev fund", Category: "dev"}}
+
+	if _, code := admin("/admin/labels/set", "wrong", label); code != ErrUnauthorized.Code {
+		t.Fatalf("set with a wrong token: error %d, want %d", code, ErrUnauthorized.Code)
+	}
+	if response, code := admin("/admin/labels/set", "secret", label); code != 0 || len(response.Labels) != 1 || response.Labels[0].Name != "Dev fund" {
+		t.Fatalf("set: error %d, %+v", code, response)
+	}
+	if _, code := admin("/admin/labels/set", "secret", map[string]interface{}{"label": Label{Tag: "0x12", Name: "Short"}}); code != ErrInvalidAccountFormat.Code {
+		t.Fatalf("set on an invalid tag: error %d, want %d", code, ErrInvalidAccountFormat.Code)
+	}
+
+	// Saved for the next start, and listed
+	if err := LoadLabels(LABELS_PATH); err != nil {
+		t.Fatal(err)
+	}
+	var response LabelsResponse
+	if code := post(t, handler, "/labels", map[string]interface{}{}, &response); code != 0 || len(response.Labels) != 1 || response.Labels[0].Tag != labelTag(1) {
+		t.Fatalf("/labels after reloading: error %d, %+v", code, response)
+	}
+
+	if response, code := admin("/admin/labels/delete", "secret", map[string]interface{}{"tag": labelTag(1)}); code != 0 || len(response.Labels) != 0 {
+		t.Fatalf("delete: error %d, %+v", code, response)
+	}
+	if _, code := admin("/admin/labels/delete", "secret", map[string]interface{}{"tag": labelTag(1)}); code != ErrAccountNotFound.Code {
+		t.Fatalf("delete of a missing label: error %d, want %d", code, ErrAccountNotFound.Code)
+	}
+}
+
+func TestLabelsAdminDisabled(t *testing.T) {
+	withLabels(t, "")
+	_, _, handler := newTestServer(t, 5)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/admin/labels/set", bytes.NewReader([]byte("{}"))))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("admin API without a token: status %d", recorder.Code)
+	}
+}
+
+func TestExcludeCategories(t *testing.T) {
+	withLabels(t, "")
+	labels, _ := json.Marshal([]Label{{Tag: labelTag(2), Name: "Exchange", Category: "exchange"}})
+	os.WriteFile(LABELS_PATH, labels, 0644)
+	if err := LoadLabels(LABELS_PATH); err != nil {
+		t.Fatal(err)
+	}
+	node, _, _ := newTestServer(t, 10)
+	withLedger(t, node, 9, []go_mcminterface.LedgerEntry{
+		ledgerEntry(1, 1, 300), ledgerEntry(2, 1, 500), ledgerEntry(3, 1, 100), ledgerEntry(4, 1, 300),
+	})
+	handler := NewServer(node).Router()
+
+	var distribution DistributionResponse
+	if code := post(t, handler, "/stats/distribution", map[string]interface{}{"exclude_categories": []string{"Exchange"}}, &distribution); code != 0 {
+		t.Fatalf("/stats/distribution: error %d", code)
+	}
+	if distribution.TotalAccounts != 3 || distribution.CirculatingSupply.Value != "700" {
+		t.Fatalf("distribution without the exchange: %d accounts holding %s, want 3 holding 700", distribution.TotalAccounts, distribution.CirculatingSupply.Value)
+	}
+
+	rank := func(tag byte) (RankResponse, int) {
+		var response RankResponse
+		code := post(t, handler, "/stats/rank", map[string]interface{}{
+			"account_identifier": map[string]string{"address": labelTag(tag)},
+			"exclude_categories": []string{"exchange"},
+		}, &response)
+		return response, code
+	}
+	if response, code := rank(1); code != 0 || response.Rank != 1 || response.TotalAccounts != 3 {
+		t.Fatalf("rank without the exchange: error %d, %+v, want rank 1 of 3", code, response)
+	}
+	if _, code := rank(2); code != ErrAccountNotFound.Code {
+		t.Fatalf("rank of the excluded exchange: error %d, want %d", code, ErrAccountNotFound.Code)
+	}
+
+	// The label shows in the answers
+	var response RankResponse
+	post(t, handler, "/stats/rank", map[string]interface{}{"account_identifier": map[string]string{"address": labelTag(2)}}, &response)
+	if response.AccountIdentifier.Metadata["label"] == nil {
+		t.Fatalf("ranked exchange without its label: %+v", response.AccountIdentifier)
+	}
+}
+
+func TestLabelsSaveFailure(t *testing.T) {
+	withLabels(t, "secret")
+	_, _, handler := newTestServer(t, 5)
+	admin := func(path string, body map[string]interface{}) int {
+		body["network_identifier"] = Constants.NetworkIdentifier
+		request, _ := json.Marshal(body)
+		httpRequest := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(request))
+		httpRequest.Header.Set("Authorization", "Bearer secret")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httpRequest)
+		return decodeAnswer(t, recorder, path, &LabelsResponse{})
+	}
+	if code := admin("/admin/labels/set", map[string]interface{}{"label": Label{Tag: labelTag(1), Name: "Dev fund"}}); code != 0 {
+		t.Fatalf("set: error %d", code)
+	}
+
+	// The folder of the label file can not be created under a file
+	blocker := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(blocker, nil, 0644)
+	LABELS_PATH = filepath.Join(blocker, "labels.json")
+	version := labelsVersion()
+
+	if code := admin("/admin/labels/set", map[string]interface{}{"label": Label{Tag: labelTag(2), Name: "Pool"}}); code != ErrInternalError.Code {
+		t.Fatalf("set without a label folder: error %d, want %d", code, ErrInternalError.Code)
+	}
+	if _, ok := getLabel(ledgerTag(2)); ok {
+		t.Fatal("label set although it was not saved")
+	}
+	if code := admin("/admin/labels/delete", map[string]interface{}{"tag": labelTag(1)}); code != ErrInternalError.Code {
+		t.Fatalf("delete without a label folder: error %d, want %d", code, ErrInternalError.Code)
+	}
+	if _, ok := getLabel(ledgerTag(1)); !ok {
+		t.Fatal("label deleted although it was not saved")
+	}
+	if labelsVersion() != version {
+		t.Fatalf("labels version %d after failed saves, want %d", labelsVersion(), version)
+	}
+}
+
+func TestExcludedViewCache(t *testing.T) {
+	withLabels(t, "")
+	withTopK(t, 10000)
+	updateLabels(func(registry map[[go_mcminterface.TXTAGLEN]byte]Label) bool {
+		registry[[go_mcminterface.TXTAGLEN]byte(ledgerTag(2))] = Label{Tag: labelTag(2), Name: "Exchange", Category: "exchange"}
+		return true
+	})
+	cache := loadEntries(t, []go_mcminterface.LedgerEntry{
+		ledgerEntry(1, 1, 300), ledgerEntry(2, 1, 500), ledgerEntry(3, 1, 100), ledgerEntry(4, 1, 300),
+	})
+	var err error
+	if cache.Distribution, err = computeLedgerDistribution(cache.ledger); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same categories, whatever their order and case, share a view
+	ledger, distribution, err := cache.distributionWithout([]string{"exchange", "pool"})
+	if err != nil || ledger.tally.count != 3 || distribution == cache.Distribution {
+		t.Fatalf("distribution without the exchange: %v, %d accounts", err, ledger.tally.count)
+	}
+	again, _, _ := cache.distributionWithout([]string{"Pool", "EXCHANGE"})
+	if view, _ := cache.viewWithout([]string{"pool", "exchange"}); again != ledger || view != ledger {
+		t.Fatal("view computed again for the same categories")
+	}
+	if view, _ := cache.viewWithout(nil); view != cache.ledger {
+		t.Fatal("view without categories is not the cached ledger")
+	}
+
+	// A label change computes it again
+	updateLabels(func(registry map[[go_mcminterface.TXTAGLEN]byte]Label) bool {
+		registry[[go_mcminterface.TXTAGLEN]byte(ledgerTag(3))] = Label{Tag: labelTag(3), Name: "Pool", Category: "pool"}
+		return true
+	})
+	if view, _ := cache.viewWithout([]string{"exchange", "pool"}); view == ledger || view.tally.count != 2 {
+		t.Fatalf("view after a label change: %d accounts, want 2", view.tally.count)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Ledger archive settings, set by the -ledger_archive* flags. The archive
+// is disabled unless a folder is given.
+var LEDGER_ARCHIVE_PATH = ""
+var LEDGER_ARCHIVE_EVERY time.Duration = 0 // 0 archives once per neogenesis epoch
+var LEDGER_ARCHIVE_KEEP int = 180
+
+// LEDGER_ARCHIVE keeps past ledgers, nil if disabled
+var LEDGER_ARCHIVE *LedgerArchive
+
+const ledgerArchiveIndex = "index.json"
+
+// LedgerSnapshotInfo describes an archived ledger
+type LedgerSnapshotInfo struct {
+	Block   uint64    `json:"block"`
+	Hash    string    `json:"hash"`
+	Time    time.Time `json:"time"`
+	Entries uint64    `json:"entries"`
+	Supply  uint64    `json:"supply"`
+	File    string    `json:"file"`
+	Size    int64     `json:"size"`
+}
+
+// LedgerArchive stores gzipped, address sorted copies of the ledger
+// (l<block>.ledger.gz, TXADDRLEN bytes of address and 8 bytes of balance per
+// entry) with a JSON index and a retention on the number of snapshots.
+// mu only guards the index: snapshots are read and sorted without it.
+type LedgerArchive struct {
+	mu        sync.Mutex
+	dir       string
+	every     time.Duration
+	keep      int
+	snapshots []LedgerSnapshotInfo // sorted by block
+
+	loaded  atomic.Pointer[loadedLedgerSnapshot]
+	loading sync.Mutex // one snapshot is decompressed at a time
+}
+
+// loadedLedgerSnapshot is the last snapshot read, kept so that paging
+// through it does not decompress it again. It is never modified once
+// published, but for byBalance which is sorted once, on first use.
+type loadedLedgerSnapshot struct {
+	info      LedgerSnapshotInfo
+	byAddress []go_mcminterface.LedgerEntry
+	byBalance []go_mcminterface.LedgerEntry
+	sortOnce  sync.Once
+}
+
+// OpenLedgerArchive opens (creating it if needed) a ledger archive and reads its index
+func OpenLedgerArchive(dir string, every time.Duration, keep int) (*LedgerArchive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	a := &LedgerArchive{dir: dir, every: every, keep: keep}
+
+	data, err := os.ReadFile(filepath.Join(dir, ledgerArchiveIndex))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var snapshots []LedgerSnapshotInfo
+		if err := json.Unmarshal(data, &snapshots); err != nil {
+			return nil, fmt.Errorf("invalid ledger archive index: %w", err)
+		}
+		// Forget snapshots whose file is gone
+		for _, snapshot := range snapshots {
+			if _, err := os.Stat(filepath.Join(dir, snapshot.File)); err != nil {
+				mlog(3, "§bOpenLedgerArchive(): §4Ledger snapshot §8%s§4 is missing", snapshot.File)
+				continue
+			}
+			a.snapshots = append(a.snapshots, snapshot)
+		}
+		sort.Slice(a.snapshots, func(i, j int) bool { return a.snapshots[i].Block < a.snapshots[j].Block })
+	}
+
+	mlog(3, "§bOpenLedgerArchive(): §7Ledger archive §8%s§7 opened with §e%d§7 snapshots", dir, len(a.snapshots))
+	return a, nil
+}
+
+// writeIndex saves the index, replacing the old one atomically
+func (a *LedgerArchive) writeIndex() error {
+	data, err := json.MarshalIndent(a.snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(a.dir, ledgerArchiveIndex)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Due tells whether the ledger at blockNum should be archived: once per
+// neogenesis epoch (256 blocks), or every a.every if set
+func (a *LedgerArchive) Due(blockNum uint64, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if blockNum == 0 {
+		return false
+	}
+	if len(a.snapshots) == 0 {
+		return true
+	}
+	last := a.snapshots[len(a.snapshots)-1]
+	if a.every > 0 {
+		return now.Sub(last.Time) >= a.every
+	}
+	return blockNum>>8 > last.Block>>8
+}
+
+// Archive stores an address sorted ledger stream read at blockNum. It is
+// compressed straight to a temporary file, then renamed so that readers
+// never see partial snapshots.
+func (a *LedgerArchive) Archive(ledger io.Reader, blockNum uint64, blockHash [32]byte, supply uint64) error {
+	info := LedgerSnapshotInfo{
+		Block:  blockNum,
+		Hash:   "0x" + BytesToHex(blockHash[:]),
+		Time:   time.Now(),
+		Supply: supply,
+		File:   fmt.Sprintf("l%016x.ledger.gz", blockNum),
+	}
+	path := filepath.Join(a.dir, info.File)
+
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(file)
+	gz, _ := gzip.NewWriterLevel(out, gzip.BestCompression)
+	err = readLedgerEntries(ledger, func(entry go_mcminterface.LedgerEntry) {
+		gz.Write(entry.Address[:])
+		gz.Write(binary.LittleEndian.AppendUint64(nil, entry.Balance))
+		info.Entries++
+	})
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if fi, statErr := os.Stat(path + ".tmp"); err == nil && statErr == nil {
+		info.Size = fi.Size()
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+
+	// A refresh at the same height replaces the snapshot
+	i := sort.Search(len(a.snapshots), func(i int) bool { return a.snapshots[i].Block >= blockNum })
+	if i < len(a.snapshots) && a.snapshots[i].Block == blockNum {
+		a.snapshots[i] = info
+	} else {
+		a.snapshots = append(a.snapshots, LedgerSnapshotInfo{})
+		copy(a.snapshots[i+1:], a.snapshots[i:])
+		a.snapshots[i] = info
+	}
+
+	// Retention, oldest first
+	for a.keep > 0 && len(a.snapshots) > a.keep {
+		os.Remove(filepath.Join(a.dir, a.snapshots[0].File))
+		a.snapshots = a.snapshots[1:]
+	}
+
+	mlog(3, "§bLedgerArchive.Archive(): §7Archived ledger at block §e%d§7 (§e%d§7 entries, §e%d§7 bytes)", blockNum, info.Entries, info.Size)
+	return a.writeIndex()
+}
+
+// Snapshots returns the archived snapshots, oldest first
+func (a *LedgerArchive) Snapshots() []LedgerSnapshotInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]LedgerSnapshotInfo{}, a.snapshots...)
+}
+
+// find returns the index entry of the latest snapshot at or below height
+func (a *LedgerArchive) find(height uint64) (LedgerSnapshotInfo, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := sort.Search(len(a.snapshots), func(i int) bool { return a.snapshots[i].Block > height })
+	if i == 0 {
+		return LedgerSnapshotInfo{}, fmt.Errorf("no ledger snapshot at or below block %d", height)
+	}
+	return a.snapshots[i-1], nil
+}
+
+// load returns the latest snapshot at or below height, decompressing it
+// unless it is the one read last
+func (a *LedgerArchive) load(height uint64) (*loadedLedgerSnapshot, error) {
+	info, err := a.find(height)
+	if err != nil {
+		return nil, err
+	}
+	if loaded := a.loaded.Load(); loaded != nil && loaded.info == info {
+		return loaded, nil
+	}
+
+	a.loading.Lock()
+	defer a.loading.Unlock()
+	// Another request may have read it meanwhile
+	if loaded := a.loaded.Load(); loaded != nil && loaded.info == info {
+		return loaded, nil
+	}
+
+	file, err := os.Open(filepath.Join(a.dir, info.File))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	entries := make([]go_mcminterface.LedgerEntry, 0, info.Entries)
+	if err := readLedgerEntries(gz, func(entry go_mcminterface.LedgerEntry) {
+		entries = append(entries, entry)
+	}); err != nil {
+		return nil, fmt.Errorf("corrupted ledger snapshot %s: %w", info.File, err)
+	}
+
+	loaded := &loadedLedgerSnapshot{info: info, byAddress: entries}
+	a.loaded.Store(loaded)
+	return loaded, nil
+}
+
+// Balance finds an address or tag in the latest snapshot at or below height
+func (a *LedgerArchive) Balance(height uint64, address []byte) (LedgerSnapshotInfo, go_mcminterface.LedgerEntry, bool, error) {
+	snapshot, err := a.load(height)
+	if err != nil {
+		return LedgerSnapshotInfo{}, go_mcminterface.LedgerEntry{}, false, err
+	}
+	entry, ok := searchLedger(snapshot.byAddress, address)
+	return snapshot.info, entry, ok, nil
+}
+
+// Richest returns the snapshot entries sorted by balance, highest first, of
+// the latest snapshot at or below height. The slice must not be modified.
+func (a *LedgerArchive) Richest(height uint64) (LedgerSnapshotInfo, []go_mcminterface.LedgerEntry, error) {
+	snapshot, err := a.load(height)
+	if err != nil {
+		return LedgerSnapshotInfo{}, nil, err
+	}
+	snapshot.sortOnce.Do(func() {
+		byBalance := make([]go_mcminterface.LedgerEntry, len(snapshot.byAddress))
+		copy(byBalance, snapshot.byAddress)
+		sort.SliceStable(byBalance, func(i, j int) bool {
+			return byBalance[i].Balance > byBalance[j].Balance
+		})
+		snapshot.byBalance = byBalance
+	})
+	return snapshot.info, snapshot.byBalance, nil
+}
+
+// LedgerSnapshotsRequest is the request structure for the /stats/ledger/snapshots endpoint
+type LedgerSnapshotsRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+}
+
+// LedgerSnapshotsResponse is the response structure for the /stats/ledger/snapshots endpoint
+type LedgerSnapshotsResponse struct {
+	Snapshots []LedgerSnapshotInfo `json:"snapshots"`
+}
+
+// ledgerSnapshotsHandler lists the archived ledgers
+func ledgerSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	var req LedgerSnapshotsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bledgerSnapshotsHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bledgerSnapshotsHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	if LEDGER_ARCHIVE == nil {
+		mlog(3, "§bledgerSnapshotsHandler(): §4Ledger archive is disabled")
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LedgerSnapshotsResponse{Snapshots: LEDGER_ARCHIVE.Snapshots()})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+func TestLedgerArchive(t *testing.T) {
+	dir := t.TempDir()
+	archive, err := OpenLedgerArchive(dir, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !archive.Due(10, time.Now()) || archive.Due(0, time.Now()) {
+		t.Fatal("an empty archive is due for any block but genesis")
+	}
+
+	for i, bnum := range []uint64{100, 300, 600} {
+		ledger := []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, uint64(10*i+5)), ledgerEntry(2, 1, 20), ledgerEntry(3, 1, uint64(100*i))}
+		if err := archive.Archive(bytes.NewReader(encodeLedger(ledger)), bnum, [32]byte{byte(i)}, 125+110*uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Once per neogenesis epoch
+	if archive.Due(700, time.Now()) || !archive.Due(768, time.Now()) {
+		t.Fatal("archive due within the epoch of the last snapshot, or not in the next one")
+	}
+
+	// Only the last two are kept, on disk too
+	snapshots := archive.Snapshots()
+	if len(snapshots) != 2 || snapshots[0].Block != 300 || snapshots[1].Block != 600 {
+		t.Fatalf("snapshots %+v", snapshots)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "l0000000000000064.ledger.gz")); !os.IsNotExist(err) {
+		t.Fatalf("snapshot of block 100 left on disk: %v", err)
+	}
+	reopened, err := OpenLedgerArchive(dir, 0, 2)
+	if err != nil || len(reopened.Snapshots()) != 2 {
+		t.Fatalf("reopened archive: %v, %+v", err, reopened.Snapshots())
+	}
+
+	info, entry, ok, err := reopened.Balance(599, ledgerTag(1))
+	if err != nil || !ok || info.Block != 300 || entry.Balance != 15 {
+		t.Fatalf("balance at 599: block %d, %+v, %v, %v", info.Block, entry, ok, err)
+	}
+	if _, _, _, err := reopened.Balance(299, []byte{1}); err == nil {
+		t.Fatal("balance below the oldest snapshot")
+	}
+	info, richest, err := reopened.Richest(600)
+	if err != nil || info.Block != 600 || len(richest) != 3 || richest[0].Balance != 200 || richest[2].Balance != 20 {
+		t.Fatalf("richest at 600: block %d, %+v, %v", info.Block, richest, err)
+	}
+}
+
+// Snapshots are read and sorted while the archive keeps archiving
+func TestLedgerArchiveConcurrentReads(t *testing.T) {
+	archive, _ := OpenLedgerArchive(t.TempDir(), time.Nanosecond, 0)
+	ledger := []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, 5), ledgerEntry(2, 1, 20)}
+	archive.Archive(bytes.NewReader(encodeLedger(ledger)), 1, [32]byte{}, 25)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, richest, err := archive.Richest(uint64(1 + j%3)); err != nil || richest[0].Balance != 20 {
+					t.Error("richest", err)
+					return
+				}
+				if _, _, ok, err := archive.Balance(uint64(1+j%3), []byte{2}); err != nil || !ok {
+					t.Error("balance", err)
+					return
+				}
+			}
+		}(i)
+	}
+	for bnum := uint64(2); bnum <= 3; bnum++ {
+		archive.Archive(bytes.NewReader(encodeLedger(ledger)), bnum, [32]byte{}, 25)
+	}
+	wg.Wait()
+}
+
+func TestArchivedBalance(t *testing.T) {
+	node, _, _ := newTestServer(t, 20)
+	archive, err := OpenLedgerArchive(t.TempDir(), time.Nanosecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	LEDGER_ARCHIVE = archive
+	t.Cleanup(func() { LEDGER_ARCHIVE = nil })
+	Globals.LatestBlockNum = 20
+
+	// Archived at the block the ledger was written after, not at the tip
+	withLedger(t, node, 10, []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, 100)})
+	stime := binary.LittleEndian.Uint32(node.blocks[15].Trailer.Stime[:])
+	ledger := writeLedger(t, []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, 300)}, time.Unix(int64(stime), 0))
+	os.Rename(ledger, Globals.LedgerPath)
+	if err := RefreshLedgerCache(); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots := archive.Snapshots(); len(snapshots) != 2 || snapshots[0].Block != 10 || snapshots[1].Block != 15 {
+		t.Fatalf("snapshots %+v", snapshots)
+	}
+
+	handler := NewServer(node).Router()
+	var response AccountBalanceResponse
+	code := post(t, handler, "/account/balance", map[string]interface{}{
+		"account_identifier": map[string]string{"address": "0x" + BytesToHex(ledgerTag(1))},
+		"block_identifier":   map[string]int{"index": 12},
+	}, &response)
+	if code != 0 || response.BlockIdentifier.Index != 10 || response.Balances[0].Value != "100" || response.Metadata["source"] != "ledger_archive" {
+		t.Fatalf("balance at block 12: error %d, %+v", code, response)
+	}
+}
+
+// ledgerTag is the tag of the ledgerEntry addresses of tag
+func ledgerTag(tag byte) []byte {
+	return bytes.Repeat([]byte{tag}, go_mcminterface.TXTAGLEN)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// LookupLedgerBalance finds an address in the cached ledger. address is
+// either a full WOTS address or a tag, which is the start of the address.
+// ok is false if the address is not in the ledger, available is false if no
+// ledger is cached or its snapshot cannot be read.
+func LookupLedgerBalance(address []byte) (entry go_mcminterface.LedgerEntry, ok bool, available bool) {
+	cache := GlobalLedgerCache.Load()
+	if cache == nil {
+		return entry, false, false
+	}
+	entry, ok, err := cache.snapshot.search(address)
+	if err != nil {
+		mlog(3, "§bLookupLedgerBalance(): §4Error reading the ledger snapshot: §c%s", err)
+		return entry, false, false
+	}
+	return entry, ok, true
+}
+
+// searchLedger finds an address or tag in address sorted entries
+func searchLedger(entries []go_mcminterface.LedgerEntry, address []byte) (go_mcminterface.LedgerEntry, bool) {
+	i, ok := searchLedgerIndex(entries, address)
+	if !ok {
+		return go_mcminterface.LedgerEntry{}, false
+	}
+	return entries[i], true
+}
+
+// searchLedgerIndex returns the position of an address or tag in address sorted entries
+func searchLedgerIndex(entries []go_mcminterface.LedgerEntry, address []byte) (int, bool) {
+	if len(address) == 0 || len(address) > go_mcminterface.TXADDRLEN {
+		return 0, false
+	}
+	i := sort.Search(len(entries), func(i int) bool {
+		return bytes.Compare(entries[i].Address[:len(address)], address) >= 0
+	})
+	return i, i < len(entries) && bytes.Equal(entries[i].Address[:len(address)], address)
+}
+
+// LEDGER_TRAILER_SCAN_DEPTH is how many recent trailers are searched for
+// the block of the ledger file
+var LEDGER_TRAILER_SCAN_DEPTH int64 = 4096
+
+// ledgerSnapshotBlock returns the block the ledger file holds the balances
+// of. The node rewrites ledger.dat when it accepts a block, so that is the
+// last block of the tfile solved before the ledger was written.
+func ledgerSnapshotBlock(written time.Time, tfile_path string) (uint64, [32]byte, error) {
+	tfile, err := os.Open(tfile_path)
+	if err != nil {
+		return 0, [32]byte{}, err
+	}
+	defer tfile.Close()
+	fi, err := tfile.Stat()
+	if err != nil {
+		return 0, [32]byte{}, err
+	}
+
+	// A trailer being appended is left out
+	end := fi.Size() - fi.Size()%BTRAILER_SIZE
+	start := end - LEDGER_TRAILER_SCAN_DEPTH*BTRAILER_SIZE
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, end-start)
+	if _, err := tfile.ReadAt(buf, start); err != nil {
+		return 0, [32]byte{}, err
+	}
+	for pos := len(buf) - BTRAILER_SIZE; pos >= 0; pos -= BTRAILER_SIZE {
+		// Stime and Bhash are the last fields of the 160 bytes trailer
+		if int64(binary.LittleEndian.Uint32(buf[pos+124:pos+128])) <= written.Unix() {
+			var bhash [32]byte
+			copy(bhash[:], buf[pos+128:pos+160])
+			return binary.LittleEndian.Uint64(buf[pos+32 : pos+40]), bhash, nil
+		}
+	}
+	return 0, [32]byte{}, fmt.Errorf("no block of the last %d in the tfile was solved before the ledger was written at %s", len(buf)/BTRAILER_SIZE, written.Format(time.RFC3339))
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Constants for ledger diffing
+var LEDGER_CHANGES_HISTORY int = 96 // diffs kept, a day at the default refresh interval
+var LEDGER_CHANGES_TOP int = 10     // accounts kept in every top list of a diff
+
+// LedgerBalanceChange is the balance of a tag in two consecutive ledgers
+type LedgerBalanceChange struct {
+	AccountIdentifier AccountIdentifier `json:"account_identifier"`
+	PreviousBalance   Amount            `json:"previous_balance"`
+	CurrentBalance    Amount            `json:"current_balance"`
+	Delta             string            `json:"delta"` // signed, in nanoMCM
+
+	delta int64 // for ranking, clamped to ±math.MaxInt64
+}
+
+// LedgerDiff is what changed between two ledger refreshes
+type LedgerDiff struct {
+	FromBlock        BlockIdentifier       `json:"from_block"`
+	ToBlock          BlockIdentifier       `json:"to_block"`
+	FromTime         string                `json:"from_time"`
+	ToTime           string                `json:"to_time"`
+	NewAccounts      uint64                `json:"new_accounts"`
+	EmptiedAccounts  uint64                `json:"emptied_accounts"`
+	ChangedAccounts  uint64                `json:"changed_accounts"`
+	SupplyDelta      string                `json:"supply_delta"` // signed, in nanoMCM
+	LargestNew       []LedgerBalanceChange `json:"largest_new"`
+	LargestEmptied   []LedgerBalanceChange `json:"largest_emptied"`
+	LargestIncreases []LedgerBalanceChange `json:"largest_increases"`
+	LargestDecreases []LedgerBalanceChange `json:"largest_decreases"`
+}
+
+// ledgerChanges is the rolling history of diffs, oldest first
+var ledgerChanges = struct {
+	diffs []*LedgerDiff
+	mu    sync.RWMutex
+}{}
+
+// clampedDelta is after - before, clamped to ±math.MaxInt64 so that the
+// delta and its absolute value both fit in an int64
+func clampedDelta(before, after uint64) int64 {
+	if after >= before {
+		if d := after - before; d <= math.MaxInt64 {
+			return int64(d)
+		}
+		return math.MaxInt64
+	}
+	if d := before - after; d <= math.MaxInt64 {
+		return -int64(d)
+	}
+	return -math.MaxInt64
+}
+
+// formatDelta formats after - before exactly, with a sign when negative
+func formatDelta(before, after uint64) string {
+	if after >= before {
+		return strconv.FormatUint(after-before, 10)
+	}
+	return "-" + strconv.FormatUint(before-after, 10)
+}
+
+// keepLargest inserts change in list, sorted by decreasing size, keeping at
+// most LEDGER_CHANGES_TOP entries
+func keepLargest(list []LedgerBalanceChange, change LedgerBalanceChange, size int64) []LedgerBalanceChange {
+	abs := func(c LedgerBalanceChange) int64 {
+		if c.delta < 0 {
+			return -c.delta
+		}
+		return c.delta
+	}
+	if len(list) >= LEDGER_CHANGES_TOP && abs(list[len(list)-1]) >= size {
+		return list
+	}
+	i := len(list)
+	for i > 0 && abs(list[i-1]) < size {
+		i--
+	}
+	list = append(list, LedgerBalanceChange{})
+	copy(list[i+1:], list[i:])
+	list[i] = change
+	if len(list) > LEDGER_CHANGES_TOP {
+		list = list[:LEDGER_CHANGES_TOP]
+	}
+	return list
+}
+
+// diffLedgers compares two ledger streams sorted by address, tag by tag,
+// holding one entry of each at a time. Tags are compared rather than full
+// addresses because a tag moves to a new WOTS address at every spend.
+func diffLedgers(previousLedger, currentLedger io.Reader) (*LedgerDiff, error) {
+	diff := &LedgerDiff{
+		LargestNew:       []LedgerBalanceChange{},
+		LargestEmptied:   []LedgerBalanceChange{},
+		LargestIncreases: []LedgerBalanceChange{},
+		LargestDecreases: []LedgerBalanceChange{},
+	}
+	// Balances are uint64, so the net change of the supply may not fit in an int64
+	var supplyDelta, balance big.Int
+
+	record := func(tag []byte, before, after uint64) {
+		if before == after {
+			return
+		}
+		change := LedgerBalanceChange{
+			AccountIdentifier: labeledAccount(tag),
+			PreviousBalance:   Amount{Value: fmt.Sprintf("%d", before), Currency: MCMCurrency},
+			CurrentBalance:    Amount{Value: fmt.Sprintf("%d", after), Currency: MCMCurrency},
+			Delta:             formatDelta(before, after),
+			delta:             clampedDelta(before, after),
+		}
+		supplyDelta.Add(&supplyDelta, balance.SetUint64(after))
+		supplyDelta.Sub(&supplyDelta, balance.SetUint64(before))
+
+		switch {
+		case before == 0:
+			diff.NewAccounts++
+			diff.LargestNew = keepLargest(diff.LargestNew, change, change.delta)
+		case after == 0:
+			diff.EmptiedAccounts++
+			diff.LargestEmptied = keepLargest(diff.LargestEmptied, change, -change.delta)
+		default:
+			diff.ChangedAccounts++
+		}
+		if change.delta > 0 {
+			diff.LargestIncreases = keepLargest(diff.LargestIncreases, change, change.delta)
+		} else {
+			diff.LargestDecreases = keepLargest(diff.LargestDecreases, change, -change.delta)
+		}
+	}
+
+	// Merge walk of the two address sorted ledgers
+	previous, current := newLedgerStream(previousLedger), newLedgerStream(currentLedger)
+	for !previous.done || !current.done {
+		var cmp int
+		switch {
+		case previous.done:
+			cmp = 1
+		case current.done:
+			cmp = -1
+		default:
+			cmp = bytes.Compare(previous.entry.Address[:go_mcminterface.TXTAGLEN], current.entry.Address[:go_mcminterface.TXTAGLEN])
+		}
+		switch {
+		case cmp < 0:
+			record(previous.entry.Address[:go_mcminterface.TXTAGLEN], previous.entry.Balance, 0)
+			previous.next()
+		case cmp > 0:
+			record(current.entry.Address[:go_mcminterface.TXTAGLEN], 0, current.entry.Balance)
+			current.next()
+		default:
+			record(current.entry.Address[:go_mcminterface.TXTAGLEN], previous.entry.Balance, current.entry.Balance)
+			previous.next()
+			current.next()
+		}
+	}
+	if previous.err != nil {
+		return nil, previous.err
+	}
+	if current.err != nil {
+		return nil, current.err
+	}
+
+	diff.SupplyDelta = supplyDelta.String()
+	return diff, nil
+}
+
+// recordLedgerDiff adds a diff to the rolling history
+func recordLedgerDiff(diff *LedgerDiff) {
+	ledgerChanges.mu.Lock()
+	defer ledgerChanges.mu.Unlock()
+
+	ledgerChanges.diffs = append(ledgerChanges.diffs, diff)
+	if len(ledgerChanges.diffs) > LEDGER_CHANGES_HISTORY {
+		ledgerChanges.diffs = ledgerChanges.diffs[len(ledgerChanges.diffs)-LEDGER_CHANGES_HISTORY:]
+	}
+}
+
+// LedgerChangesRequest is the request structure for the /stats/ledger/changes endpoint
+type LedgerChangesRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	Limit             *int64            `json:"limit,omitempty"`
+}
+
+// LedgerChangesResponse is the response structure for the /stats/ledger/changes endpoint
+type LedgerChangesResponse struct {
+	Changes []*LedgerDiff `json:"changes"` // newest first
+}
+
+// ledgerChangesHandler handles the /stats/ledger/changes endpoint
+func ledgerChangesHandler(w http.ResponseWriter, r *http.Request) {
+	var req LedgerChangesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bledgerChangesHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bledgerChangesHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	var limit int64 = 10
+	if req.Limit != nil && *req.Limit > 0 && *req.Limit <= int64(LEDGER_CHANGES_HISTORY) {
+		limit = *req.Limit
+	}
+
+	ledgerChanges.mu.RLock()
+	response := LedgerChangesResponse{Changes: []*LedgerDiff{}}
+	for i := len(ledgerChanges.diffs) - 1; i >= 0 && int64(len(response.Changes)) < limit; i-- {
+		response.Changes = append(response.Changes, ledgerChanges.diffs[i])
+	}
+	ledgerChanges.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// diffWithCachedLedger compares a freshly loaded ledger with the cached one
+// and records the diff, if there is a cached ledger and anything changed
+func diffWithCachedLedger(cache *LedgerCache) {
+	previous := GlobalLedgerCache.Load()
+	if previous == nil {
+		return
+	}
+
+	// Published caches are never modified, their snapshots are streamed
+	diff, err := diffLedgers(previous.snapshot.reader(), cache.snapshot.reader())
+	if err != nil {
+		mlog(3, "§bdiffWithCachedLedger(): §4Error comparing ledgers: §c%s", err)
+		return
+	}
+	if diff.NewAccounts+diff.EmptiedAccounts+diff.ChangedAccounts == 0 {
+		return
+	}
+	diff.FromBlock = BlockIdentifier{Index: int(previous.LastBlockNumber), Hash: "0x" + BytesToHex(previous.LastBlockHash[:])}
+	diff.ToBlock = BlockIdentifier{Index: int(cache.LastBlockNumber), Hash: "0x" + BytesToHex(cache.LastBlockHash[:])}
+	diff.FromTime = previous.LastUpdated.Format(time.RFC3339)
+	diff.ToTime = cache.LastUpdated.Format(time.RFC3339)
+	recordLedgerDiff(diff)
+
+	mlog(3, "§bdiffWithCachedLedger(): §7Ledger changed from block §e%d§7 to §e%d§7: §e%d§7 new, §e%d§7 emptied, §e%d§7 changed",
+		previous.LastBlockNumber, cache.LastBlockNumber, diff.NewAccounts, diff.EmptiedAccounts, diff.ChangedAccounts)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// withoutLedgerChanges empties the diff history for the test
+func withoutLedgerChanges(t *testing.T) {
+	ledgerChanges.mu.Lock()
+	diffs := ledgerChanges.diffs
+	ledgerChanges.diffs = nil
+	ledgerChanges.mu.Unlock()
+	t.Cleanup(func() {
+		ledgerChanges.mu.Lock()
+		ledgerChanges.diffs = diffs
+		ledgerChanges.mu.Unlock()
+	})
+}
+
+func TestDiffLedgers(t *testing.T) {
+	previous := []go_mcminterface.LedgerEntry{
+		ledgerEntry(1, 1, 100), // emptied
+		ledgerEntry(2, 1, 500), // spent to a new address, same balance
+		ledgerEntry(3, 1, 300), // decreased
+		ledgerEntry(4, 1, 50),  // increased
+	}
+	current := []go_mcminterface.LedgerEntry{
+		ledgerEntry(2, 2, 500),
+		ledgerEntry(3, 1, 120),
+		ledgerEntry(4, 1, 950),
+		ledgerEntry(5, 1, 70), // new
+	}
+	diff, err := diffLedgers(bytes.NewReader(encodeLedger(previous)), bytes.NewReader(encodeLedger(current)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.NewAccounts != 1 || diff.EmptiedAccounts != 1 || diff.ChangedAccounts != 2 {
+		t.Fatalf("%d new, %d emptied, %d changed, want 1, 1 and 2", diff.NewAccounts, diff.EmptiedAccounts, diff.ChangedAccounts)
+	}
+	if diff.SupplyDelta != fmt.Sprint(int64(-100-180+900+70)) {
+		t.Fatalf("supply delta %s", diff.SupplyDelta)
+	}
+	tag := func(b byte) string {
+		entry := ledgerEntry(b, 0, 0)
+		return labeledAccount(entry.Address[:]).Address
+	}
+	if len(diff.LargestNew) != 1 || diff.LargestNew[0].AccountIdentifier.Address != tag(5) || diff.LargestNew[0].Delta != "70" {
+		t.Fatalf("largest new %+v", diff.LargestNew)
+	}
+	if len(diff.LargestEmptied) != 1 || diff.LargestEmptied[0].PreviousBalance.Value != "100" || diff.LargestEmptied[0].CurrentBalance.Value != "0" {
+		t.Fatalf("largest emptied %+v", diff.LargestEmptied)
+	}
+	// Largest first, by absolute delta
+	if len(diff.LargestIncreases) != 2 || diff.LargestIncreases[0].AccountIdentifier.Address != tag(4) || diff.LargestIncreases[1].Delta != "70" {
+		t.Fatalf("largest increases %+v", diff.LargestIncreases)
+	}
+	if len(diff.LargestDecreases) != 2 || diff.LargestDecreases[0].Delta != "-180" || diff.LargestDecreases[1].Delta != "-100" {
+		t.Fatalf("largest decreases %+v", diff.LargestDecreases)
+	}
+}
+
+func TestDiffLedgersOverflow(t *testing.T) {
+	const max = math.MaxUint64
+	previous := []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, max), ledgerEntry(2, 1, 1)}
+	current := []go_mcminterface.LedgerEntry{ledgerEntry(2, 1, max), ledgerEntry(3, 1, max)}
+	diff, err := diffLedgers(bytes.NewReader(encodeLedger(previous)), bytes.NewReader(encodeLedger(current)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// -max + (max-1) + max
+	if diff.SupplyDelta != "18446744073709551614" {
+		t.Fatalf("supply delta %s, want 18446744073709551614", diff.SupplyDelta)
+	}
+	if len(diff.LargestEmptied) != 1 || diff.LargestEmptied[0].Delta != "-18446744073709551615" || diff.LargestEmptied[0].delta != -math.MaxInt64 {
+		t.Fatalf("largest emptied %+v", diff.LargestEmptied)
+	}
+	// Both increases are clamped for ranking, but reported exactly
+	increases := diff.LargestIncreases
+	if len(increases) != 2 || increases[0].delta != math.MaxInt64 || increases[1].delta != math.MaxInt64 ||
+		increases[0].Delta != "18446744073709551614" || increases[1].Delta != "18446744073709551615" {
+		t.Fatalf("largest increases %+v", increases)
+	}
+}
+
+func TestKeepLargest(t *testing.T) {
+	top := LEDGER_CHANGES_TOP
+	LEDGER_CHANGES_TOP = 3
+	t.Cleanup(func() { LEDGER_CHANGES_TOP = top })
+
+	var list []LedgerBalanceChange
+	for _, delta := range []int64{5, -40, 10, 1, -20, 30} {
+		abs := delta
+		if abs < 0 {
+			abs = -abs
+		}
+		list = keepLargest(list, LedgerBalanceChange{delta: delta}, abs)
+	}
+	if got := fmt.Sprint(list[0].delta, list[1].delta, list[2].delta); len(list) != 3 || got != "-40 30 -20" {
+		t.Fatalf("kept %v, want -40 30 -20", list)
+	}
+}
+
+func TestLedgerChangesHandler(t *testing.T) {
+	withoutLedgerChanges(t)
+	history := LEDGER_CHANGES_HISTORY
+	LEDGER_CHANGES_HISTORY = 2
+	t.Cleanup(func() { LEDGER_CHANGES_HISTORY = history })
+
+	node, _, _ := newTestServer(t, 10)
+	withLedger(t, node, 5, []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, 100)})
+	handler := NewServer(node).Router()
+
+	// A refresh with the same ledger records nothing
+	if err := RefreshLedgerCache(); err != nil {
+		t.Fatal(err)
+	}
+	for i, bnum := range []int{6, 7, 8} {
+		stime := binary.LittleEndian.Uint32(node.blocks[bnum].Trailer.Stime[:])
+		ledger := writeLedger(t, []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, uint64(200+i))}, time.Unix(int64(stime), 0))
+		if err := os.Rename(ledger, Globals.LedgerPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := RefreshLedgerCache(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var response LedgerChangesResponse
+	if code := post(t, handler, "/stats/ledger/changes", map[string]interface{}{}, &response); code != 0 {
+		t.Fatalf("/stats/ledger/changes: error %d", code)
+	}
+	// The oldest diff fell out of the history, newest first
+	if len(response.Changes) != 2 || response.Changes[0].FromBlock.Index != 7 || response.Changes[0].ToBlock.Index != 8 || response.Changes[1].ToBlock.Index != 7 {
+		t.Fatalf("changes %+v", response.Changes)
+	}
+	if response.Changes[0].ChangedAccounts != 1 || response.Changes[0].SupplyDelta != "1" {
+		t.Fatalf("last diff %+v", response.Changes[0])
+	}
+
+	limit := int64(1)
+	if code := post(t, handler, "/stats/ledger/changes", map[string]interface{}{"limit": limit}, &response); code != 0 || len(response.Changes) != 1 || response.Changes[0].ToBlock.Index != 8 {
+		t.Fatalf("/stats/ledger/changes with limit 1: error %d, %d changes", code, len(response.Changes))
+	}
+}
@@ -0,0 +1,716 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// LEDGER_TOP_K is how many of the richest and of the poorest entries are
+// kept in memory, the rest of the ledger is only read from its snapshot
+var LEDGER_TOP_K int = 10000
+
+// LEDGER_SNAPSHOT_DIR is the folder of the ledger snapshots the cache reads
+// addresses and deep richlist pages from (empty for the system temporary folder)
+var LEDGER_SNAPSHOT_DIR = ""
+
+// ledgerRecordSize is the size of a ledger.dat entry: TXADDRLEN bytes of
+// address and 8 bytes of little endian balance
+const ledgerRecordSize = go_mcminterface.TXADDRLEN + 8
+
+// ledgerStream reads a ledger stream one entry at a time
+type ledgerStream struct {
+	r      io.Reader
+	record []byte
+	entry  go_mcminterface.LedgerEntry
+	done   bool
+	err    error
+}
+
+func newLedgerStream(r io.Reader) *ledgerStream {
+	s := &ledgerStream{r: r, record: make([]byte, ledgerRecordSize)}
+	s.next()
+	return s
+}
+
+// next reads the next entry, or sets done at the end of the stream
+func (s *ledgerStream) next() {
+	if _, err := io.ReadFull(s.r, s.record); err != nil {
+		if err != io.EOF {
+			s.err = fmt.Errorf("truncated ledger entry: %w", err)
+		}
+		s.done = true
+		return
+	}
+	s.entry = decodeLedgerEntry(s.record)
+}
+
+// readLedgerEntries calls fn for every entry of a ledger stream
+func readLedgerEntries(r io.Reader, fn func(entry go_mcminterface.LedgerEntry)) error {
+	s := newLedgerStream(r)
+	for ; !s.done; s.next() {
+		fn(s.entry)
+	}
+	return s.err
+}
+
+// decodeLedgerEntry decodes a ledger.dat record
+func decodeLedgerEntry(record []byte) go_mcminterface.LedgerEntry {
+	var entry go_mcminterface.LedgerEntry
+	copy(entry.Address[:], record[:go_mcminterface.TXADDRLEN])
+	entry.Balance = binary.LittleEndian.Uint64(record[go_mcminterface.TXADDRLEN:])
+	return entry
+}
+
+// rankedBefore tells whether a is ranked before b: the highest balance
+// first, equal balances in address order
+func rankedBefore(a, b go_mcminterface.LedgerEntry) bool {
+	return a.Balance > b.Balance || a.Balance == b.Balance && bytes.Compare(a.Address[:], b.Address[:]) < 0
+}
+
+// rankedLedger is a ledger in balance order, highest first, equal
+// balances in address order
+type rankedLedger interface {
+	Len() int
+	At(i int) go_mcminterface.LedgerEntry
+}
+
+// rankedEntries is a rankedLedger of the entries themselves
+type rankedEntries []go_mcminterface.LedgerEntry
+
+func (r rankedEntries) Len() int                             { return len(r) }
+func (r rankedEntries) At(i int) go_mcminterface.LedgerEntry { return r[i] }
+
+// rankedPosition finds an entry in a ranked ledger
+func rankedPosition(ledger rankedLedger, entry go_mcminterface.LedgerEntry) (int, bool) {
+	i := sort.Search(ledger.Len(), func(i int) bool {
+		return !rankedBefore(ledger.At(i), entry)
+	})
+	return i, i < ledger.Len() && ledger.At(i).Address == entry.Address
+}
+
+// withoutEntries is a ranked ledger with some of its entries left out
+type withoutEntries struct {
+	ledger rankedLedger
+	skip   []int // positions of the left out entries, ascending
+}
+
+// excludeEntries returns ledger without the removed entries, which are
+// skipped without copying the ledger
+func excludeEntries(ledger rankedLedger, removed []go_mcminterface.LedgerEntry) rankedLedger {
+	w := withoutEntries{ledger: ledger}
+	for _, entry := range removed {
+		if i, ok := rankedPosition(ledger, entry); ok {
+			w.skip = append(w.skip, i)
+		}
+	}
+	if len(w.skip) == 0 {
+		return ledger
+	}
+	sort.Ints(w.skip)
+	return w
+}
+
+func (w withoutEntries) Len() int { return w.ledger.Len() - len(w.skip) }
+
+func (w withoutEntries) At(i int) go_mcminterface.LedgerEntry {
+	// skip[s]-s entries are kept before the s-th left out entry
+	return w.ledger.At(i + sort.Search(len(w.skip), func(s int) bool { return w.skip[s]-s > i }))
+}
+
+// ledgerHeap keeps the K entries that less puts last, with the first of
+// them at the root so that it can be replaced
+type ledgerHeap struct {
+	entries []go_mcminterface.LedgerEntry
+	less    func(a, b go_mcminterface.LedgerEntry) bool
+}
+
+func (h *ledgerHeap) Len() int           { return len(h.entries) }
+func (h *ledgerHeap) Less(i, j int) bool { return h.less(h.entries[i], h.entries[j]) }
+func (h *ledgerHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *ledgerHeap) Push(x any)         { h.entries = append(h.entries, x.(go_mcminterface.LedgerEntry)) }
+func (h *ledgerHeap) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
+
+// offer adds entry if there are less than k entries or it beats the root
+func (h *ledgerHeap) offer(entry go_mcminterface.LedgerEntry, k int) {
+	if len(h.entries) < k {
+		heap.Push(h, entry)
+	} else if k > 0 && h.less(h.entries[0], entry) {
+		h.entries[0] = entry
+		heap.Fix(h, 0)
+	}
+}
+
+// sorted returns the kept entries in ranked order
+func (h *ledgerHeap) sorted() []go_mcminterface.LedgerEntry {
+	sort.Slice(h.entries, func(i, j int) bool { return rankedBefore(h.entries[i], h.entries[j]) })
+	return h.entries
+}
+
+// richestHeap keeps the first entries in ranked order, poorestHeap the last
+func richestHeap() *ledgerHeap {
+	return &ledgerHeap{less: func(a, b go_mcminterface.LedgerEntry) bool { return rankedBefore(b, a) }}
+}
+
+func poorestHeap() *ledgerHeap {
+	return &ledgerHeap{less: rankedBefore}
+}
+
+// histogramSubBits splits every power of two of the balance histogram in
+// 64 buckets, so that a bucket spans less than 1/64 of its balances.
+// Balances below 64 have a bucket each.
+const histogramSubBits = 6
+const histogramBuckets = (65 - histogramSubBits) << histogramSubBits
+
+// balanceHistogram counts the entries and sums the balances per bucket
+type balanceHistogram struct {
+	counts [histogramBuckets]uint64
+	sums   [histogramBuckets]uint64
+}
+
+// histogramBucket returns the bucket of a balance
+func histogramBucket(balance uint64) int {
+	if balance < 1<<histogramSubBits {
+		return int(balance)
+	}
+	shift := bits.Len64(balance) - histogramSubBits - 1
+	return (shift+1)<<histogramSubBits + int(balance>>shift) - 1<<histogramSubBits
+}
+
+// histogramRange returns the lowest and highest balance of a bucket
+func histogramRange(b int) (uint64, uint64) {
+	if b < 1<<histogramSubBits {
+		return uint64(b), uint64(b)
+	}
+	shift := b>>histogramSubBits - 1
+	min := uint64(1<<histogramSubBits+b&(1<<histogramSubBits-1)) << shift
+	return min, min + (1<<shift - 1)
+}
+
+// ledgerTally is what the rank and the distribution of a ledger are
+// computed from. Entries can be taken out of it again, to leave them out.
+type ledgerTally struct {
+	histogram balanceHistogram
+	decades   [12]struct{ holders, balance uint64 } // powers of ten in MCM: [0, 1), [1, 10), ...
+	dust      uint64
+	count     uint64
+	supply    uint64
+}
+
+// balanceDecade returns the power of ten bucket of a balance
+func balanceDecade(balance uint64) int {
+	const nanoPerMCM = 1000000000
+	d := 0
+	for limit := uint64(nanoPerMCM); balance >= limit; limit *= 10 {
+		d++
+		if limit > math.MaxUint64/10 {
+			break
+		}
+	}
+	return d
+}
+
+// add counts an entry in the tally
+func (t *ledgerTally) add(balance uint64) {
+	b, d := histogramBucket(balance), balanceDecade(balance)
+	t.histogram.counts[b]++
+	t.histogram.sums[b] += balance
+	t.decades[d].holders++
+	t.decades[d].balance += balance
+	if balance < STATS_DUST_THRESHOLD {
+		t.dust++
+	}
+	t.count++
+	t.supply += balance
+}
+
+// remove takes an entry counted by add out of the tally
+func (t *ledgerTally) remove(balance uint64) {
+	b, d := histogramBucket(balance), balanceDecade(balance)
+	t.histogram.counts[b]--
+	t.histogram.sums[b] -= balance
+	t.decades[d].holders--
+	t.decades[d].balance -= balance
+	if balance < STATS_DUST_THRESHOLD {
+		t.dust--
+	}
+	t.count--
+	t.supply -= balance
+}
+
+// ledgerSnapshot is a private, address sorted copy of the ledger file the
+// cache was loaded from. ReadAt is safe for concurrent use, so requests
+// read it without locks.
+type ledgerSnapshot struct {
+	file    *os.File
+	entries int64
+}
+
+// entry reads the i-th entry of the snapshot
+func (s *ledgerSnapshot) entry(i int64) (go_mcminterface.LedgerEntry, error) {
+	record := make([]byte, ledgerRecordSize)
+	if _, err := s.file.ReadAt(record, i*ledgerRecordSize); err != nil {
+		return go_mcminterface.LedgerEntry{}, err
+	}
+	return decodeLedgerEntry(record), nil
+}
+
+// search finds an address or tag with a binary search of the snapshot
+func (s *ledgerSnapshot) search(address []byte) (go_mcminterface.LedgerEntry, bool, error) {
+	if len(address) == 0 || len(address) > go_mcminterface.TXADDRLEN {
+		return go_mcminterface.LedgerEntry{}, false, nil
+	}
+	var err error
+	i := sort.Search(int(s.entries), func(i int) bool {
+		entry, e := s.entry(int64(i))
+		if e != nil {
+			err = e
+			return true
+		}
+		return bytes.Compare(entry.Address[:len(address)], address) >= 0
+	})
+	if err != nil || int64(i) == s.entries {
+		return go_mcminterface.LedgerEntry{}, false, err
+	}
+	entry, err := s.entry(int64(i))
+	if err != nil || !bytes.Equal(entry.Address[:len(address)], address) {
+		return go_mcminterface.LedgerEntry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// reader streams the whole snapshot
+func (s *ledgerSnapshot) reader() io.Reader {
+	return bufio.NewReaderSize(io.NewSectionReader(s.file, 0, s.entries*ledgerRecordSize), 1024*ledgerRecordSize)
+}
+
+// scan calls fn for every entry of the snapshot, in address order
+func (s *ledgerSnapshot) scan(fn func(entry go_mcminterface.LedgerEntry)) error {
+	return readLedgerEntries(s.reader(), fn)
+}
+
+// remove deletes the snapshot, which can no longer be read
+func (s *ledgerSnapshot) remove() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// loadLedgerCache streams a ledger file in one pass. The entries are copied
+// to a snapshot file, and only the LEDGER_TOP_K richest and poorest entries
+// and a tally of the balances are kept in memory: what is held does not
+// grow with the ledger. The ledger file must be address sorted, as the node
+// writes it.
+func loadLedgerCache(path string) (*LedgerCache, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	copyFile, err := os.CreateTemp(LEDGER_SNAPSHOT_DIR, "ledger-*.dat")
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &ledgerSnapshot{file: copyFile}
+	out := bufio.NewWriterSize(copyFile, 1024*ledgerRecordSize)
+
+	ledger := &ledgerView{}
+	richest, poorest := richestHeap(), poorestHeap()
+	var last go_mcminterface.LedgerEntry
+	unsorted := false
+
+	err = readLedgerEntries(io.TeeReader(bufio.NewReaderSize(file, 1024*ledgerRecordSize), out), func(entry go_mcminterface.LedgerEntry) {
+		if snapshot.entries > 0 && bytes.Compare(last.Address[:], entry.Address[:]) >= 0 {
+			unsorted = true
+		}
+		last = entry
+		snapshot.entries++
+		ledger.tally.add(entry.Balance)
+		richest.offer(entry, LEDGER_TOP_K)
+		poorest.offer(entry, LEDGER_TOP_K)
+	})
+	if err == nil {
+		err = out.Flush()
+	}
+	if err == nil && unsorted {
+		err = fmt.Errorf("ledger file is not sorted by address")
+	}
+	if err != nil {
+		snapshot.remove()
+		return nil, err
+	}
+
+	ledger.richest = richest.sorted()
+	ledger.poorest = poorest.sorted()
+	// The poorest are kept lowest first
+	for i, j := 0, len(ledger.poorest)-1; i < j; i, j = i+1, j-1 {
+		ledger.poorest[i], ledger.poorest[j] = ledger.poorest[j], ledger.poorest[i]
+	}
+
+	cache := &LedgerCache{
+		snapshot:          snapshot,
+		ledger:            ledger,
+		Size:              ledger.tally.count,
+		CirculatingSupply: ledger.tally.supply,
+	}
+	ledger.cache = cache
+	return cache, nil
+}
+
+// ledgerView is the cached ledger, with the entries of the excluded tags
+// left out. Only the richest and poorest entries are in memory, the rest
+// is read from the snapshot of the cache.
+type ledgerView struct {
+	cache    *LedgerCache
+	excluded map[[go_mcminterface.TXTAGLEN]byte]bool
+	removed  []go_mcminterface.LedgerEntry // ledger entries of the excluded tags
+	richest  []go_mcminterface.LedgerEntry // highest first
+	poorest  []go_mcminterface.LedgerEntry // lowest first
+	tally    ledgerTally
+}
+
+// view returns the ledger without the entries of the excluded tags, which
+// are found in the snapshot
+func (c *LedgerCache) view(excluded map[[go_mcminterface.TXTAGLEN]byte]bool) (*ledgerView, error) {
+	if len(excluded) == 0 {
+		return c.ledger, nil
+	}
+	v := &ledgerView{cache: c, excluded: excluded, tally: c.ledger.tally}
+	for key := range excluded {
+		entry, ok, err := c.snapshot.search(key[:])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			v.removed = append(v.removed, entry)
+			v.tally.remove(entry.Balance)
+		}
+	}
+	// Leaving entries out keeps the others in order
+	for _, entry := range c.ledger.richest {
+		if !isExcluded(excluded, entry) {
+			v.richest = append(v.richest, entry)
+		}
+	}
+	for _, entry := range c.ledger.poorest {
+		if !isExcluded(excluded, entry) {
+			v.poorest = append(v.poorest, entry)
+		}
+	}
+	return v, nil
+}
+
+// ledgerViewsSize bounds the category combinations cached per ledger cache
+const ledgerViewsSize = 64
+
+// ledgerViews caches the views of a ledger cache without label categories,
+// by categories, until the labels change
+type ledgerViews struct {
+	views map[string]*excludedView
+	mu    sync.Mutex
+}
+
+// excludedView is the view without some label categories and its
+// distribution, each computed once on first use
+type excludedView struct {
+	version          uint64 // labelsVersion() the excluded tags were read at
+	categories       []string
+	viewOnce         sync.Once
+	view             *ledgerView
+	viewErr          error
+	distributionOnce sync.Once
+	distribution     *LedgerDistribution
+	distributionErr  error
+}
+
+// categoriesKey identifies a set of label categories, which match whatever
+// their case
+func categoriesKey(categories []string) string {
+	keys := make([]string, len(categories))
+	for i, category := range categories {
+		keys[i] = strings.ToLower(category)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\n")
+}
+
+// excludedView returns the cached entry of the categories, a new one when
+// the labels changed since it was cached
+func (c *LedgerCache) excludedView(categories []string) (string, *excludedView) {
+	key := categoriesKey(categories)
+	version := labelsVersion()
+
+	c.views.mu.Lock()
+	defer c.views.mu.Unlock()
+	cached := c.views.views[key]
+	if cached == nil || cached.version != version {
+		if c.views.views == nil || len(c.views.views) >= ledgerViewsSize {
+			c.views.views = make(map[string]*excludedView)
+		}
+		cached = &excludedView{version: version, categories: categories}
+		c.views.views[key] = cached
+	}
+	return key, cached
+}
+
+// forgetView drops a cached entry that failed, for the next request to try
+// again
+func (c *LedgerCache) forgetView(key string, cached *excludedView) {
+	c.views.mu.Lock()
+	defer c.views.mu.Unlock()
+	if c.views.views[key] == cached {
+		delete(c.views.views, key)
+	}
+}
+
+// withoutCategories returns the cached entry of the categories with its
+// view computed
+func (c *LedgerCache) withoutCategories(categories []string) (string, *excludedView, error) {
+	key, cached := c.excludedView(categories)
+	cached.viewOnce.Do(func() {
+		cached.view, cached.viewErr = c.view(excludedTags(cached.categories))
+	})
+	if cached.viewErr != nil {
+		c.forgetView(key, cached)
+	}
+	return key, cached, cached.viewErr
+}
+
+// viewWithout returns the ledger without the tags labelled with one of the
+// categories
+func (c *LedgerCache) viewWithout(categories []string) (*ledgerView, error) {
+	if len(categories) == 0 {
+		return c.ledger, nil
+	}
+	_, cached, err := c.withoutCategories(categories)
+	return cached.view, err
+}
+
+// distributionWithout returns the ledger and its distribution without the
+// tags labelled with one of the categories
+func (c *LedgerCache) distributionWithout(categories []string) (*ledgerView, *LedgerDistribution, error) {
+	if len(categories) == 0 {
+		return c.ledger, c.Distribution, nil
+	}
+	key, cached, err := c.withoutCategories(categories)
+	if err != nil || len(cached.view.removed) == 0 {
+		return cached.view, c.Distribution, err
+	}
+	cached.distributionOnce.Do(func() {
+		cached.distribution, cached.distributionErr = computeLedgerDistribution(cached.view)
+	})
+	if cached.distributionErr != nil {
+		c.forgetView(key, cached)
+	}
+	return cached.view, cached.distribution, cached.distributionErr
+}
+
+// Len is the number of entries of the view
+func (v *ledgerView) Len() int { return int(v.tally.count) }
+
+// scan calls fn for every entry of the snapshot left in the view
+func (v *ledgerView) scan(fn func(entry go_mcminterface.LedgerEntry)) error {
+	return v.cache.snapshot.scan(func(entry go_mcminterface.LedgerEntry) {
+		if !isExcluded(v.excluded, entry) {
+			fn(entry)
+		}
+	})
+}
+
+// page returns up to limit entries from offset, highest first, or lowest
+// first when ascending. Pages past the entries in memory are read from the
+// snapshot.
+func (v *ledgerView) page(offset int64, limit int64, ascending bool) ([]go_mcminterface.LedgerEntry, error) {
+	n := int64(v.Len())
+	if offset >= n || limit <= 0 {
+		return []go_mcminterface.LedgerEntry{}, nil
+	}
+	end := offset + limit
+	if end > n {
+		end = n
+	}
+
+	kept := v.richest
+	if ascending {
+		kept = v.poorest
+	}
+	if end <= int64(len(kept)) {
+		return kept[offset:end], nil
+	}
+
+	if !ascending {
+		return v.rankedRange(offset, end-offset)
+	}
+	// Ascending offsets count from the end of the ranking
+	page, err := v.rankedRange(n-end, end-offset)
+	for i, j := 0, len(page)-1; i < j; i, j = i+1, j-1 {
+		page[i], page[j] = page[j], page[i]
+	}
+	return page, err
+}
+
+// rankedRange reads count entries of the ranking from start, highest
+// first. The balance at start is selected first, then one pass collects
+// the entries from it, keeping no more than count of them.
+func (v *ledgerView) rankedRange(start int64, count int64) ([]go_mcminterface.LedgerEntry, error) {
+	balance, above, err := v.selectBalance(start)
+	if err != nil {
+		return nil, err
+	}
+	// Entries with the selected balance come in address order, as ranked
+	skip := start - int64(above)
+	page := make([]go_mcminterface.LedgerEntry, 0, count)
+	lower := richestHeap()
+	err = v.scan(func(entry go_mcminterface.LedgerEntry) {
+		switch {
+		case entry.Balance == balance && skip > 0:
+			skip--
+		case entry.Balance == balance && int64(len(page)) < count:
+			page = append(page, entry)
+		case entry.Balance < balance:
+			lower.offer(entry, int(count))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range lower.sorted() {
+		if int64(len(page)) == count {
+			break
+		}
+		page = append(page, entry)
+	}
+	return page, nil
+}
+
+// selectBalance finds the balance at position k of the ranking, and how
+// many entries have a higher balance. The bucket of k is found in the
+// histogram, then every pass over the snapshot splits the balances left
+// in 65536 ranges, until only one balance is left.
+func (v *ledgerView) selectBalance(k int64) (uint64, uint64, error) {
+	if k < 0 || k >= int64(v.Len()) {
+		return 0, 0, fmt.Errorf("position %d out of a ledger of %d entries", k, v.Len())
+	}
+	var above uint64
+	b := histogramBuckets - 1
+	for ; b > 0 && above+v.tally.histogram.counts[b] <= uint64(k); b-- {
+		above += v.tally.histogram.counts[b]
+	}
+	lo, hi := histogramRange(b)
+
+	for lo < hi {
+		width := (hi-lo)/65536 + 1
+		counts := make([]uint64, (hi-lo)/width+1)
+		err := v.scan(func(entry go_mcminterface.LedgerEntry) {
+			if entry.Balance >= lo && entry.Balance <= hi {
+				counts[(entry.Balance-lo)/width]++
+			}
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		j := len(counts) - 1
+		for ; j >= 0 && above+counts[j] <= uint64(k); j-- {
+			above += counts[j]
+		}
+		if j < 0 {
+			return 0, 0, fmt.Errorf("ledger snapshot does not match its tally")
+		}
+		lo += uint64(j) * width
+		if width-1 < hi-lo {
+			hi = lo + width - 1
+		}
+	}
+	return lo, above, nil
+}
+
+// rank counts the entries with a balance above and below balance. They
+// are counted exactly among the richest and poorest entries in memory,
+// and estimated from the histogram in between, assuming balances spread
+// evenly within a bucket.
+func (v *ledgerView) rank(balance uint64) (higher uint64, lower uint64, estimated bool) {
+	n := len(v.richest)
+	if n == v.Len() || n > 0 && balance >= v.richest[n-1].Balance {
+		higher = uint64(sort.Search(n, func(i int) bool { return v.richest[i].Balance <= balance }))
+	} else {
+		estimated = true
+		b := histogramBucket(balance)
+		for i := b + 1; i < histogramBuckets; i++ {
+			higher += v.tally.histogram.counts[i]
+		}
+		min, max := histogramRange(b)
+		higher += uint64(float64(v.tally.histogram.counts[b]) * float64(max-balance) / (float64(max-min) + 1))
+	}
+
+	n = len(v.poorest)
+	if n == v.Len() || n > 0 && balance <= v.poorest[n-1].Balance {
+		lower = uint64(sort.Search(n, func(i int) bool { return v.poorest[i].Balance >= balance }))
+	} else {
+		estimated = true
+		b := histogramBucket(balance)
+		for i := 0; i < b; i++ {
+			lower += v.tally.histogram.counts[i]
+		}
+		min, max := histogramRange(b)
+		lower += uint64(float64(v.tally.histogram.counts[b]) * float64(balance-min) / (float64(max-min) + 1))
+	}
+	return higher, lower, estimated
+}
+
+// topSum sums the balances of the n richest entries, reading those past
+// the richest in memory from the snapshot
+func (v *ledgerView) topSum(n int) (uint64, error) {
+	if n > v.Len() {
+		n = v.Len()
+	}
+	var sum uint64
+	for i := 0; i < n && i < len(v.richest); i++ {
+		sum += v.richest[i].Balance
+	}
+	if n > len(v.richest) {
+		rest, err := v.rankedRange(int64(len(v.richest)), int64(n-len(v.richest)))
+		if err != nil {
+			return 0, err
+		}
+		for _, entry := range rest {
+			sum += entry.Balance
+		}
+	}
+	return sum, nil
+}
+
+// gini estimates the Gini coefficient from the histogram, with the
+// balances in ascending order: G = 2*sum(i*x_i) / (n*sum(x)) - (n+1)/n.
+// Every entry of a bucket is given the mean position of the bucket, which
+// is exact for buckets of one entry or of equal balances.
+func (t *ledgerTally) gini() float64 {
+	if t.count == 0 || t.supply == 0 {
+		return 0
+	}
+	var weighted, position float64
+	for b := 0; b < histogramBuckets; b++ {
+		count := float64(t.histogram.counts[b])
+		if count == 0 {
+			continue
+		}
+		weighted += float64(t.histogram.sums[b]) * (position + (count+1)/2)
+		position += count
+	}
+	n := float64(t.count)
+	return math.Max(0, 2*weighted/(n*float64(t.supply))-(n+1)/n)
+}
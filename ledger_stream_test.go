@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// balancesOf lists the tags and balances of a ranked ledger
+func balancesOf(ledger rankedLedger) string {
+	list := ""
+	for i := 0; i < ledger.Len(); i++ {
+		entry := ledger.At(i)
+		list += fmt.Sprintf("%d:%d ", entry.Address[0], entry.Balance)
+	}
+	return list
+}
+
+// withTopK keeps k of the richest and poorest entries in memory, with the
+// ledger snapshots in a temporary folder
+func withTopK(t *testing.T, k int) {
+	top, dir := LEDGER_TOP_K, LEDGER_SNAPSHOT_DIR
+	LEDGER_TOP_K, LEDGER_SNAPSHOT_DIR = k, t.TempDir()
+	t.Cleanup(func() { LEDGER_TOP_K, LEDGER_SNAPSHOT_DIR = top, dir })
+}
+
+// loadEntries loads entries, address sorted, as a ledger cache
+func loadEntries(t *testing.T, entries []go_mcminterface.LedgerEntry) *LedgerCache {
+	t.Helper()
+	cache, err := loadLedgerCache(writeLedger(t, entries, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cache.snapshot.remove)
+	return cache
+}
+
+func TestLoadLedgerCache(t *testing.T) {
+	withTopK(t, 2)
+	// Equal balances
+	entries := []go_mcminterface.LedgerEntry{
+		ledgerEntry(1, 1, 500), ledgerEntry(2, 1, 300), ledgerEntry(3, 1, 300), ledgerEntry(4, 1, 100), ledgerEntry(5, 1, 100),
+	}
+	cache := loadEntries(t, entries)
+	if cache.Size != 5 || cache.CirculatingSupply != 1300 {
+		t.Fatalf("%d entries holding %d, want 5 holding 1300", cache.Size, cache.CirculatingSupply)
+	}
+	// Only K entries of each end are in memory
+	if richest := balancesOf(rankedEntries(cache.ledger.richest)); richest != "1:500 2:300 " {
+		t.Fatalf("richest %s, want the highest first and equal balances in address order", richest)
+	}
+	if poorest := balancesOf(rankedEntries(cache.ledger.poorest)); poorest != "5:100 4:100 " {
+		t.Fatalf("poorest %s, want the lowest first", poorest)
+	}
+
+	// The rest is read from the snapshot, by tag or address
+	if entry, ok, err := cache.snapshot.search(ledgerTag(3)); err != nil || !ok || entry.Balance != 300 {
+		t.Fatalf("tag 3 in the snapshot: %+v, %v, %v", entry, ok, err)
+	}
+	if entry, ok, err := cache.snapshot.search(entries[4].Address[:]); err != nil || !ok || entry.Balance != 100 {
+		t.Fatalf("address of tag 5 in the snapshot: %+v, %v, %v", entry, ok, err)
+	}
+	if _, ok, err := cache.snapshot.search(ledgerTag(6)); err != nil || ok {
+		t.Fatalf("tag 6 found in the snapshot: %v", err)
+	}
+
+	// A ledger out of address order or with a partial entry is an error,
+	// and leaves no snapshot behind
+	entries[0], entries[1] = entries[1], entries[0]
+	if _, err := loadLedgerCache(writeLedger(t, entries, time.Now())); err == nil {
+		t.Fatal("ledger out of address order loaded")
+	}
+	data := encodeLedger(entries[1:])
+	path := writeLedger(t, nil, time.Now())
+	os.WriteFile(path, data[:len(data)-3], 0644)
+	if _, err := loadLedgerCache(path); err == nil {
+		t.Fatal("truncated ledger loaded")
+	}
+	if left, _ := os.ReadDir(LEDGER_SNAPSHOT_DIR); len(left) != 1 {
+		t.Fatalf("%d snapshots left, want the one of the cache", len(left))
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	previous := -1
+	for _, balance := range []uint64{0, 1, 63, 64, 65, 127, 128, 130, 1e9, 1e9 + 1, 55e9, math.MaxUint64 / 3, math.MaxUint64} {
+		b := histogramBucket(balance)
+		min, max := histogramRange(b)
+		if b < previous || b >= histogramBuckets || balance < min || balance > max {
+			t.Fatalf("balance %d in bucket %d of [%d, %d]", balance, b, min, max)
+		}
+		// Buckets span less than 1/64 of their balances
+		if balance >= 64 && (max-min)/64 > min/4096 {
+			t.Fatalf("bucket %d of [%d, %d] is too wide", b, min, max)
+		}
+		previous = b
+	}
+	// Consecutive buckets are contiguous
+	for b := 1; b < histogramBuckets; b++ {
+		_, max := histogramRange(b - 1)
+		if min, _ := histogramRange(b); min != max+1 {
+			t.Fatalf("bucket %d starts at %d, after %d", b, min, max)
+		}
+	}
+	if _, max := histogramRange(histogramBuckets - 1); max != math.MaxUint64 {
+		t.Fatalf("last bucket ends at %d", max)
+	}
+}
+
+func TestRankedRange(t *testing.T) {
+	withTopK(t, 1)
+	// Ties, and balances far apart in the same histogram bucket
+	balances := []uint64{7e9, 3e9, 5e9, 5e9, 3e9 + 1, 5e9, 1, 0, 5e9, 3e9}
+	var entries []go_mcminterface.LedgerEntry
+	for i, balance := range balances {
+		entries = append(entries, ledgerEntry(byte(i+1), 1, balance))
+	}
+	cache := loadEntries(t, entries)
+	want := rankedEntries(append([]go_mcminterface.LedgerEntry{}, entries...))
+	sort.Slice(want, func(i, j int) bool { return rankedBefore(want[i], want[j]) })
+
+	for start := 0; start < len(want); start++ {
+		for count := 1; start+count <= len(want); count++ {
+			page, err := cache.ledger.rankedRange(int64(start), int64(count))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, expected := balancesOf(rankedEntries(page)), balancesOf(want[start:start+count]); got != expected {
+				t.Fatalf("ranked range from %d of %d: %s, want %s", start, count, got, expected)
+			}
+		}
+	}
+
+	// Leaving entries out, offsets count the entries left
+	withLabels(t, "")
+	ledger, err := cache.view(map[[go_mcminterface.TXTAGLEN]byte]bool{[go_mcminterface.TXTAGLEN]byte(ledgerTag(4)): true, [go_mcminterface.TXTAGLEN]byte(ledgerTag(1)): true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := ledger.page(0, 4, false)
+	if err != nil || balancesOf(rankedEntries(page)) != "3:5000000000 6:5000000000 9:5000000000 5:3000000001 " {
+		t.Fatalf("first page without tags 1 and 4: %s, %v", balancesOf(rankedEntries(page)), err)
+	}
+	page, err = ledger.page(1, 3, true)
+	if err != nil || balancesOf(rankedEntries(page)) != "7:1 10:3000000000 2:3000000000 " {
+		t.Fatalf("second poorest page without tags 1 and 4: %s, %v", balancesOf(rankedEntries(page)), err)
+	}
+	if ledger.Len() != 8 || ledger.tally.supply != cache.CirculatingSupply-7e9-5e9 {
+		t.Fatalf("%d entries holding %d left", ledger.Len(), ledger.tally.supply)
+	}
+}
+
+func TestLedgerViewRank(t *testing.T) {
+	withTopK(t, 2)
+	var entries []go_mcminterface.LedgerEntry
+	for tag := byte(1); tag <= 100; tag++ {
+		entries = append(entries, ledgerEntry(tag, 1, uint64(tag)*1e9))
+	}
+	cache := loadEntries(t, entries)
+
+	// Exact at both ends, estimated from the histogram in between
+	for tag := uint64(1); tag <= 100; tag++ {
+		higher, lower, estimated := cache.ledger.rank(tag * 1e9)
+		if tag >= 99 && higher != 100-tag || tag <= 2 && lower != tag-1 {
+			t.Errorf("rank of tag %d: %d higher and %d lower, want %d and %d exactly", tag, higher, lower, 100-tag, tag-1)
+		}
+		if higher+lower > 99 || int64(higher)-int64(100-tag) > 1 || int64(100-tag)-int64(higher) > 1 || int64(lower)-int64(tag-1) > 1 || int64(tag-1)-int64(lower) > 1 {
+			t.Errorf("rank of tag %d: %d higher and %d lower, want about %d and %d", tag, higher, lower, 100-tag, tag-1)
+		}
+		if !estimated {
+			t.Errorf("rank of tag %d not estimated with only 2 entries of each end in memory", tag)
+		}
+	}
+	LEDGER_TOP_K = 4
+	if higher, lower, estimated := loadEntries(t, entries[:4]).ledger.rank(3e9); estimated || higher != 1 || lower != 2 {
+		t.Fatalf("rank in a ledger held in memory: %d higher, %d lower, estimated %v", higher, lower, estimated)
+	}
+}
+
+func TestPublishLedgerCache(t *testing.T) {
+	withTopK(t, 10)
+	t.Cleanup(func() {
+		publishLedgerCache(nil)
+		publishLedgerCache(nil)
+	})
+	var caches []*LedgerCache
+	for i := 0; i < 3; i++ {
+		cache, err := loadLedgerCache(writeLedger(t, []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, uint64(i))}, time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		publishLedgerCache(cache)
+		caches = append(caches, cache)
+	}
+	// The replaced cache is still readable, the one before it is removed
+	if _, ok, err := caches[1].snapshot.search(ledgerTag(1)); err != nil || !ok {
+		t.Fatalf("snapshot of the replaced cache: %v", err)
+	}
+	if _, _, err := caches[0].snapshot.search(ledgerTag(1)); err == nil {
+		t.Fatal("snapshot of the cache replaced two refreshes ago still readable")
+	}
+	if left, _ := os.ReadDir(LEDGER_SNAPSHOT_DIR); len(left) != 2 {
+		t.Fatalf("%d snapshots on disk, want 2", len(left))
+	}
+}
+
+func TestExcludeEntries(t *testing.T) {
+	ledger := rankedEntries{
+		ledgerEntry(1, 1, 50), ledgerEntry(2, 1, 30), ledgerEntry(3, 1, 30), ledgerEntry(4, 1, 20), ledgerEntry(5, 1, 10),
+	}
+	if i, ok := rankedPosition(ledger, ledgerEntry(3, 1, 30)); !ok || i != 2 {
+		t.Fatalf("rankedPosition() = %d, %v, want 2", i, ok)
+	}
+	if _, ok := rankedPosition(ledger, ledgerEntry(6, 1, 30)); ok {
+		t.Fatal("entry not in the ledger found")
+	}
+
+	// Entries not in the ledger are ignored
+	removed := []go_mcminterface.LedgerEntry{ledgerEntry(5, 1, 10), ledgerEntry(2, 1, 30), ledgerEntry(6, 1, 40)}
+	if kept := balancesOf(excludeEntries(ledger, removed)); kept != "1:50 3:30 4:20 " {
+		t.Fatalf("excludeEntries() = %s, want 1:50 3:30 4:20", kept)
+	}
+	if kept := excludeEntries(ledger, removed[2:]); kept.Len() != ledger.Len() {
+		t.Fatalf("%d entries left once nothing is excluded", kept.Len())
+	}
+}
+
+func TestRichlistPaging(t *testing.T) {
+	withLabels(t, "")
+	labels, _ := json.Marshal([]Label{
+		{Tag: labelTag(1), Name: "Exchange", Category: "exchange"},
+		{Tag: labelTag(7), Name: "Other exchange", Category: "exchange"},
+	})
+	os.WriteFile(LABELS_PATH, labels, 0644)
+	if err := LoadLabels(LABELS_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	// From memory, and from the snapshot past the 3 richest and poorest
+	for _, k := range []int{10000, 3} {
+		t.Run(fmt.Sprintf("top_k=%d", k), func(t *testing.T) {
+			withTopK(t, k)
+			testRichlistPaging(t)
+		})
+	}
+}
+
+func testRichlistPaging(t *testing.T) {
+	node, _, _ := newTestServer(t, 10)
+	var entries []go_mcminterface.LedgerEntry
+	for tag := byte(1); tag <= 12; tag++ {
+		entries = append(entries, ledgerEntry(tag, 1, 1000-10*uint64(tag)))
+	}
+	withLedger(t, node, 9, entries)
+	handler := NewServer(node).Router()
+
+	// Pages of 5 through the whole ledger, from either end
+	page := func(offset int, ascending bool, exclude []string) RichlistResponse {
+		var response RichlistResponse
+		if code := post(t, handler, "/stats/richlist", map[string]interface{}{
+			"offset": offset, "limit": 5, "ascending": ascending, "exclude_categories": exclude,
+		}, &response); code != 0 {
+			t.Fatalf("/stats/richlist from %d: error %d", offset, code)
+		}
+		return response
+	}
+	walk := func(ascending bool, exclude []string) (string, uint64) {
+		list := ""
+		var total uint64
+		for offset := 0; offset < 15; offset += 5 {
+			response := page(offset, ascending, exclude)
+			for _, account := range response.Accounts {
+				list += account.AccountIdentifier.Address[2:4] + " "
+			}
+			total = response.TotalAccounts
+		}
+		return list, total
+	}
+
+	if list, total := walk(false, nil); list != "01 02 03 04 05 06 07 08 09 0a 0b 0c " || total != 12 {
+		t.Fatalf("richest first: %s of %d", list, total)
+	}
+	if list, _ := walk(true, nil); list != "0c 0b 0a 09 08 07 06 05 04 03 02 01 " {
+		t.Fatalf("poorest first: %s", list)
+	}
+	// The offsets count the accounts left
+	if list, total := walk(false, []string{"exchange"}); list != "02 03 04 05 06 08 09 0a 0b 0c " || total != 10 {
+		t.Fatalf("richest first without the exchanges: %s of %d", list, total)
+	}
+	if list, _ := walk(true, []string{"exchange"}); list != "0c 0b 0a 09 08 06 05 04 03 02 " {
+		t.Fatalf("poorest first without the exchanges: %s", list)
+	}
+	if response := page(100, false, nil); len(response.Accounts) != 0 {
+		t.Fatalf("%d accounts past the end of the ledger", len(response.Accounts))
+	}
+}
@@ -0,0 +1,230 @@
+// Package lightclient validates Mochimo block trailers (the 160 bytes
+// records of a node's tfile.dat) without downloading any block. It checks
+// parent-hash linkage, block number continuity, solve time linkage, the
+// difficulty adjustment bound and, through a pluggable check, the nonce of
+// every mined trailer.
+//
+// It does not verify proof-of-work: the work it sums is the one claimed by
+// the difficulty of the trailers. Linkage only proves that the trailers
+// lead to their tip, so the tip hash must be compared with a trusted one.
+package lightclient
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+)
+
+// TrailerSize is the size of a block trailer in the tfile
+const TrailerSize = 160
+
+// Trailer is a decoded block trailer
+type Trailer struct {
+	Phash      [32]byte
+	Bnum       uint64
+	Mfee       uint64
+	Tcount     uint32
+	Time0      uint32
+	Difficulty uint32
+	Mroot      [32]byte
+	Nonce      [32]byte
+	Stime      uint32
+	Bhash      [32]byte
+}
+
+// ParseTrailer decodes a 160 bytes trailer
+func ParseTrailer(raw []byte) (Trailer, error) {
+	var t Trailer
+	if len(raw) != TrailerSize {
+		return t, fmt.Errorf("trailer must be %d bytes, got %d", TrailerSize, len(raw))
+	}
+	copy(t.Phash[:], raw[0:32])
+	t.Bnum = binary.LittleEndian.Uint64(raw[32:40])
+	t.Mfee = binary.LittleEndian.Uint64(raw[40:48])
+	t.Tcount = binary.LittleEndian.Uint32(raw[48:52])
+	t.Time0 = binary.LittleEndian.Uint32(raw[52:56])
+	t.Difficulty = binary.LittleEndian.Uint32(raw[56:60])
+	copy(t.Mroot[:], raw[60:92])
+	copy(t.Nonce[:], raw[92:124])
+	t.Stime = binary.LittleEndian.Uint32(raw[124:128])
+	copy(t.Bhash[:], raw[128:160])
+	return t, nil
+}
+
+// IsNeogenesis tells if the trailer closes an epoch of 256 blocks
+func (t Trailer) IsNeogenesis() bool {
+	return t.Bnum&0xFF == 0
+}
+
+// IsPseudo tells if the trailer is a pseudo-block, which carries no
+// transactions and no proof-of-work
+func (t Trailer) IsPseudo() bool {
+	return t.Tcount == 0 && !t.IsNeogenesis()
+}
+
+// IsMined tells if the trailer carries a proof-of-work
+func (t Trailer) IsMined() bool {
+	return t.Bnum > 0 && !t.IsNeogenesis() && !t.IsPseudo()
+}
+
+// Options tune the checks done by a Validator
+type Options struct {
+	// MaxDifficultyStep bounds the difficulty change between two mined blocks
+	MaxDifficultyStep uint32
+	// CheckNonce checks the nonce of a mined trailer. A nil CheckNonce
+	// skips the check.
+	CheckNonce func(t Trailer, raw []byte) error
+}
+
+// DefaultOptions are the rules of the Mochimo mainnet, without a nonce check
+func DefaultOptions() Options {
+	return Options{MaxDifficultyStep: 1}
+}
+
+// ValidationError tells at which block a trailer range stopped being valid
+type ValidationError struct {
+	Bnum   uint64
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("block %d: %s", e.Bnum, e.Reason)
+}
+
+// Status summarizes the trailers validated so far
+type Status struct {
+	First uint64
+	Last  uint64
+	Count uint64
+	Tip   [32]byte
+	// ClaimedWork sums 2^difficulty over the mined trailers, as claimed by
+	// their difficulty: the hashes themselves are not checked
+	ClaimedWork *big.Int
+}
+
+// Validator checks trailers one by one. It can be fed incrementally as
+// the tfile grows.
+type Validator struct {
+	opts Options
+	prev *Trailer
+	// prevMined is the last mined trailer, used for the difficulty bound
+	prevMined *Trailer
+	status    Status
+}
+
+// NewValidator returns a validator expecting any trailer as the first one
+func NewValidator(opts Options) *Validator {
+	return &Validator{opts: opts, status: Status{ClaimedWork: new(big.Int)}}
+}
+
+// Last returns the last accepted trailer, nil if none was accepted yet
+func (v *Validator) Last() *Trailer {
+	return v.prev
+}
+
+// Status returns a copy of the validation summary
+func (v *Validator) Status() Status {
+	s := v.status
+	s.ClaimedWork = new(big.Int).Set(v.status.ClaimedWork)
+	return s
+}
+
+// Add validates the next raw trailer against the previous ones
+func (v *Validator) Add(raw []byte) error {
+	t, err := ParseTrailer(raw)
+	if err != nil {
+		return err
+	}
+
+	if p := v.prev; p != nil {
+		if t.Bnum != p.Bnum+1 {
+			return &ValidationError{t.Bnum, fmt.Sprintf("block number does not follow %d", p.Bnum)}
+		}
+		if t.Phash != p.Bhash {
+			return &ValidationError{t.Bnum, "parent hash does not match the previous trailer"}
+		}
+		if t.Time0 != p.Stime {
+			return &ValidationError{t.Bnum, "time0 is not the solve time of the previous block"}
+		}
+	}
+	if t.Bnum > 0 && t.Stime < t.Time0 {
+		return &ValidationError{t.Bnum, "solve time is before time0"}
+	}
+
+	if t.IsMined() {
+		if p := v.prevMined; p != nil && p.Bnum+1 == t.Bnum && v.opts.MaxDifficultyStep > 0 {
+			step := int64(t.Difficulty) - int64(p.Difficulty)
+			if step > int64(v.opts.MaxDifficultyStep) || -step > int64(v.opts.MaxDifficultyStep) {
+				return &ValidationError{t.Bnum, fmt.Sprintf("difficulty moved from %d to %d", p.Difficulty, t.Difficulty)}
+			}
+		}
+		if v.opts.CheckNonce != nil {
+			if err := v.opts.CheckNonce(t, raw); err != nil {
+				return &ValidationError{t.Bnum, "invalid nonce: " + err.Error()}
+			}
+		}
+		// Each mined block claims 2^difficulty expected hashes
+		v.status.ClaimedWork.Add(v.status.ClaimedWork, new(big.Int).Lsh(big.NewInt(1), uint(t.Difficulty)))
+		mined := t
+		v.prevMined = &mined
+	}
+
+	if v.prev == nil {
+		v.status.First = t.Bnum
+	}
+	v.prev = &t
+	v.status.Last = t.Bnum
+	v.status.Count++
+	v.status.Tip = t.Bhash
+	return nil
+}
+
+// ValidateReader validates every trailer read from r
+func (v *Validator) ValidateReader(r io.Reader) error {
+	reader := bufio.NewReaderSize(r, 1024*TrailerSize)
+	raw := make([]byte, TrailerSize)
+	for {
+		if _, err := io.ReadFull(reader, raw); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("truncated trailer after block %d", v.status.Last)
+			}
+			return err
+		}
+		if err := v.Add(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// ValidateTrailers validates a contiguous range of raw trailers
+func ValidateTrailers(data []byte, opts Options) (Status, error) {
+	if len(data)%TrailerSize != 0 {
+		return Status{}, fmt.Errorf("trailer data is not a multiple of %d bytes", TrailerSize)
+	}
+	v := NewValidator(opts)
+	for pos := 0; pos < len(data); pos += TrailerSize {
+		if err := v.Add(data[pos : pos+TrailerSize]); err != nil {
+			return v.Status(), err
+		}
+	}
+	return v.Status(), nil
+}
+
+// ValidateFile validates a whole tfile
+func ValidateFile(path string, opts Options) (Status, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Status{}, err
+	}
+	defer file.Close()
+
+	v := NewValidator(opts)
+	err = v.ValidateReader(file)
+	return v.Status(), err
+}
@@ -0,0 +1,185 @@
+package lightclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encode is the inverse of ParseTrailer
+func encode(t Trailer) []byte {
+	raw := make([]byte, TrailerSize)
+	copy(raw[0:32], t.Phash[:])
+	binary.LittleEndian.PutUint64(raw[32:40], t.Bnum)
+	binary.LittleEndian.PutUint64(raw[40:48], t.Mfee)
+	binary.LittleEndian.PutUint32(raw[48:52], t.Tcount)
+	binary.LittleEndian.PutUint32(raw[52:56], t.Time0)
+	binary.LittleEndian.PutUint32(raw[56:60], t.Difficulty)
+	copy(raw[60:92], t.Mroot[:])
+	copy(raw[92:124], t.Nonce[:])
+	binary.LittleEndian.PutUint32(raw[124:128], t.Stime)
+	copy(raw[128:160], t.Bhash[:])
+	return raw
+}
+
+// chain builds n linked trailers from block 0, every one mined at
+// difficulty 10 except the neogenesis ones
+func chain(n int) []Trailer {
+	trailers := make([]Trailer, n)
+	for i := range trailers {
+		t := Trailer{Bnum: uint64(i), Stime: uint32(1000 + 60*i), Difficulty: 10, Tcount: 1}
+		if i > 0 {
+			t.Phash = trailers[i-1].Bhash
+			t.Time0 = trailers[i-1].Stime
+		}
+		if t.IsNeogenesis() {
+			t.Tcount = 0
+		}
+		t.Bhash = sha256.Sum256(encode(t)[:128])
+		trailers[i] = t
+	}
+	return trailers
+}
+
+func join(trailers []Trailer) []byte {
+	var buf bytes.Buffer
+	for _, t := range trailers {
+		buf.Write(encode(t))
+	}
+	return buf.Bytes()
+}
+
+func TestParseTrailer(t *testing.T) {
+	want := chain(3)[2]
+	want.Mfee, want.Nonce[5] = 500, 7
+	got, err := ParseTrailer(encode(want))
+	if err != nil || got != want {
+		t.Fatalf("ParseTrailer() = %+v, %v, want %+v", got, err, want)
+	}
+	if _, err := ParseTrailer(make([]byte, TrailerSize-1)); err == nil {
+		t.Fatal("short trailer parsed")
+	}
+}
+
+func TestTrailerKinds(t *testing.T) {
+	tests := []struct {
+		trailer                   Trailer
+		neogenesis, pseudo, mined bool
+	}{
+		{Trailer{Bnum: 0}, true, false, false},
+		{Trailer{Bnum: 256}, true, false, false},
+		{Trailer{Bnum: 257, Tcount: 0}, false, true, false},
+		{Trailer{Bnum: 258, Tcount: 3}, false, false, true},
+	}
+	for _, test := range tests {
+		tr := test.trailer
+		if tr.IsNeogenesis() != test.neogenesis || tr.IsPseudo() != test.pseudo || tr.IsMined() != test.mined {
+			t.Errorf("block %d: neogenesis %v pseudo %v mined %v", tr.Bnum, tr.IsNeogenesis(), tr.IsPseudo(), tr.IsMined())
+		}
+	}
+}
+
+func TestValidateTrailers(t *testing.T) {
+	trailers := chain(300)
+	status, err := ValidateTrailers(join(trailers), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.First != 0 || status.Last != 299 || status.Count != 300 || status.Tip != trailers[299].Bhash {
+		t.Fatalf("status %+v", status)
+	}
+	// Blocks 0 and 256 are neogenesis blocks and claim no work
+	want := new(big.Int).Mul(big.NewInt(298), big.NewInt(1<<10))
+	if status.ClaimedWork.Cmp(want) != 0 {
+		t.Fatalf("claimed work %s, want %s", status.ClaimedWork, want)
+	}
+}
+
+func TestValidateTrailersRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(trailers []Trailer)
+		at     uint64
+	}{
+		{"broken parent hash", func(tr []Trailer) { tr[5].Phash[0] ^= 1 }, 5},
+		{"skipped block number", func(tr []Trailer) { tr[5].Bnum = 7 }, 7},
+		{"time0 not the previous stime", func(tr []Trailer) { tr[5].Time0++ }, 5},
+		{"solved before time0", func(tr []Trailer) { tr[5].Stime = tr[5].Time0 - 1 }, 5},
+		{"difficulty jump", func(tr []Trailer) { tr[5].Difficulty = 12 }, 5},
+	}
+	for _, test := range tests {
+		trailers := chain(10)
+		test.modify(trailers)
+		_, err := ValidateTrailers(join(trailers), DefaultOptions())
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Bnum != test.at {
+			t.Errorf("%s: got %v, want a validation error at block %d", test.name, err, test.at)
+		}
+	}
+
+	if _, err := ValidateTrailers(join(chain(3))[:200], DefaultOptions()); err == nil {
+		t.Error("partial trailer accepted")
+	}
+}
+
+func TestCheckNonce(t *testing.T) {
+	trailers := chain(10)
+	checked := []uint64{}
+	opts := DefaultOptions()
+	opts.CheckNonce = func(tr Trailer, raw []byte) error {
+		checked = append(checked, tr.Bnum)
+		if tr.Bnum == 6 {
+			return errors.New("no haiku")
+		}
+		return nil
+	}
+	_, err := ValidateTrailers(join(trailers), opts)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Bnum != 6 {
+		t.Fatalf("got %v, want a nonce error at block 6", err)
+	}
+	// Block 0 is not mined
+	if len(checked) != 6 || checked[0] != 1 {
+		t.Fatalf("nonce checked for blocks %v", checked)
+	}
+}
+
+func TestValidatorIncremental(t *testing.T) {
+	trailers := chain(20)
+	path := filepath.Join(t.TempDir(), "tfile.dat")
+	if err := os.WriteFile(path, join(trailers), 0644); err != nil {
+		t.Fatal(err)
+	}
+	whole, err := ValidateFile(path, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewValidator(DefaultOptions())
+	if err := v.ValidateReader(bytes.NewReader(join(trailers[:12]))); err != nil {
+		t.Fatal(err)
+	}
+	if v.Last().Bnum != 11 {
+		t.Fatalf("last trailer %d, want 11", v.Last().Bnum)
+	}
+	if err := v.ValidateReader(bytes.NewReader(join(trailers[12:]))); err != nil {
+		t.Fatal(err)
+	}
+	status := v.Status()
+	if status.Tip != whole.Tip || status.Count != whole.Count || status.ClaimedWork.Cmp(whole.ClaimedWork) != 0 {
+		t.Fatalf("incremental status %+v differs from %+v", status, whole)
+	}
+
+	// A trailer that does not follow the ones already validated
+	if err := v.Add(encode(chain(25)[22])); err == nil {
+		t.Fatal("trailer skipping blocks accepted")
+	}
+	if err := v.ValidateReader(bytes.NewReader(encode(chain(21)[20])[:100])); err == nil {
+		t.Fatal("truncated trailer accepted")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// AccountLineageRequest is the request structure for the /account/lineage endpoint
+type AccountLineageRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	AccountIdentifier AccountIdentifier `json:"account_identifier"`
+}
+
+// LineageAddress is a WOTS address that held the tag
+type LineageAddress struct {
+	AddressHash         string                 `json:"address_hash"`
+	FirstBlockIndex     *int64                 `json:"first_block_index,omitempty"`
+	FundingTransaction  *TransactionIdentifier `json:"funding_transaction,omitempty"`
+	SpentBlockIndex     *int64                 `json:"spent_block_index,omitempty"`
+	SpendingTransaction *TransactionIdentifier `json:"spending_transaction,omitempty"`
+}
+
+// AccountLineageResponse is the response structure for the /account/lineage endpoint
+type AccountLineageResponse struct {
+	AccountIdentifier AccountIdentifier `json:"account_identifier"`
+	Lineage           []LineageAddress  `json:"lineage"`
+}
+
+func txIdentifier(txID *string) *TransactionIdentifier {
+	if txID == nil {
+		return nil
+	}
+	return &TransactionIdentifier{Hash: "0x" + *txID}
+}
+
+// accountLineageHandler returns the addresses a tag moved through, oldest first
+func accountLineageHandler(w http.ResponseWriter, r *http.Request) {
+	var req AccountLineageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§baccountLineageHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§baccountLineageHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	if len(req.AccountIdentifier.Address) != go_mcminterface.TXTAGLEN*2+2 {
+		mlog(3, "§baccountLineageHandler(): §4Invalid account format")
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+	tag, err := hex.DecodeString(req.AccountIdentifier.Address[2:])
+	if err != nil {
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+
+	if !Globals.EnableIndexer || INDEXER_DB == nil {
+		mlog(3, "§baccountLineageHandler(): §4Indexer is not enabled")
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+
+	entries, err := INDEXER_DB.GetTagLineage(tag)
+	if err != nil {
+		mlog(3, "§baccountLineageHandler(): §4Error getting lineage: §c%s", err)
+		giveError(w, ErrInternalError)
+		return
+	}
+	if len(entries) == 0 {
+		giveError(w, ErrAccountNotFound)
+		return
+	}
+
+	response := AccountLineageResponse{
+		AccountIdentifier: labeledAccountHex(strings.ToLower(req.AccountIdentifier.Address)),
+		Lineage:           make([]LineageAddress, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		response.Lineage = append(response.Lineage, LineageAddress{
+			AddressHash:         "0x" + entry.AddressHash,
+			FirstBlockIndex:     entry.FirstHeight,
+			FundingTransaction:  txIdentifier(entry.FundingTransaction),
+			SpentBlockIndex:     entry.SpentHeight,
+			SpendingTransaction: txIdentifier(entry.SpendingTransaction),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// addRelatedTransactions links every spend to the previous spend of its tag,
+// as recorded by the indexer, with one query for the whole block
+func addRelatedTransactions(transactions []Transaction) {
+	if !Globals.EnableIndexer || INDEXER_DB == nil {
+		return
+	}
+	linkPreviousSpends(transactions, INDEXER_DB.GetPreviousSpends)
+}
+
+func linkPreviousSpends(transactions []Transaction, previousSpends func(txIDs []string) (map[string]string, error)) {
+	var txIDs []string
+	for _, tx := range transactions {
+		if len(tx.Operations) > 0 && tx.Operations[0].Type == "SOURCE_TRANSFER" {
+			txIDs = append(txIDs, strings.TrimPrefix(tx.TransactionIdentifier.Hash, "0x"))
+		}
+	}
+	if len(txIDs) == 0 {
+		return
+	}
+	previous, err := previousSpends(txIDs)
+	if err != nil {
+		mlog(3, "§baddRelatedTransactions(): §4Error getting previous spends: §c%s", err)
+		return
+	}
+	for i := range transactions {
+		tx := &transactions[i]
+		if prev, ok := previous[strings.TrimPrefix(tx.TransactionIdentifier.Hash, "0x")]; ok {
+			tx.RelatedTransactions = append(tx.RelatedTransactions, RelatedTransaction{
+				TransactionIdentifier: TransactionIdentifier{Hash: "0x" + prev},
+				Direction:             "backward",
+			})
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLinkPreviousSpends(t *testing.T) {
+	spend := func(hash string) Transaction {
+		return Transaction{
+			TransactionIdentifier: TransactionIdentifier{Hash: hash},
+			Operations:            []Operation{{Type: "SOURCE_TRANSFER"}},
+		}
+	}
+	transactions := []Transaction{
+		{TransactionIdentifier: TransactionIdentifier{Hash: "0xbb"}, Operations: []Operation{{Type: "REWARD"}}},
+		spend("0x01"),
+		spend("0x02"),
+	}
+
+	calls := 0
+	linkPreviousSpends(transactions, func(txIDs []string) (map[string]string, error) {
+		calls++
+		if len(txIDs) != 2 || txIDs[0] != "01" || txIDs[1] != "02" {
+			t.Fatalf("previous spends asked for %v", txIDs)
+		}
+		return map[string]string{"02": "aa"}, nil
+	})
+	if calls != 1 {
+		t.Fatalf("%d queries for one block, want 1", calls)
+	}
+	if len(transactions[0].RelatedTransactions) != 0 || len(transactions[1].RelatedTransactions) != 0 {
+		t.Fatal("transactions without a known previous spend got related transactions")
+	}
+	related := transactions[2].RelatedTransactions
+	if len(related) != 1 || related[0].TransactionIdentifier.Hash != "0xaa" || related[0].Direction != "backward" {
+		t.Fatalf("related transactions %+v", related)
+	}
+
+	// No spends, no query; a failing query links nothing
+	linkPreviousSpends(transactions[:1], func([]string) (map[string]string, error) {
+		t.Fatal("query without spends")
+		return nil, nil
+	})
+	failing := []Transaction{spend("0x03")}
+	linkPreviousSpends(failing, func([]string) (map[string]string, error) {
+		return nil, errors.New("database down")
+	})
+	if len(failing[0].RelatedTransactions) != 0 {
+		t.Fatal("related transactions from a failed query")
+	}
+}
+
+func TestAccountLineageWithoutDatabase(t *testing.T) {
+	_, server, _ := newTestServer(t, 5)
+	enabled := Globals.EnableIndexer
+	Globals.EnableIndexer = true
+	t.Cleanup(func() { Globals.EnableIndexer = enabled })
+	handler := server.Router()
+
+	code := post(t, handler, "/account/lineage", map[string]interface{}{"account_identifier": map[string]string{"address": "0x" + strings.Repeat("ab", 20)}}, nil)
+	if code != ErrServiceUnavailable.Code {
+		t.Fatalf("/account/lineage without the indexer: error %d, want %d", code, ErrServiceUnavailable.Code)
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"mochimo-mesh/indexer"
 
 	"github.com/NickP005/go_mcminterface"
-	"github.com/gorilla/mux"
 )
 
 func corsMiddleware(next http.Handler) http.Handler {
@@ -69,60 +68,69 @@ func main() {
 		return
 	}
 
-	if Globals.OnlineMode {
-		mlog(1, "§bmain(): §2Running in online mode!")
-		Init()
-	} else {
-		mlog(1, "§bmain(): §2Running in offline mode!")
+	var node NodeClient = MochimoNodeClient{}
+	if quorumEnabled() {
+		node = QuorumNodeClient{}
 	}
 
-	// Set the GetBlockByHexHash function in the indexer package
-	if Globals.EnableIndexer {
-		indexer.GetBlockByHexHash = GetBlockByHexHash
+	if BLOCK_STORE_PATH != "" {
+		store, err := OpenBlockStore(BLOCK_STORE_PATH, BLOCK_STORE_COMPRESS, BLOCK_STORE_MAX_MB*1024*1024, BLOCK_STORE_MAX_AGE, BLOCK_STORE_WINDOW)
+		if err != nil {
+			mlog(1, "§bmain(): §4Error opening block store, block archiving disabled: §c%s", err)
+		} else {
+			BLOCK_STORE = store
+		}
 	}
 
-	r := mux.NewRouter()
-
-	r.Use(corsMiddleware)
-	r.Use(maxRequestSizeMiddleware) // Add the new middleware
+	if err := LoadLabels(LABELS_PATH); err != nil {
+		mlog(1, "§bmain(): §4Error loading labels from §8%s§4: §c%s", LABELS_PATH, err)
+	}
 
-	r.HandleFunc("/network/options", networkOptionsHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/network/list", networkListHandler).Methods("POST", "OPTIONS")
+	if Globals.LedgerPath != "" && LEDGER_ARCHIVE_PATH != "" {
+		archive, err := OpenLedgerArchive(LEDGER_ARCHIVE_PATH, LEDGER_ARCHIVE_EVERY, LEDGER_ARCHIVE_KEEP)
+		if err != nil {
+			mlog(1, "§bmain(): §4Error opening ledger archive, ledger snapshots disabled: §c%s", err)
+		} else {
+			LEDGER_ARCHIVE = archive
+		}
+	}
 
-	if Globals.OnlineMode {
-		r.HandleFunc("/block", blockHandler).Methods("POST", "OPTIONS")
-		r.HandleFunc("/block/transaction", blockTransactionHandler).Methods("POST", "OPTIONS")
-		r.HandleFunc("/network/status", networkStatusHandler).Methods("POST", "OPTIONS")
-		r.HandleFunc("/mempool", mempoolHandler).Methods("POST", "OPTIONS")
-		r.HandleFunc("/mempool/transaction", mempoolTransactionHandler).Methods("POST", "OPTIONS")
-		r.HandleFunc("/account/balance", accountBalanceHandler).Methods("POST", "OPTIONS")
-		r.HandleFunc("/call", callHandler).Methods("POST", "OPTIONS")
+	if NODE_BC_PATH != "" && !Globals.Regtest {
+		archive, err := OpenNodeArchive(NODE_BC_PATH)
+		if err != nil {
+			mlog(2, "§bmain(): §6Node block archive not available, blocks will be queried to the node: §c%s", err)
+		} else {
+			mlog(2, "§bmain(): §2Serving blocks from the node archive at §8%s", NODE_BC_PATH)
+			NODE_ARCHIVE = archive
+		}
 	}
 
-	r.HandleFunc("/construction/derive", constructionDeriveHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/construction/preprocess", constructionPreprocessHandler).Methods("POST", "OPTIONS")
-	if Globals.OnlineMode {
-		r.HandleFunc("/construction/metadata", constructionMetadataHandler).Methods("POST", "OPTIONS")
-		r.HandleFunc("/construction/payloads", constructionPayloadsHandler).Methods("POST", "OPTIONS")
+	if Globals.Regtest {
+		mlog(1, "§bmain(): §6Running in regtest mode on a simulated chain!")
+		if err := InitRegtest(); err != nil {
+			mlog(1, "§bmain(): §4Error starting regtest: §c%s", err)
+			return
+		}
+		node = REGTEST_NODE
 	}
-	r.HandleFunc("/construction/parse", constructionParseHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/construction/combine", constructionCombineHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/construction/hash", constructionHashHandler).Methods("POST", "OPTIONS")
+	server := NewServer(node)
+
 	if Globals.OnlineMode {
-		r.HandleFunc("/construction/submit", constructionSubmitHandler).Methods("POST", "OPTIONS")
+		mlog(1, "§bmain(): §2Running in online mode!")
+		server.Init()
+	} else {
+		mlog(1, "§bmain(): §2Running in offline mode!")
+		if Globals.LedgerPath != "" {
+			InitStatistics()
+		}
 	}
 
+	// Set the GetBlockByHexHash function in the indexer package
 	if Globals.EnableIndexer {
-		mlog(2, "§bmain(): §2Indexer enabled, adding indexer routes")
-		r.HandleFunc("/search/transactions", searchTransactionsHandler).Methods("POST", "OPTIONS")
-		r.HandleFunc("/events/blocks", eventsBlocksHandler).Methods("POST", "OPTIONS")
+		indexer.GetBlockByHexHash = server.getBlockByHexHash
 	}
 
-	// Add statistics routes if ledger path is specified
-	if Globals.LedgerPath != "" {
-		mlog(2, "§bmain(): §2Ledger path specified, adding statistics routes")
-		r.HandleFunc("/stats/richlist", richlistHandler).Methods("POST", "OPTIONS")
-	}
+	r := server.Router()
 
 	elapsed := time.Since(start_time)
 
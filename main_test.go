@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The node workers of the quorum reads run the test binary
+	if ip := os.Getenv(nodeWorkerEnv); ip != "" {
+		runNodeWorker(ip, os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+
+	// Keep the test output readable
+	Globals.LogLevel = 0
+	os.Exit(m.Run())
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// MempoolSnapshot is the parsed mempool at one point in time. It is never
+// modified once published, so handlers read it without locking.
+type MempoolSnapshot struct {
+	Entries      []go_mcminterface.TXENTRY
+	Transactions []Transaction        // Rosetta view of Entries, same order
+	IDs          []string             // "0x<id>" of Entries, same order
+	ByID         map[string]int       // "0x<id>" -> position in Entries
+	FirstSeen    map[string]time.Time // "0x<id>" -> when mesh first saw it
+	LoadedAt     time.Time
+	Labels       uint64 // labelsVersion() the Rosetta view was rendered with
+}
+
+// Find returns the position of a transaction hash, with or without 0x
+func (s *MempoolSnapshot) Find(hash string) (int, bool) {
+	hash = strings.ToLower(hash)
+	if !strings.HasPrefix(hash, "0x") {
+		hash = "0x" + hash
+	}
+	i, ok := s.ByID[hash]
+	return i, ok
+}
+
+// Age returns for how long the i-th transaction has been pending
+func (s *MempoolSnapshot) Age(i int) time.Duration {
+	return time.Since(s.FirstSeen[s.IDs[i]])
+}
+
+// MEMPOOL_REFRESH_INTERVAL is how often the mempool refresher checks txclean.dat
+var MEMPOOL_REFRESH_INTERVAL time.Duration = time.Second
+
+// errMempoolNotLoaded is returned until the refresher first read the mempool
+var errMempoolNotLoaded = errors.New("mempool not loaded yet")
+
+// mempoolState is what the refresher publishes: the last snapshot and the
+// error of the last reload, if it failed
+type mempoolState struct {
+	snapshot *MempoolSnapshot
+	err      error
+}
+
+// MempoolCache reloads the mempool only when txclean.dat changes. Readers
+// take the published state and never touch the file.
+type MempoolCache struct {
+	node    NodeClient
+	state   atomic.Pointer[mempoolState]
+	mu      sync.Mutex // serializes reloads
+	modTime time.Time
+	size    int64
+}
+
+// NewMempoolCache returns a cache of the mempool of node
+func NewMempoolCache(node NodeClient) *MempoolCache {
+	return &MempoolCache{node: node}
+}
+
+// changed tells whether the mempool may differ from the current snapshot.
+// The simulated node keeps its mempool in memory, so it is always reloaded.
+func (c *MempoolCache) changed() (bool, time.Time, int64) {
+	if Globals.Regtest {
+		return true, time.Time{}, 0
+	}
+	fi, err := os.Stat(TXCLEANFILE_PATH)
+	if err != nil {
+		// Let the reload report the error
+		return true, time.Time{}, 0
+	}
+	snapshot := c.current()
+	return snapshot == nil || snapshot.Labels != labelsVersion() || !fi.ModTime().Equal(c.modTime) || fi.Size() != c.size, fi.ModTime(), fi.Size()
+}
+
+// current returns the last snapshot read, nil before the first one
+func (c *MempoolCache) current() *MempoolSnapshot {
+	if state := c.state.Load(); state != nil {
+		return state.snapshot
+	}
+	return nil
+}
+
+// Snapshot returns the mempool published by the last refresh. It fails
+// while the last reload failed, so that callers never act on a mempool
+// they know to be stale.
+func (c *MempoolCache) Snapshot() (*MempoolSnapshot, error) {
+	state := c.state.Load()
+	if state == nil {
+		return nil, errMempoolNotLoaded
+	}
+	if state.err != nil {
+		return nil, state.err
+	}
+	return state.snapshot, nil
+}
+
+// Run refreshes the mempool every interval, forever
+func (c *MempoolCache) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Refresh(); err != nil {
+			mlog(5, "§bMempoolCache.Run(): §7Error reading mempool: §c%s", err)
+		}
+		<-ticker.C
+	}
+}
+
+// Refresh reloads the mempool if txclean.dat changed and publishes it
+func (c *MempoolCache) Refresh() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed, modTime, size := c.changed()
+	if !changed {
+		if state := c.state.Load(); state.err != nil {
+			// The file is back as it was before the failed reload
+			c.state.Store(&mempoolState{snapshot: state.snapshot})
+		}
+		return nil
+	}
+
+	previous := c.current()
+	entries, err := c.node.QueryMempool()
+	if err != nil {
+		// Keep the first seen times for when the mempool is readable again
+		c.state.Store(&mempoolState{snapshot: previous, err: err})
+		return err
+	}
+
+	now := time.Now()
+	snapshot := &MempoolSnapshot{
+		Entries:      entries,
+		Transactions: make([]Transaction, len(entries)),
+		IDs:          make([]string, len(entries)),
+		ByID:         make(map[string]int, len(entries)),
+		FirstSeen:    make(map[string]time.Time, len(entries)),
+		LoadedAt:     now,
+		Labels:       labelsVersion(),
+	}
+	for i, tx := range entries {
+		id := fmt.Sprintf("0x%x", tx.GetID())
+		snapshot.IDs[i] = id
+		snapshot.ByID[id] = i
+
+		// Transactions still pending keep their first seen time, and their
+		// Rosetta view unless the labels changed
+		snapshot.FirstSeen[id] = now
+		if previous != nil {
+			if j, ok := previous.ByID[id]; ok {
+				snapshot.FirstSeen[id] = previous.FirstSeen[id]
+				if previous.Labels == snapshot.Labels {
+					snapshot.Transactions[i] = previous.Transactions[j]
+					continue
+				}
+			}
+		}
+		snapshot.Transactions[i] = getTransactionsFromBlockBody([]go_mcminterface.TXENTRY{tx}, go_mcminterface.WotsAddress{}, false)[0]
+	}
+
+	c.state.Store(&mempoolState{snapshot: snapshot})
+	c.modTime = modTime
+	c.size = size
+	mlog(5, "§bMempoolCache.Refresh(): §7Mempool reloaded with §e%d§7 transactions", len(entries))
+
+	return nil
+}
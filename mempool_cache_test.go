@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// countingNode counts mempool reads and fails them on demand
+type countingNode struct {
+	*FakeNode
+	reads atomic.Int32
+	fail  atomic.Bool
+}
+
+func (n *countingNode) QueryMempool() ([]go_mcminterface.TXENTRY, error) {
+	n.reads.Add(1)
+	if n.fail.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return n.FakeNode.QueryMempool()
+}
+
+func TestMempoolCacheRefresh(t *testing.T) {
+	fake, _, _ := newTestServer(t, 5)
+	node := &countingNode{FakeNode: fake}
+	cache := NewMempoolCache(node)
+	if _, err := cache.Snapshot(); !errors.Is(err, errMempoolNotLoaded) {
+		t.Fatalf("snapshot before the first refresh: %v", err)
+	}
+
+	first, _ := fake.Faucet(fake.Tags()[1], 1000)
+	if err := os.WriteFile(TXCLEANFILE_PATH, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := cache.Snapshot()
+	if err != nil || len(snapshot.Entries) != 1 {
+		t.Fatalf("snapshot %v, %v, want the faucet transaction", snapshot, err)
+	}
+	seen := snapshot.FirstSeen[fmt.Sprintf("0x%x", first.GetID())]
+
+	// Neither readers nor refreshes of an unchanged file read the mempool
+	fake.Faucet(fake.Tags()[2], 1000)
+	cache.Refresh()
+	if again, _ := cache.Snapshot(); again != snapshot || node.reads.Load() != 1 {
+		t.Fatalf("mempool read %d times for an unchanged txclean.dat", node.reads.Load())
+	}
+
+	os.WriteFile(TXCLEANFILE_PATH, []byte("12"), 0644)
+	cache.Refresh()
+	snapshot, _ = cache.Snapshot()
+	if len(snapshot.Entries) != 2 || !snapshot.FirstSeen[fmt.Sprintf("0x%x", first.GetID())].Equal(seen) {
+		t.Fatalf("reloaded snapshot has %d transactions and first saw the first at %v, want 2 and %v",
+			len(snapshot.Entries), snapshot.FirstSeen[fmt.Sprintf("0x%x", first.GetID())], seen)
+	}
+}
+
+func TestMempoolCacheFailedReload(t *testing.T) {
+	fake, _, _ := newTestServer(t, 5)
+	node := &countingNode{FakeNode: fake}
+	cache := NewMempoolCache(node)
+	tx, _ := fake.Faucet(fake.Tags()[1], 1000)
+	os.WriteFile(TXCLEANFILE_PATH, []byte("1"), 0644)
+	cache.Refresh()
+	seen := cache.current().FirstSeen[fmt.Sprintf("0x%x", tx.GetID())]
+
+	// A mempool known to be stale is not served
+	node.fail.Store(true)
+	os.WriteFile(TXCLEANFILE_PATH, []byte("12"), 0644)
+	if err := cache.Refresh(); err == nil {
+		t.Fatal("failed reload not reported")
+	}
+	if _, err := cache.Snapshot(); err == nil {
+		t.Fatal("snapshot served after a failed reload")
+	}
+
+	// Pending transactions keep their age across the failure
+	node.fail.Store(false)
+	cache.Refresh()
+	snapshot, err := cache.Snapshot()
+	if err != nil || !snapshot.FirstSeen[fmt.Sprintf("0x%x", tx.GetID())].Equal(seen) {
+		t.Fatalf("snapshot after recovery: %v, first seen %v, want %v", err, snapshot.FirstSeen, seen)
+	}
+}
+
+func TestMempoolCacheConcurrentReaders(t *testing.T) {
+	fake, _, _ := newTestServer(t, 5)
+	cache := NewMempoolCache(fake)
+	cache.Refresh()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if snapshot, err := cache.Snapshot(); err != nil || len(snapshot.IDs) != len(snapshot.Entries) {
+					t.Error("inconsistent snapshot", err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		fake.Faucet(fake.Tags()[1], 1000)
+		cache.Refresh()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// MempoolConflict is a pending transaction spending the same source as another
+type MempoolConflict struct {
+	TransactionIdentifier TransactionIdentifier `json:"transaction_identifier"`
+	Reason                string                `json:"reason"` // "same_address" or "same_tag"
+}
+
+// findMempoolConflicts returns the other pending transactions spending the
+// source tag or the source WOTS address of tx. Only one of them can be mined.
+func findMempoolConflicts(mempool []go_mcminterface.TXENTRY, tx go_mcminterface.TXENTRY) []MempoolConflict {
+	conflicts := []MempoolConflict{}
+	source := tx.GetSourceAddress()
+	id := tx.GetID()
+
+	for _, pending := range mempool {
+		if bytes.Equal(pending.GetID(), id) {
+			continue
+		}
+		pendingSource := pending.GetSourceAddress()
+		reason := ""
+		if bytes.Equal(pendingSource.Address[go_mcminterface.TXTAGLEN:], source.Address[go_mcminterface.TXTAGLEN:]) {
+			reason = "same_address"
+		} else if bytes.Equal(pendingSource.GetTAG(), source.GetTAG()) {
+			reason = "same_tag"
+		}
+		if reason != "" {
+			conflicts = append(conflicts, MempoolConflict{
+				TransactionIdentifier: TransactionIdentifier{Hash: fmt.Sprintf("0x%x", pending.GetID())},
+				Reason:                reason,
+			})
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// pendingSpend returns a transaction spending source, made unique by nonce
+func pendingSpend(source go_mcminterface.WotsAddress, nonce uint64) go_mcminterface.TXENTRY {
+	tx := go_mcminterface.NewTXENTRY()
+	tx.SetSignatureScheme("wotsp")
+	tx.SetSourceAddress(source)
+	tx.SetChangeAddress(source)
+	tx.AddDestination(go_mcminterface.NewDSTFromString(strings.Repeat("ab", go_mcminterface.TXTAGLEN), "", 1000))
+	tx.SetSendTotal(1000)
+	tx.SetFee(FAKE_MIN_FEE)
+	tx.SetNonce(nonce)
+	copy(tx.Tlr.ID[:], tx.Hash())
+	return tx
+}
+
+func wotsAddress(tag byte, hash byte) go_mcminterface.WotsAddress {
+	var address go_mcminterface.WotsAddress
+	address.SetTAG([]byte(strings.Repeat(string([]byte{tag}), go_mcminterface.TXTAGLEN)))
+	address.SetAddress([]byte(strings.Repeat(string([]byte{hash}), go_mcminterface.TXADDRLEN-go_mcminterface.TXTAGLEN)))
+	return address
+}
+
+func TestFindMempoolConflicts(t *testing.T) {
+	spend := pendingSpend(wotsAddress(1, 1), 1)
+	sameAddress := pendingSpend(wotsAddress(1, 1), 2)
+	sameTag := pendingSpend(wotsAddress(1, 2), 3)
+	other := pendingSpend(wotsAddress(2, 3), 4)
+	mempool := []go_mcminterface.TXENTRY{spend, sameAddress, sameTag, other}
+
+	conflicts := findMempoolConflicts(mempool, spend)
+	want := map[string]string{
+		fmt.Sprintf("0x%x", sameAddress.GetID()): "same_address",
+		fmt.Sprintf("0x%x", sameTag.GetID()):     "same_tag",
+	}
+	if len(conflicts) != len(want) {
+		t.Fatalf("conflicts %+v, want %v", conflicts, want)
+	}
+	for _, conflict := range conflicts {
+		if want[conflict.TransactionIdentifier.Hash] != conflict.Reason {
+			t.Fatalf("conflict %+v, want %v", conflict, want)
+		}
+	}
+	if conflicts := findMempoolConflicts(mempool, other); len(conflicts) != 0 {
+		t.Fatalf("transaction of another tag conflicts with %+v", conflicts)
+	}
+}
+
+func TestMempoolTransactionConflicts(t *testing.T) {
+	node, server, handler := newTestServer(t, 5)
+	// Both spend the faucet tag, the second from the change of the first
+	first, _ := node.Faucet(node.Tags()[1], 1000)
+	second, err := node.Faucet(node.Tags()[2], 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.mempool.Refresh()
+
+	var response MempoolTransactionResponse
+	code := post(t, handler, "/mempool/transaction", map[string]interface{}{"transaction_identifier": map[string]interface{}{"hash": fmt.Sprintf("0x%x", first.GetID())}}, &response)
+	if code != 0 {
+		t.Fatalf("/mempool/transaction: error %d", code)
+	}
+	conflicts, _ := response.Metadata["conflicts"].([]interface{})
+	if response.Metadata["conflicting"] != true || len(conflicts) != 1 {
+		t.Fatalf("metadata %v, want one conflict", response.Metadata)
+	}
+	conflict := conflicts[0].(map[string]interface{})
+	if conflict["reason"] != "same_tag" || conflict["transaction_identifier"].(map[string]interface{})["hash"] != fmt.Sprintf("0x%x", second.GetID()) {
+		t.Fatalf("conflict %v, want the second faucet transaction", conflict)
+	}
+}
+
+func TestSubmitWarnsOfConflicts(t *testing.T) {
+	node, server, handler := newTestServer(t, 5)
+	first, _ := node.Faucet(node.Tags()[1], 1000)
+	second, err := node.Faucet(node.Tags()[2], 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the later spend of the tag is pending when the first is submitted
+	node.mu.Lock()
+	node.mempool = []go_mcminterface.TXENTRY{second}
+	node.mu.Unlock()
+	server.mempool.Refresh()
+
+	var response ConstructionSubmitResponse
+	if code := post(t, handler, "/construction/submit", map[string]interface{}{"signed_transaction": hex.EncodeToString(first.Bytes())}, &response); code != 0 {
+		t.Fatalf("/construction/submit: error %d", code)
+	}
+	conflicts, _ := response.Metadata["conflicts"].([]interface{})
+	if response.Metadata["warning"] == nil || len(conflicts) != 1 {
+		t.Fatalf("metadata %v, want a warning and one conflict", response.Metadata)
+	}
+
+	// Without pending spends of the tag there is no warning
+	node, server, handler = newTestServer(t, 5)
+	tx, _ := node.Faucet(node.Tags()[1], 1000)
+	node.mu.Lock()
+	node.mempool = nil
+	node.mu.Unlock()
+	server.mempool.Refresh()
+	response = ConstructionSubmitResponse{}
+	if code := post(t, handler, "/construction/submit", map[string]interface{}{"signed_transaction": hex.EncodeToString(tx.Bytes())}, &response); code != 0 || response.Metadata["warning"] != nil {
+		t.Fatalf("/construction/submit without conflicts: error %d, metadata %v", code, response.Metadata)
+	}
+}
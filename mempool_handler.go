@@ -2,10 +2,7 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
-
-	"github.com/NickP005/go_mcminterface"
 )
 
 var TXCLEANFILE_PATH = "mochimo/bin/d/txclean.dat"
@@ -28,7 +25,7 @@ type MempoolResponse struct {
 }
 
 // mempoolHandler handles requests to fetch all transaction identifiers in the mempool.
-func mempoolHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) mempoolHandler(w http.ResponseWriter, r *http.Request) {
 	// Check for the correct network identifier
 	if _, err := checkIdentifier(r); err != nil {
 		mlog(3, "§bmempoolHandler(): §4Wrong network identifier")
@@ -37,7 +34,7 @@ func mempoolHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch transactions from the mempool
-	mempool, err := getMempool(TXCLEANFILE_PATH) // Replace with actual mempool path
+	mempool, err := s.mempool.Snapshot()
 	if err != nil {
 		mlog(3, "§bmempoolHandler(): §4Error reading mempool: §c%s", err)
 		giveError(w, ErrInternalError) // Internal error
@@ -46,9 +43,9 @@ func mempoolHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Create a list of transaction identifiers
 	var txIdentifiers []TransactionIdentifier
-	for _, tx := range mempool {
+	for _, id := range mempool.IDs {
 		txIdentifiers = append(txIdentifiers, TransactionIdentifier{
-			Hash: fmt.Sprintf("0x%x", tx.Tlr.ID[:]),
+			Hash: id,
 		})
 	}
 
@@ -63,7 +60,7 @@ func mempoolHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // mempoolTransactionHandler handles requests to fetch a specific transaction from the mempool.
-func mempoolTransactionHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) mempoolTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	var req MempoolTransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		mlog(3, "§bmempoolTransactionHandler(): §4Error decoding request: §c%s", err)
@@ -71,14 +68,14 @@ func mempoolTransactionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.NetworkIdentifier.Blockchain != "mochimo" || req.NetworkIdentifier.Network != "mainnet" {
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain || req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
 		mlog(3, "§bmempoolTransactionHandler(): §4Wrong network identifier")
 		giveError(w, ErrWrongNetwork) // Wrong network identifier
 		return
 	}
 
 	// Fetch transactions from the mempool
-	mempool, err := getMempool(TXCLEANFILE_PATH) // Replace with actual mempool path
+	mempool, err := s.mempool.Snapshot()
 	if err != nil {
 		mlog(3, "§bmempoolTransactionHandler(): §4Error reading mempool: §c%s", err)
 		giveError(w, ErrInternalError) // Internal error
@@ -86,26 +83,30 @@ func mempoolTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Search for the transaction in the mempool
-	var foundTx *go_mcminterface.TXENTRY
-	for _, tx := range mempool {
-		if fmt.Sprintf("0x%x", tx.Tlr.ID[:]) == req.TransactionIdentifier.Hash {
-			foundTx = &tx
-			break
-		}
-	}
-
-	if foundTx == nil {
+	i, found := mempool.Find(req.TransactionIdentifier.Hash)
+	if !found {
 		mlog(3, "§bmempoolTransactionHandler(): §4Transaction not found")
 		giveError(w, ErrTXNotFound) // Transaction not found error
 		return
 	}
 
-	// Convert the found transaction to the response format
-	transaction := getTransactionsFromBlockBody([]go_mcminterface.TXENTRY{*foundTx}, go_mcminterface.WotsAddress{}, false)[0]
+	// The Rosetta view was derived when the transaction was first seen
+	transaction := mempool.Transactions[i]
+
+	// Flag the other pending spends of the same source
+	conflicts := findMempoolConflicts(mempool.Entries, mempool.Entries[i])
+	if len(conflicts) > 0 {
+		mlog(4, "§bmempoolTransactionHandler(): §6Transaction §6%s§6 conflicts with §e%d§6 pending transactions", req.TransactionIdentifier.Hash, len(conflicts))
+	}
 
 	// Create the response
 	response := MempoolTransactionResponse{
 		Transaction: transaction,
+		Metadata: map[string]interface{}{
+			"conflicting":     len(conflicts) > 0,
+			"conflicts":       conflicts,
+			"pending_seconds": int64(mempool.Age(i).Seconds()),
+		},
 	}
 
 	// Set headers and encode the response as JSON
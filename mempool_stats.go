@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// MEMPOOL_THROUGHPUT_BLOCKS is how many recent blocks the clearing estimate averages
+var MEMPOOL_THROUGHPUT_BLOCKS uint32 = 100
+
+// MempoolStatsRequest is the request structure for the /mempool/stats endpoint
+type MempoolStatsRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+}
+
+// MempoolFeeStats are the fee percentiles of the pending transactions, in nanoMCM
+type MempoolFeeStats struct {
+	Min uint64 `json:"min"`
+	P10 uint64 `json:"p10"`
+	P25 uint64 `json:"p25"`
+	P50 uint64 `json:"p50"`
+	P75 uint64 `json:"p75"`
+	P90 uint64 `json:"p90"`
+	Max uint64 `json:"max"`
+}
+
+// MempoolAgeBucket counts the pending transactions first seen within an age range
+type MempoolAgeBucket struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// MempoolStatsResponse is the response structure for the /mempool/stats endpoint
+type MempoolStatsResponse struct {
+	PendingCount          int                `json:"pending_count"`
+	TotalBytes            int                `json:"total_bytes"`
+	Fees                  MempoolFeeStats    `json:"fees"`
+	Ages                  []MempoolAgeBucket `json:"ages"`
+	OldestSeconds         int64              `json:"oldest_seconds"`
+	DestinationHistogram  map[int]int        `json:"destination_histogram"`
+	AverageBlockTxCount   float64            `json:"average_block_tx_count"`
+	ExpectedBlocksToClear *int64             `json:"expected_blocks_to_clear"`
+}
+
+// mempoolAgeBuckets are the upper bounds of the age buckets, the last one is open
+var mempoolAgeBuckets = []struct {
+	Label string
+	Below time.Duration
+}{
+	{"<1m", time.Minute},
+	{"1m-5m", 5 * time.Minute},
+	{"5m-15m", 15 * time.Minute},
+	{"15m-1h", time.Hour},
+	{">1h", 0},
+}
+
+// feePercentile returns the p-th percentile of sorted fees (nearest rank)
+func feePercentile(fees []uint64, p float64) uint64 {
+	if len(fees) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(fees)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return fees[rank]
+}
+
+// averageBlockTxCount is the mean transaction count of the last blocks in the tfile
+func averageBlockTxCount() (float64, error) {
+	counts, err := readTxCountMap(MEMPOOL_THROUGHPUT_BLOCKS, TFILE_PATH)
+	if err != nil {
+		return 0, err
+	}
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	var total uint64
+	for _, count := range counts {
+		total += uint64(count)
+	}
+	return float64(total) / float64(len(counts)), nil
+}
+
+// mempoolStatsHandler reports how congested the mempool is
+func (s *Server) mempoolStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var req MempoolStatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bmempoolStatsHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bmempoolStatsHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	snapshot, err := s.mempool.Snapshot()
+	if err != nil {
+		mlog(3, "§bmempoolStatsHandler(): §4Error reading mempool: §c%s", err)
+		giveError(w, ErrInternalError)
+		return
+	}
+	mempool := snapshot.Entries
+
+	response := MempoolStatsResponse{
+		PendingCount:         len(mempool),
+		Ages:                 make([]MempoolAgeBucket, len(mempoolAgeBuckets)),
+		DestinationHistogram: make(map[int]int),
+	}
+
+	fees := make([]uint64, 0, len(mempool))
+	for i, tx := range mempool {
+		response.TotalBytes += len(tx.Bytes())
+		fees = append(fees, tx.GetFee())
+		response.DestinationHistogram[len(tx.GetDestinations())]++
+
+		age := snapshot.Age(i)
+		if seconds := int64(age.Seconds()); seconds > response.OldestSeconds {
+			response.OldestSeconds = seconds
+		}
+		for b, bucket := range mempoolAgeBuckets {
+			if bucket.Below == 0 || age < bucket.Below {
+				response.Ages[b].Count++
+				break
+			}
+		}
+	}
+	for b, bucket := range mempoolAgeBuckets {
+		response.Ages[b].Label = bucket.Label
+	}
+
+	sort.Slice(fees, func(i, j int) bool { return fees[i] < fees[j] })
+	if len(fees) > 0 {
+		response.Fees = MempoolFeeStats{
+			Min: fees[0],
+			P10: feePercentile(fees, 0.10),
+			P25: feePercentile(fees, 0.25),
+			P50: feePercentile(fees, 0.50),
+			P75: feePercentile(fees, 0.75),
+			P90: feePercentile(fees, 0.90),
+			Max: fees[len(fees)-1],
+		}
+	}
+
+	// Blocks needed to clear the mempool if blocks keep their recent size,
+	// unknown when recent blocks carried no transactions at all
+	average, err := averageBlockTxCount()
+	if err != nil {
+		mlog(3, "§bmempoolStatsHandler(): §4Error reading tfile: §c%s", err)
+	}
+	response.AverageBlockTxCount = average
+	if average > 0 {
+		blocks := int64(math.Ceil(float64(len(mempool)) / average))
+		response.ExpectedBlocksToClear = &blocks
+	}
+
+	mlog(5, "§bmempoolStatsHandler(): §7Mempool has §e%d§7 transactions, §e%d§7 bytes", response.PendingCount, response.TotalBytes)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestFeePercentile(t *testing.T) {
+	fees := []uint64{100, 200, 300, 400, 500, 600, 700, 800, 900, 1000}
+	tests := []struct {
+		p    float64
+		want uint64
+	}{{0, 100}, {0.10, 100}, {0.25, 300}, {0.50, 500}, {0.90, 900}, {1, 1000}}
+	for _, test := range tests {
+		if got := feePercentile(fees, test.p); got != test.want {
+			t.Errorf("feePercentile(%v) = %d, want %d", test.p, got, test.want)
+		}
+	}
+	if got := feePercentile(nil, 0.5); got != 0 {
+		t.Errorf("feePercentile of no fees = %d", got)
+	}
+}
+
+func TestMempoolStats(t *testing.T) {
+	node, server, handler := newTestServer(t, 5)
+	var bytes int
+	for _, tag := range node.Tags()[1:4] {
+		tx, err := node.Faucet(tag, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bytes += len(tx.Bytes())
+	}
+	server.mempool.Refresh()
+
+	var response MempoolStatsResponse
+	if code := post(t, handler, "/mempool/stats", map[string]interface{}{}, &response); code != 0 {
+		t.Fatalf("/mempool/stats: error %d", code)
+	}
+	if response.PendingCount != 3 || response.TotalBytes != bytes {
+		t.Fatalf("%d pending, %d bytes, want 3 and %d", response.PendingCount, response.TotalBytes, bytes)
+	}
+	if response.Fees.Min != FAKE_MIN_FEE || response.Fees.P50 != FAKE_MIN_FEE || response.Fees.Max != FAKE_MIN_FEE {
+		t.Fatalf("fees %+v", response.Fees)
+	}
+	if len(response.DestinationHistogram) != 1 || response.DestinationHistogram[1] != 3 {
+		t.Fatalf("destination histogram %v", response.DestinationHistogram)
+	}
+	if len(response.Ages) != len(mempoolAgeBuckets) || response.Ages[0].Label != "<1m" || response.Ages[0].Count != 3 {
+		t.Fatalf("ages %+v", response.Ages)
+	}
+
+	// Averaged over the whole short tfile
+	var txs uint32
+	for _, block := range node.blocks {
+		txs += binary.LittleEndian.Uint32(block.Trailer.Tcount[:])
+	}
+	average := float64(txs) / float64(len(node.blocks))
+	if response.AverageBlockTxCount != average {
+		t.Fatalf("average of %v transactions per block, want %v", response.AverageBlockTxCount, average)
+	}
+	if response.ExpectedBlocksToClear == nil || *response.ExpectedBlocksToClear != int64(math.Ceil(3/average)) {
+		t.Fatalf("expected blocks to clear %v, want %v", response.ExpectedBlocksToClear, math.Ceil(3/average))
+	}
+}
+
+func TestMempoolStatsWithoutThroughput(t *testing.T) {
+	node, server, handler := newTestServer(t, 5)
+	if tcount := binary.LittleEndian.Uint32(node.blocks[5].Trailer.Tcount[:]); tcount != 0 {
+		t.Fatalf("block 5 has %d transactions", tcount)
+	}
+	throughput := MEMPOOL_THROUGHPUT_BLOCKS
+	MEMPOOL_THROUGHPUT_BLOCKS = 1
+	t.Cleanup(func() { MEMPOOL_THROUGHPUT_BLOCKS = throughput })
+	node.Faucet(node.Tags()[1], 1000)
+	server.mempool.Refresh()
+
+	var response MempoolStatsResponse
+	if code := post(t, handler, "/mempool/stats", map[string]interface{}{}, &response); code != 0 {
+		t.Fatalf("/mempool/stats: error %d", code)
+	}
+	if response.AverageBlockTxCount != 0 || response.ExpectedBlocksToClear != nil {
+		t.Fatalf("estimate %v blocks from an average of %v, want none", response.ExpectedBlocksToClear, response.AverageBlockTxCount)
+	}
+}
@@ -0,0 +1,80 @@
+// Package merkle checks that a transaction belongs to a block against the
+// Merkle root (mroot) of its trailer, so that light clients and auditors can
+// verify a transaction without trusting mesh.
+//
+// Despite its name the mroot of a Mochimo block is not a tree: the node
+// hashes the block header and every transaction of the block in a single
+// sha256 (bval.c). A proof is therefore the header and the transactions of
+// the block, which the client hashes again, and there are no odd levels or
+// sibling hashes a forged proof could play with.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// V23Trigger is the first block whose Merkle root also covers the header
+const V23Trigger = 0x54321
+
+// Offsets of the fields used from a 160 bytes block trailer
+const (
+	TrailerSize  = 160
+	trailerBnum  = 32
+	trailerTcnt  = 48
+	trailerMroot = 60
+)
+
+// Proof is what the node hashed into the Merkle root of a block
+type Proof struct {
+	Header       []byte   // block header, hashed from V23Trigger on
+	Transactions [][]byte // every transaction of the block, as in the block file
+	Index        int      // position of the proven transaction
+}
+
+// Root computes the Merkle root of a block like the node does
+func Root(bnum uint64, header []byte, transactions [][]byte) [32]byte {
+	h := sha256.New()
+	if bnum >= V23Trigger {
+		h.Write(header)
+	}
+	for _, tx := range transactions {
+		h.Write(tx)
+	}
+	var root [32]byte
+	copy(root[:], h.Sum(nil))
+	return root
+}
+
+// VerifyTrailer checks a proof that the transaction txid is in the block of
+// trailer. The trailer must be one the caller already trusts, read from its
+// own tfile or taken from /blocks/trailers after lightclient validation:
+// it gives the height, the transaction count and the Merkle root.
+func VerifyTrailer(txid []byte, proof Proof, trailer []byte) error {
+	if len(trailer) != TrailerSize {
+		return fmt.Errorf("trailer must be %d bytes, got %d", TrailerSize, len(trailer))
+	}
+	bnum := binary.LittleEndian.Uint64(trailer[trailerBnum : trailerBnum+8])
+	tcount := binary.LittleEndian.Uint32(trailer[trailerTcnt : trailerTcnt+4])
+	if tcount == 0 {
+		return fmt.Errorf("block %d has no transactions", bnum)
+	}
+	if uint64(len(proof.Transactions)) != uint64(tcount) {
+		return fmt.Errorf("proof has %d transactions, block %d has %d", len(proof.Transactions), bnum, tcount)
+	}
+	if proof.Index < 0 || proof.Index >= len(proof.Transactions) {
+		return fmt.Errorf("transaction index %d out of range", proof.Index)
+	}
+	// The transaction ID closes the transaction
+	if len(txid) != 32 || !bytes.HasSuffix(proof.Transactions[proof.Index], txid) {
+		return fmt.Errorf("transaction %d of the proof is not 0x%x", proof.Index, txid)
+	}
+
+	root := Root(bnum, proof.Header, proof.Transactions)
+	if !bytes.Equal(root[:], trailer[trailerMroot:trailerMroot+32]) {
+		return fmt.Errorf("proof does not hash to the Merkle root of block %d", bnum)
+	}
+	return nil
+}
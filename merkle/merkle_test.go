@@ -0,0 +1,97 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// testBlock builds n transactions ending with their ID and the trailer
+// committing to them
+func testBlock(bnum uint64, n int) ([]byte, [][]byte, []byte) {
+	header := bytes.Repeat([]byte{0xAA}, 32)
+	txs := make([][]byte, n)
+	for i := range txs {
+		body := []byte(fmt.Sprintf("transaction %d of block %d", i, bnum))
+		id := sha256.Sum256(body)
+		txs[i] = append(body, id[:]...)
+	}
+	trailer := make([]byte, TrailerSize)
+	binary.LittleEndian.PutUint64(trailer[trailerBnum:], bnum)
+	binary.LittleEndian.PutUint32(trailer[trailerTcnt:], uint32(n))
+	root := Root(bnum, header, txs)
+	copy(trailer[trailerMroot:], root[:])
+	return header, txs, trailer
+}
+
+func txid(tx []byte) []byte { return tx[len(tx)-32:] }
+
+func TestRoot(t *testing.T) {
+	header := []byte("header")
+	txs := [][]byte{[]byte("a"), []byte("b")}
+	if Root(V23Trigger-1, header, txs) != sha256.Sum256([]byte("ab")) {
+		t.Fatal("the root before V23Trigger must only hash the transactions")
+	}
+	if Root(V23Trigger, header, txs) != sha256.Sum256([]byte("headerab")) {
+		t.Fatal("the root from V23Trigger on must hash the header first")
+	}
+}
+
+func TestVerifyTrailer(t *testing.T) {
+	// Odd and even transaction counts, every position
+	for _, n := range []int{1, 2, 3, 5, 8} {
+		for _, bnum := range []uint64{1000, V23Trigger + 1000} {
+			header, txs, trailer := testBlock(bnum, n)
+			for i := 0; i < n; i++ {
+				proof := Proof{Header: header, Transactions: txs, Index: i}
+				if err := VerifyTrailer(txid(txs[i]), proof, trailer); err != nil {
+					t.Errorf("%d transactions, block %d, index %d: %s", n, bnum, i, err)
+				}
+			}
+		}
+	}
+}
+
+func TestVerifyTrailerRejects(t *testing.T) {
+	header, txs, trailer := testBlock(V23Trigger+1, 3)
+	valid := Proof{Header: header, Transactions: txs, Index: 2}
+
+	if err := VerifyTrailer(txid(txs[1]), valid, trailer); err == nil {
+		t.Error("proof of another transaction accepted")
+	}
+	if err := VerifyTrailer(txid(txs[2]), Proof{Header: header, Transactions: txs, Index: 3}, trailer); err == nil {
+		t.Error("index out of range accepted")
+	}
+	if err := VerifyTrailer(txid(txs[2]), valid, trailer[:100]); err == nil {
+		t.Error("short trailer accepted")
+	}
+
+	// CVE-2012-2459: repeating the last transaction must not keep the root
+	duplicated := append(append([][]byte{}, txs...), txs[2])
+	if err := VerifyTrailer(txid(txs[2]), Proof{Header: header, Transactions: duplicated, Index: 3}, trailer); err == nil {
+		t.Error("proof with a duplicated last transaction accepted")
+	}
+	// Even with a trailer claiming the longer count
+	forged := append([]byte{}, trailer...)
+	binary.LittleEndian.PutUint32(forged[trailerTcnt:], 4)
+	if err := VerifyTrailer(txid(txs[2]), Proof{Header: header, Transactions: duplicated, Index: 3}, forged); err == nil {
+		t.Error("duplicated transaction hashed to the same root")
+	}
+
+	tampered := append([][]byte{}, txs...)
+	tampered[0] = append([]byte{'X'}, txs[0][1:]...)
+	if err := VerifyTrailer(txid(txs[2]), Proof{Header: header, Transactions: tampered, Index: 2}, trailer); err == nil {
+		t.Error("proof with a modified sibling transaction accepted")
+	}
+	if err := VerifyTrailer(txid(txs[2]), Proof{Header: []byte("other"), Transactions: txs, Index: 2}, trailer); err == nil {
+		t.Error("proof with another header accepted")
+	}
+
+	// A pseudo-block proves nothing
+	empty := make([]byte, TrailerSize)
+	if err := VerifyTrailer(txid(txs[0]), Proof{Index: 0}, empty); err == nil {
+		t.Error("proof against a block without transactions accepted")
+	}
+}
@@ -100,8 +100,10 @@ func networkStatusHandler(w http.ResponseWriter, r *http.Request) {
 			Hash:  "0x" + hex.EncodeToString(Globals.GenesisBlockHash[:]),
 		},
 		SyncStatus: SyncStatus{
-			Stage:  Globals.LastSyncStage,
-			Synced: Globals.IsSynced,
+			Stage:          Globals.LastSyncStage,
+			Synced:         Globals.IsSynced,
+			Quorum:         getQuorumStatus(),
+			ChainIntegrity: getChainIntegrityStatus(),
 		},
 		HttpsStatus: httpsStatus,
 	}
@@ -160,7 +162,7 @@ func networkOptionsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Define the operation types allowed by the network
-	response.Allow.OperationTypes = []string{"TRANSFER", "REWARD", "FEE"}
+	response.Allow.OperationTypes = []string{"SOURCE_TRANSFER", "DESTINATION_TRANSFER", "CHANGE", "FEE", "REWARD"}
 
 	// Define possible errors that may occur
 	response.Allow.Errors = []struct {
@@ -177,6 +179,9 @@ func networkOptionsHandler(w http.ResponseWriter, r *http.Request) {
 		{6, "Block not found", true},
 		{7, "Wrong curve type", false},
 		{8, "Invalid account format", false},
+		{10, "Node quorum not reached", true},
+		{11, "WOTS+ address already spent", false},
+		{12, "Unauthorized", false},
 	}
 
 	response.Allow.MempoolCoins = false
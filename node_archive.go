@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Folder of the node's block archive, set by the -bcdir flag
+var NODE_BC_PATH = "mochimo/bin/d/bc"
+
+// How many trailers below the tip a hash missing from the block map is
+// looked for in the tfile, set by the -bcdir_scan_depth flag
+var NODE_BC_SCAN_DEPTH uint64 = 20000
+
+// NODE_ARCHIVE reads blocks straight from the node's data folder, nil if unavailable
+var NODE_ARCHIVE *NodeArchive
+
+// NodeArchive is a read-only block source over the node's archived .bc files
+type NodeArchive struct {
+	dir string
+}
+
+// OpenNodeArchive checks that the node's block folder exists
+func OpenNodeArchive(dir string) (*NodeArchive, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder", dir)
+	}
+	return &NodeArchive{dir: dir}, nil
+}
+
+// blockPath returns the archive file name the node uses for a block number
+func (a *NodeArchive) blockPath(bnum uint64) string {
+	return filepath.Join(a.dir, fmt.Sprintf("b%016x.bc", bnum))
+}
+
+// ReadRaw returns the bytes of the archived block file at bnum
+func (a *NodeArchive) ReadRaw(bnum uint64) ([]byte, error) {
+	return os.ReadFile(a.blockPath(bnum))
+}
+
+// GetByNumber reads and verifies the archived block at bnum
+func (a *NodeArchive) GetByNumber(bnum uint64) (go_mcminterface.Block, error) {
+	block_bytes, err := a.ReadRaw(bnum)
+	if err != nil {
+		return go_mcminterface.Block{}, err
+	}
+	block := go_mcminterface.BlockFromBytes(block_bytes)
+	if err := verifyBlock(block, block_bytes); err != nil {
+		return go_mcminterface.Block{}, err
+	}
+	return block, nil
+}
+
+// GetByHash finds the height of a hash in the block map or the tfile and
+// reads the archived block, which must carry that same hash
+func (a *NodeArchive) GetByHash(hexHash string) (go_mcminterface.Block, error) {
+	bnum, ok := blockNumberOfHash(hexHash)
+	if !ok {
+		var err error
+		bnum, err = findBlockNumberInTfile(hexHash, TFILE_PATH, NODE_BC_SCAN_DEPTH)
+		if err != nil {
+			return go_mcminterface.Block{}, err
+		}
+	}
+
+	block, err := a.GetByNumber(uint64(bnum))
+	if err != nil {
+		return go_mcminterface.Block{}, err
+	}
+	if "0x"+hex.EncodeToString(block.Trailer.Bhash[:]) != hexHash {
+		return go_mcminterface.Block{}, fmt.Errorf("archived block %d is not %s", bnum, hexHash)
+	}
+	return block, nil
+}
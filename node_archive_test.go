@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeNodeArchive writes the blocks of node as the node's bc folder
+func writeNodeArchive(t *testing.T, node *FakeNode) string {
+	t.Helper()
+	dir := t.TempDir()
+	for bnum, block := range node.blocks {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("b%016x.bc", bnum)), block.GetBytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFindBlockNumberInTfile(t *testing.T) {
+	node := NewFakeNode(1, 50)
+	tfile := filepath.Join(t.TempDir(), "tfile.dat")
+	if err := node.WriteTfile(tfile); err != nil {
+		t.Fatal(err)
+	}
+	hash := func(bnum int) string { return fmt.Sprintf("0x%x", node.blocks[bnum].Trailer.Bhash[:]) }
+
+	if bnum, err := findBlockNumberInTfile(hash(45), tfile, 10); err != nil || bnum != 45 {
+		t.Fatalf("block 45 within depth 10: got %d, %v", bnum, err)
+	}
+	if _, err := findBlockNumberInTfile(hash(30), tfile, 10); err == nil {
+		t.Fatal("block 30 was found beyond a depth of 10")
+	}
+	if bnum, err := findBlockNumberInTfile(hash(0), tfile, 1000); err != nil || bnum != 0 {
+		t.Fatalf("genesis with a depth past the tfile: got %d, %v", bnum, err)
+	}
+}
+
+func TestNodeArchiveByHash(t *testing.T) {
+	node, server, _ := newTestServer(t, 30)
+	archive, err := OpenNodeArchive(writeNodeArchive(t, node))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := NODE_ARCHIVE
+	NODE_ARCHIVE = archive
+	t.Cleanup(func() { NODE_ARCHIVE = previous })
+
+	// A hash missing from the block map is found in the tfile
+	setBlockMap(map[string]uint32{})
+	hexHash := fmt.Sprintf("0x%x", node.blocks[12].Trailer.Bhash[:])
+	block, err := server.getBlockByHexHash(strings.ToUpper(hexHash[2:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Trailer.Bhash != node.blocks[12].Trailer.Bhash {
+		t.Fatal("getBlockByHexHash() of an uppercase hash returned another block")
+	}
+
+	// The genesis block comes from the archive, the node cannot serve it
+	genesis, err := archive.GetByNumber(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Trailer.Bhash != node.blocks[0].Trailer.Bhash {
+		t.Fatal("GetByNumber(0) is not the genesis block")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// errNodeUnreachable marks a query that got no answer from the node, as
+// opposed to an answer that is an error (an unknown tag, ...)
+var errNodeUnreachable = errors.New("node unreachable")
+
+// isNodeUnreachable tells whether a failed query never reached the node
+func isNodeUnreachable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, errNodeUnreachable) || errors.As(err, &netErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// NodeClient is everything mesh asks to a Mochimo node. Handlers never call
+// go_mcminterface directly: the client is given to NewServer, so that the
+// node can be swapped (quorum reads, the in-memory FakeNode, ...).
+type NodeClient interface {
+	QueryLatestBlockNumber() (uint64, error)
+	QueryBTrailers(start uint32, count uint32) ([]go_mcminterface.BTRAILER, error)
+	QueryLatestBlock() (go_mcminterface.Block, error)
+	QueryBlockFromNumber(bnum uint64) (go_mcminterface.Block, error) // bnum 0 is the genesis block
+	QueryTagResolve(tag []byte) (go_mcminterface.WotsAddress, error)
+	QueryBalance(wotsAddr string) (uint64, error)
+	SubmitTransaction(tx go_mcminterface.TXENTRY) error
+	QueryMempool() ([]go_mcminterface.TXENTRY, error)
+}
+
+// MochimoNodeClient queries the network through go_mcminterface and reads
+// the mempool from the node's txclean.dat
+type MochimoNodeClient struct{}
+
+func (MochimoNodeClient) QueryLatestBlockNumber() (uint64, error) {
+	return go_mcminterface.QueryLatestBlockNumber()
+}
+
+func (MochimoNodeClient) QueryBTrailers(start uint32, count uint32) ([]go_mcminterface.BTRAILER, error) {
+	return go_mcminterface.QueryBTrailers(start, count)
+}
+
+// The node answers the latest block when asked for block 0
+func (MochimoNodeClient) QueryLatestBlock() (go_mcminterface.Block, error) {
+	return go_mcminterface.QueryBlockFromNumber(0)
+}
+
+// QueryBlockFromNumber cannot ask the node for the genesis block, since 0
+// means the latest block to the node. Genesis is read from the node archive.
+func (MochimoNodeClient) QueryBlockFromNumber(bnum uint64) (go_mcminterface.Block, error) {
+	if bnum == 0 {
+		if NODE_ARCHIVE != nil {
+			return NODE_ARCHIVE.GetByNumber(0)
+		}
+		return go_mcminterface.Block{}, fmt.Errorf("the genesis block can only be read from the node archive")
+	}
+	return go_mcminterface.QueryBlockFromNumber(bnum)
+}
+
+func (MochimoNodeClient) QueryTagResolve(tag []byte) (go_mcminterface.WotsAddress, error) {
+	return go_mcminterface.QueryTagResolve(tag)
+}
+
+func (MochimoNodeClient) QueryBalance(wotsAddr string) (uint64, error) {
+	return go_mcminterface.QueryBalance(wotsAddr)
+}
+
+func (MochimoNodeClient) SubmitTransaction(tx go_mcminterface.TXENTRY) error {
+	return go_mcminterface.SubmitTransaction(tx)
+}
+
+func (MochimoNodeClient) QueryMempool() ([]go_mcminterface.TXENTRY, error) {
+	return getMempool(TXCLEANFILE_PATH)
+}
+
+// getBTrailer returns the trailer of a single block from the node
+func getBTrailer(node NodeClient, bnum uint32) (go_mcminterface.BTRAILER, error) {
+	btrailers, err := node.QueryBTrailers(bnum, 1)
+	if err != nil {
+		return go_mcminterface.BTRAILER{}, err
+	}
+	if len(btrailers) == 0 {
+		return go_mcminterface.BTRAILER{}, fmt.Errorf("no trailer returned for block %d", bnum)
+	}
+
+	return btrailers[0], nil
+}
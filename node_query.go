@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// go_mcminterface picks its nodes from the global Settings, which every
+// other query of the server reads. Queries pinned to one node therefore go
+// to a worker process of mesh per node, started on the first query and kept
+// running. A worker gets a copy of the server's Settings pinned to its node
+// and answers one query per line, so the quorum nodes are asked in parallel
+// without touching the server's Settings.
+
+// nodeWorkerEnv holds the node ip of a worker process, which mesh checks
+// before reading its flags
+const nodeWorkerEnv = "MESH_NODE_WORKER"
+
+// nodeQueryPrefix marks the answer lines in the output of a worker
+const nodeQueryPrefix = "NODE_QUERY_ANSWER "
+
+// NodeQuery is a query sent to a single node
+type NodeQuery struct {
+	Op      string `json:"op"` // tip, trailers, tag or balance
+	Start   uint32 `json:"start,omitempty"`
+	Count   uint32 `json:"count,omitempty"`
+	Tag     []byte `json:"tag,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+// NodeAnswer is the answer of a single node
+type NodeAnswer struct {
+	Error       string `json:"error,omitempty"`
+	Unreachable bool   `json:"unreachable,omitempty"` // Error is a connection error
+	Number      uint64 `json:"number,omitempty"`      // tip or balance
+	Trailers    []byte `json:"trailers,omitempty"`    // raw trailers
+	Address     []byte `json:"address,omitempty"`     // resolved WOTS address
+}
+
+// nodeWorker is the worker process of a node. It answers one query at a
+// time and is started again after it died or timed out.
+type nodeWorker struct {
+	ip      string
+	cmd     *exec.Cmd
+	queries io.WriteCloser
+	answers chan NodeAnswer // closed when the worker exits
+	mu      sync.Mutex
+}
+
+var nodeWorkers = struct {
+	byIP map[string]*nodeWorker
+	mu   sync.Mutex
+}{byIP: make(map[string]*nodeWorker)}
+
+// getNodeWorker returns the worker of a node
+func getNodeWorker(ip string) *nodeWorker {
+	nodeWorkers.mu.Lock()
+	defer nodeWorkers.mu.Unlock()
+	worker, ok := nodeWorkers.byIP[ip]
+	if !ok {
+		worker = &nodeWorker{ip: ip}
+		nodeWorkers.byIP[ip] = worker
+	}
+	return worker
+}
+
+// start runs the worker process and sends it the Settings, called with the
+// lock held
+func (n *nodeWorker) start() error {
+	settings, err := json.Marshal(go_mcminterface.Settings)
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(executable)
+	cmd.Env = append(os.Environ(), nodeWorkerEnv+"="+n.ip)
+	queries, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(queries, "%s\n", settings); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	answers := make(chan NodeAnswer)
+	go func() {
+		defer close(answers)
+		scanner := bufio.NewScanner(output)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			if answer, ok := parseNodeAnswer(scanner.Bytes()); ok {
+				answers <- answer
+			}
+		}
+		cmd.Wait()
+	}()
+	n.cmd, n.queries, n.answers = cmd, queries, answers
+	return nil
+}
+
+// stop kills the worker process, called with the lock held
+func (n *nodeWorker) stop() {
+	if n.cmd == nil {
+		return
+	}
+	n.queries.Close()
+	n.cmd.Process.Kill()
+	// Let the reader see the end of the output
+	for range n.answers {
+	}
+	n.cmd, n.queries, n.answers = nil, nil, nil
+}
+
+// ask sends a query to the worker and waits for its answer
+func (n *nodeWorker) ask(query NodeQuery) (NodeAnswer, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.cmd == nil {
+		if err := n.start(); err != nil {
+			return NodeAnswer{}, fmt.Errorf("%w: worker of node %s: %s", errNodeUnreachable, n.ip, err)
+		}
+	}
+	request, err := json.Marshal(query)
+	if err != nil {
+		return NodeAnswer{}, err
+	}
+	if _, err := fmt.Fprintf(n.queries, "%s\n", request); err != nil {
+		n.stop()
+		return NodeAnswer{}, fmt.Errorf("%w: worker of node %s: %s", errNodeUnreachable, n.ip, err)
+	}
+
+	timeout := time.NewTimer(QUORUM_NODE_TIMEOUT)
+	defer timeout.Stop()
+	select {
+	case answer, ok := <-n.answers:
+		if !ok {
+			n.stop()
+			return NodeAnswer{}, fmt.Errorf("%w: worker of node %s exited", errNodeUnreachable, n.ip)
+		}
+		return answer, nil
+	case <-timeout.C:
+		// The answer may still come, the worker is started again
+		n.stop()
+		return NodeAnswer{}, fmt.Errorf("%w: node %s timed out", errNodeUnreachable, n.ip)
+	}
+}
+
+// askNode runs a query on a single node through its worker
+func askNode(ip string, query NodeQuery) (NodeAnswer, error) {
+	answer, err := getNodeWorker(ip).ask(query)
+	if err != nil {
+		return NodeAnswer{}, err
+	}
+	if answer.Unreachable {
+		return NodeAnswer{}, fmt.Errorf("%w: %s", errNodeUnreachable, answer.Error)
+	}
+	if answer.Error != "" {
+		return NodeAnswer{}, errors.New(answer.Error)
+	}
+	return answer, nil
+}
+
+// parseNodeAnswer reads an answer line of a worker. The other lines of its
+// output are logging.
+func parseNodeAnswer(line []byte) (NodeAnswer, bool) {
+	data, ok := bytes.CutPrefix(line, []byte(nodeQueryPrefix))
+	if !ok {
+		return NodeAnswer{}, false
+	}
+	var answer NodeAnswer
+	if err := json.Unmarshal(data, &answer); err != nil {
+		return NodeAnswer{Error: err.Error()}, true
+	}
+	return answer, true
+}
+
+// trailersFromBytes decodes consecutive raw trailers
+func trailersFromBytes(raw []byte) ([]go_mcminterface.BTRAILER, error) {
+	if len(raw)%BTRAILER_SIZE != 0 {
+		return nil, fmt.Errorf("truncated trailers: %d bytes", len(raw))
+	}
+	trailers := make([]go_mcminterface.BTRAILER, len(raw)/BTRAILER_SIZE)
+	if err := binary.Read(bytes.NewReader(raw), binary.LittleEndian, trailers); err != nil {
+		return nil, err
+	}
+	return trailers, nil
+}
+
+// runNodeWorker is the worker process side of askNode: it reads the
+// Settings from in, pins go_mcminterface to ip and answers every query read
+// from in with an answer line on out, until in is closed
+func runNodeWorker(ip string, in io.Reader, out io.Writer) {
+	decoder := json.NewDecoder(in)
+	if err := decoder.Decode(&go_mcminterface.Settings); err != nil {
+		return
+	}
+	go_mcminterface.Settings.StartIPs = []string{ip}
+	go_mcminterface.Settings.ForceQueryStartIPs = true
+
+	for {
+		var query NodeQuery
+		if err := decoder.Decode(&query); err != nil {
+			return
+		}
+		answer := NodeAnswer{}
+		if err := answerNodeQuery(query, &answer); err != nil {
+			answer = NodeAnswer{Error: err.Error(), Unreachable: isNodeUnreachable(err)}
+		}
+		line, _ := json.Marshal(answer)
+		fmt.Fprintf(out, "%s%s\n", nodeQueryPrefix, line)
+	}
+}
+
+func answerNodeQuery(query NodeQuery, answer *NodeAnswer) error {
+	switch query.Op {
+	case "tip":
+		n, err := go_mcminterface.QueryLatestBlockNumber()
+		answer.Number = n
+		return err
+	case "trailers":
+		trailers, err := go_mcminterface.QueryBTrailers(query.Start, query.Count)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := binary.Write(&buf, binary.LittleEndian, trailers); err != nil {
+			return err
+		}
+		answer.Trailers = buf.Bytes()
+		return nil
+	case "tag":
+		address, err := go_mcminterface.QueryTagResolve(query.Tag)
+		if err != nil {
+			return err
+		}
+		answer.Address = address.Address[:]
+		answer.Number = address.GetAmount()
+		return nil
+	case "balance":
+		n, err := go_mcminterface.QueryBalance(query.Address)
+		answer.Number = n
+		return err
+	}
+	return fmt.Errorf("unknown node query %s", strconv.Quote(query.Op))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Confirmations after which a proof may be cached like a block by hash
+const PROOF_CACHE_DEPTH = 100
+
+// BlockTransactionProofResponse is the response structure for the /block/transaction/proof endpoint
+type BlockTransactionProofResponse struct {
+	BlockIdentifier       BlockIdentifier       `json:"block_identifier"`
+	TransactionIdentifier TransactionIdentifier `json:"transaction_identifier"`
+	Index                 int                   `json:"index"`
+	Header                string                `json:"header"`
+	Transactions          []string              `json:"transactions"`
+	MerkleRoot            string                `json:"merkle_root"`
+	Trailer               string                `json:"trailer"`
+}
+
+// blockTransactionProofHandler returns what the Merkle root of the block of a
+// transaction is computed from, along with the block's trailer
+func (s *Server) blockTransactionProofHandler(w http.ResponseWriter, r *http.Request) {
+	var req BlockTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bblockTransactionProofHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bblockTransactionProofHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	// The block is found like for /block and /block/transaction
+	blockData, err := s.getMochimoBlock(req.BlockIdentifier)
+	if err != nil {
+		mlog(3, "§bblockTransactionProofHandler(): §4Error fetching block: §c%s", err)
+		giveError(w, ErrBlockNotFound)
+		return
+	}
+
+	index := -1
+	for i, tx := range blockData.Body {
+		if "0x"+hex.EncodeToString(tx.GetID()) == strings.ToLower(req.TransactionIdentifier.Hash) {
+			index = i
+		}
+	}
+	if index < 0 {
+		mlog(3, "§bblockTransactionProofHandler(): §4Transaction §6%s§7 not found", req.TransactionIdentifier.Hash)
+		giveError(w, ErrTXNotFound)
+		return
+	}
+	proof := blockMerkleProof(blockData, index)
+
+	var trailer bytes.Buffer
+	binary.Write(&trailer, binary.LittleEndian, blockData.Trailer)
+
+	response := BlockTransactionProofResponse{
+		BlockIdentifier: BlockIdentifier{
+			Index: int(binary.LittleEndian.Uint64(blockData.Trailer.Bnum[:])),
+			Hash:  fmt.Sprintf("0x%x", blockData.Trailer.Bhash[:]),
+		},
+		TransactionIdentifier: req.TransactionIdentifier,
+		Index:                 index,
+		Header:                "0x" + hex.EncodeToString(proof.Header),
+		Transactions:          make([]string, len(proof.Transactions)),
+		MerkleRoot:            fmt.Sprintf("0x%x", blockData.Trailer.Mroot[:]),
+		Trailer:               "0x" + hex.EncodeToString(trailer.Bytes()),
+	}
+	for i, tx := range proof.Transactions {
+		response.Transactions[i] = "0x" + hex.EncodeToString(tx)
+	}
+
+	mlog(4, "§bblockTransactionProofHandler(): §7Sending proof of §6%s§7 in block §9%d§7 to §9%s", req.TransactionIdentifier.Hash, response.BlockIdentifier.Index, r.RemoteAddr)
+
+	// A proof never changes once its block is buried, cache it like blocks by
+	// hash. Until then a reorganization can replace the block.
+	if Globals.LatestBlockNum >= uint64(response.BlockIdentifier.Index)+PROOF_CACHE_DEPTH {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", Globals.BLOCK_BYHASH_CACHE_TIME))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
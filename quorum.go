@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// QuorumStatus is reported inside SyncStatus when quorum mode is enabled
+type QuorumStatus struct {
+	Nodes            int    `json:"nodes"`
+	Required         int    `json:"required"`
+	Agreed           bool   `json:"agreed"`
+	Disagreements    uint64 `json:"disagreements"`
+	LastDisagreement string `json:"last_disagreement,omitempty"`
+	LastCheck        int64  `json:"last_check,omitempty"`
+}
+
+var quorumState struct {
+	mu     sync.Mutex
+	status QuorumStatus
+}
+
+var errQuorumNotReached = errors.New("quorum not reached")
+
+// How long a quorum node has to answer a query
+var QUORUM_NODE_TIMEOUT = 30 * time.Second
+
+func quorumEnabled() bool {
+	return Globals.QuorumSize > 1
+}
+
+// quorumNodes returns the nodes that take part in a quorum read
+func quorumNodes() []string {
+	nodes := Globals.QuorumNodes
+	if len(nodes) == 0 {
+		nodes = go_mcminterface.Settings.IPs
+		if len(nodes) == 0 {
+			nodes = go_mcminterface.Settings.StartIPs
+		}
+	}
+	if len(nodes) > Globals.QuorumSize {
+		nodes = nodes[:Globals.QuorumSize]
+	}
+	return nodes
+}
+
+// quorumRequired returns how many nodes must return the same answer
+func quorumRequired(nodes int) int {
+	if Globals.QuorumMin > 0 {
+		return Globals.QuorumMin
+	}
+	return nodes/2 + 1
+}
+
+// checkQuorumFlags rejects a -quorum_min that would let a minority answer win
+func checkQuorumFlags(size int, min int) error {
+	if min == 0 || size <= 1 {
+		return nil
+	}
+	if min <= size/2 {
+		return fmt.Errorf("-quorum_min %d must be more than half of -quorum %d", min, size)
+	}
+	if min > size {
+		return fmt.Errorf("-quorum_min %d is more than the %d nodes of -quorum", min, size)
+	}
+	return nil
+}
+
+// quorumVerdict picks the answer with the most votes. There is no verdict
+// when it has less than required votes or another answer has as many.
+func quorumVerdict(votes map[string][]string, required int) (string, bool) {
+	best, tie := "", false
+	for k, v := range votes {
+		switch {
+		case best == "" || len(v) > len(votes[best]):
+			best, tie = k, false
+		case len(v) == len(votes[best]):
+			tie = true
+		}
+	}
+	if best == "" || tie || len(votes[best]) < required {
+		return best, false
+	}
+	return best, true
+}
+
+// quorumQuery asks the same query to every quorum node at once and returns
+// the answer a majority agrees on. key maps an answer to the value being
+// compared. A node answering with an error (an unknown tag, ...) votes for
+// that error, only unreachable nodes do not vote.
+func quorumQuery[T any](what string, ask func(ip string) (T, error), key func(T) string) (T, error) {
+	var zero T
+	nodes := quorumNodes()
+	required := quorumRequired(len(nodes))
+	if len(nodes) < required {
+		err := fmt.Errorf("%w: %d nodes needed but only %d are known", errQuorumNotReached, required, len(nodes))
+		recordQuorum(len(nodes), required, false, what+": "+err.Error())
+		return zero, err
+	}
+
+	type nodeResult struct {
+		ip     string
+		answer T
+		err    error
+	}
+	results := make(chan nodeResult, len(nodes))
+	for _, ip := range nodes {
+		go func(ip string) {
+			answer, err := ask(ip)
+			results <- nodeResult{ip, answer, err}
+		}(ip)
+	}
+
+	answers := make(map[string]T)
+	errs := make(map[string]error)
+	votes := make(map[string][]string)
+	failed := []string{}
+	for range nodes {
+		result := <-results
+		if result.err != nil && isNodeUnreachable(result.err) {
+			mlog(4, "§bquorumQuery(): §4Node §9%s§4 failed on %s: §c%s", result.ip, what, result.err)
+			failed = append(failed, result.ip)
+			continue
+		}
+		var k string
+		if result.err != nil {
+			k = "error " + strconv.Quote(result.err.Error())
+			errs[k] = result.err
+		} else {
+			k = key(result.answer)
+			answers[k] = result.answer
+		}
+		votes[k] = append(votes[k], result.ip)
+	}
+
+	best, agreed := quorumVerdict(votes, required)
+
+	if len(votes) > 1 {
+		parts := make([]string, 0, len(votes))
+		for k, v := range votes {
+			sort.Strings(v)
+			parts = append(parts, fmt.Sprintf("%s by %s", k, strings.Join(v, ",")))
+		}
+		sort.Strings(parts)
+		detail := fmt.Sprintf("%s: %s", what, strings.Join(parts, " / "))
+		mlog(2, "§bquorumQuery(): §4Nodes disagree on §6%s", detail)
+		recordQuorum(len(nodes), required, agreed, detail)
+		if !agreed {
+			return zero, fmt.Errorf("%w on %s", errQuorumNotReached, what)
+		}
+		return answers[best], errs[best]
+	}
+
+	if !agreed {
+		detail := fmt.Sprintf("%s: only %d of %d nodes answered (failed: %s)", what, len(votes[best]), len(nodes), strings.Join(failed, ","))
+		mlog(2, "§bquorumQuery(): §4Quorum not reached on §6%s", detail)
+		recordQuorum(len(nodes), required, false, detail)
+		if len(votes) == 0 {
+			// No node could be asked at all
+			return zero, fmt.Errorf("%w on %s: %w", errQuorumNotReached, what, errNodeUnreachable)
+		}
+		return zero, fmt.Errorf("%w on %s", errQuorumNotReached, what)
+	}
+
+	recordQuorum(len(nodes), required, true, "")
+	return answers[best], errs[best]
+}
+
+// quorumError maps a failed node query to the API error to return
+func quorumError(err error, fallback APIError) APIError {
+	if errors.Is(err, errQuorumNotReached) {
+		return ErrQuorumNotReached
+	}
+	return fallback
+}
+
+// recordQuorum updates the quorum status shown in /network/status
+func recordQuorum(nodes int, required int, agreed bool, disagreement string) {
+	quorumState.mu.Lock()
+	defer quorumState.mu.Unlock()
+
+	quorumState.status.Nodes = nodes
+	quorumState.status.Required = required
+	quorumState.status.Agreed = agreed
+	quorumState.status.LastCheck = time.Now().UnixMilli()
+	if disagreement != "" {
+		quorumState.status.Disagreements++
+		quorumState.status.LastDisagreement = disagreement
+	}
+}
+
+// getQuorumStatus returns a copy of the quorum status, nil if quorum mode is off
+func getQuorumStatus() *QuorumStatus {
+	if !quorumEnabled() {
+		return nil
+	}
+	quorumState.mu.Lock()
+	defer quorumState.mu.Unlock()
+	status := quorumState.status
+	return &status
+}
+
+// QuorumNodeClient answers tip, trailer, tag and balance queries only when
+// enough nodes agree. Blocks, submits and the mempool go to a single node.
+type QuorumNodeClient struct {
+	MochimoNodeClient
+}
+
+func (q QuorumNodeClient) QueryLatestBlockNumber() (uint64, error) {
+	ask := func(ip string) (uint64, error) {
+		answer, err := askNode(ip, NodeQuery{Op: "tip"})
+		return answer.Number, err
+	}
+	return quorumQuery("latest block number", ask, func(n uint64) string {
+		return strconv.FormatUint(n, 10)
+	})
+}
+
+func (q QuorumNodeClient) QueryBTrailers(start uint32, count uint32) ([]go_mcminterface.BTRAILER, error) {
+	ask := func(ip string) ([]go_mcminterface.BTRAILER, error) {
+		answer, err := askNode(ip, NodeQuery{Op: "trailers", Start: start, Count: count})
+		if err != nil {
+			return nil, err
+		}
+		return trailersFromBytes(answer.Trailers)
+	}
+	return quorumQuery(fmt.Sprintf("trailers %d+%d", start, count), ask, func(t []go_mcminterface.BTRAILER) string {
+		if len(t) == 0 {
+			return "none"
+		}
+		// The last hash commits to the whole range through the parent links
+		return fmt.Sprintf("%d:0x%s", len(t), hex.EncodeToString(t[len(t)-1].Bhash[:]))
+	})
+}
+
+func (q QuorumNodeClient) QueryTagResolve(tag []byte) (go_mcminterface.WotsAddress, error) {
+	ask := func(ip string) (go_mcminterface.WotsAddress, error) {
+		answer, err := askNode(ip, NodeQuery{Op: "tag", Tag: tag})
+		if err != nil {
+			return go_mcminterface.WotsAddress{}, err
+		}
+		var address go_mcminterface.WotsAddress
+		copy(address.Address[:], answer.Address)
+		address.SetAmount(answer.Number)
+		return address, nil
+	}
+	return quorumQuery("tag 0x"+hex.EncodeToString(tag), ask, func(a go_mcminterface.WotsAddress) string {
+		return fmt.Sprintf("0x%x=%d", a.Address, a.GetAmount())
+	})
+}
+
+func (q QuorumNodeClient) QueryBalance(wotsAddr string) (uint64, error) {
+	ask := func(ip string) (uint64, error) {
+		answer, err := askNode(ip, NodeQuery{Op: "balance", Address: wotsAddr})
+		return answer.Number, err
+	}
+	return quorumQuery("balance 0x"+wotsAddr, ask, func(n uint64) string {
+		return strconv.FormatUint(n, 10)
+	})
+}
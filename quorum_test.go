@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+func TestCheckQuorumFlags(t *testing.T) {
+	tests := []struct {
+		size, min int
+		ok        bool
+	}{
+		{3, 0, true},
+		{3, 2, true},
+		{3, 3, true},
+		{3, 1, false},
+		{4, 2, false},
+		{4, 3, true},
+		{3, 4, false},
+		{0, 1, true}, // quorum disabled
+	}
+	for _, test := range tests {
+		err := checkQuorumFlags(test.size, test.min)
+		if (err == nil) != test.ok {
+			t.Errorf("checkQuorumFlags(%d, %d) = %v, want ok %v", test.size, test.min, err, test.ok)
+		}
+	}
+}
+
+func TestQuorumVerdict(t *testing.T) {
+	tests := []struct {
+		name     string
+		votes    map[string][]string
+		required int
+		best     string
+		agreed   bool
+	}{
+		{"unanimous", map[string][]string{"a": {"1", "2", "3"}}, 2, "a", true},
+		{"majority", map[string][]string{"a": {"1", "2"}, "b": {"3"}}, 2, "a", true},
+		{"tie", map[string][]string{"a": {"1", "2"}, "b": {"3", "4"}}, 2, "", false},
+		{"three way tie", map[string][]string{"a": {"1"}, "b": {"2"}, "c": {"3"}}, 1, "", false},
+		{"below required", map[string][]string{"a": {"1"}}, 2, "a", false},
+		{"no answers", map[string][]string{}, 1, "", false},
+	}
+	for _, test := range tests {
+		// Map order is random, run each case a few times
+		for i := 0; i < 20; i++ {
+			best, agreed := quorumVerdict(test.votes, test.required)
+			if agreed != test.agreed || (agreed && best != test.best) {
+				t.Fatalf("%s: quorumVerdict() = %q, %v, want %q, %v", test.name, best, agreed, test.best, test.agreed)
+			}
+		}
+	}
+}
+
+func withQuorumNodes(t *testing.T, nodes []string, min int) {
+	size, required, list := Globals.QuorumSize, Globals.QuorumMin, Globals.QuorumNodes
+	Globals.QuorumSize, Globals.QuorumMin, Globals.QuorumNodes = len(nodes), min, nodes
+	t.Cleanup(func() {
+		Globals.QuorumSize, Globals.QuorumMin, Globals.QuorumNodes = size, required, list
+	})
+}
+
+func TestQuorumQuery(t *testing.T) {
+	key := func(n uint64) string { return fmt.Sprint(n) }
+
+	withQuorumNodes(t, []string{"a", "b", "c"}, 0)
+	answers := map[string]uint64{"a": 7, "b": 7, "c": 8}
+	n, err := quorumQuery("tip", func(ip string) (uint64, error) { return answers[ip], nil }, key)
+	if err != nil || n != 7 {
+		t.Fatalf("majority: got %d, %v, want 7", n, err)
+	}
+
+	// One node down still leaves a majority
+	n, err = quorumQuery("tip", func(ip string) (uint64, error) {
+		if ip == "c" {
+			return 0, errNodeUnreachable
+		}
+		return 7, nil
+	}, key)
+	if err != nil || n != 7 {
+		t.Fatalf("one failure: got %d, %v, want 7", n, err)
+	}
+
+	// A tie is a disagreement even when it meets -quorum_min
+	withQuorumNodes(t, []string{"a", "b", "c", "d"}, 0)
+	answers = map[string]uint64{"a": 7, "b": 7, "c": 8, "d": 8}
+	for i := 0; i < 20; i++ {
+		_, err = quorumQuery("tip", func(ip string) (uint64, error) { return answers[ip], nil }, key)
+		if !errors.Is(err, errQuorumNotReached) {
+			t.Fatalf("tie: got %v, want errQuorumNotReached", err)
+		}
+	}
+	if status := getQuorumStatus(); status == nil || status.Agreed {
+		t.Fatalf("tie: quorum status %+v should not be agreed", status)
+	}
+}
+
+func TestParseNodeAnswer(t *testing.T) {
+	if answer, ok := parseNodeAnswer([]byte(nodeQueryPrefix + `{"number":42}`)); !ok || answer.Number != 42 {
+		t.Fatalf("parseNodeAnswer() = %+v, %v", answer, ok)
+	}
+	if _, ok := parseNodeAnswer([]byte("some log line")); ok {
+		t.Fatal("log line parsed as an answer")
+	}
+	if answer, ok := parseNodeAnswer([]byte(nodeQueryPrefix + "{")); !ok || answer.Error == "" {
+		t.Fatalf("broken answer line: %+v, %v", answer, ok)
+	}
+}
+
+// The test binary runs as the worker, see TestMain
+func TestNodeWorker(t *testing.T) {
+	port, timeout := go_mcminterface.Settings.DefaultPort, QUORUM_NODE_TIMEOUT
+	go_mcminterface.Settings.DefaultPort = 1 // nothing listens there
+	t.Cleanup(func() {
+		go_mcminterface.Settings.DefaultPort, QUORUM_NODE_TIMEOUT = port, timeout
+		worker := getNodeWorker("127.0.0.1")
+		worker.mu.Lock()
+		worker.stop()
+		worker.mu.Unlock()
+	})
+
+	// One worker answers every query of its node
+	if _, err := askNode("127.0.0.1", NodeQuery{Op: "tip"}); err == nil {
+		t.Fatal("tip of a node that is not running")
+	}
+	worker := getNodeWorker("127.0.0.1")
+	pid := worker.cmd.Process.Pid
+	if _, err := askNode("127.0.0.1", NodeQuery{Op: "balance", Address: "00"}); err == nil {
+		t.Fatal("balance on a node that is not running")
+	}
+	if _, err := askNode("127.0.0.1", NodeQuery{Op: "nonce"}); err == nil || isNodeUnreachable(err) {
+		t.Fatalf("unknown query: %v, want an answer of the worker", err)
+	}
+	if worker.cmd == nil || worker.cmd.Process.Pid != pid {
+		t.Fatal("worker started again between queries")
+	}
+
+	// A worker that does not answer in time is replaced
+	QUORUM_NODE_TIMEOUT = time.Nanosecond
+	if _, err := askNode("127.0.0.1", NodeQuery{Op: "tip"}); !isNodeUnreachable(err) {
+		t.Fatalf("timed out query: %v, want an unreachable node", err)
+	}
+	if worker.cmd != nil {
+		t.Fatal("worker kept after a timeout")
+	}
+	QUORUM_NODE_TIMEOUT = timeout
+	if _, err := askNode("127.0.0.1", NodeQuery{Op: "nonce"}); err == nil || isNodeUnreachable(err) {
+		t.Fatalf("query after a timeout: %v, want an answer of a new worker", err)
+	}
+}
+
+func TestTrailersFromBytes(t *testing.T) {
+	trailers := make([]go_mcminterface.BTRAILER, 3)
+	for i := range trailers {
+		binary.LittleEndian.PutUint64(trailers[i].Bnum[:], uint64(i+10))
+		trailers[i].Bhash[0] = byte(i)
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, trailers); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := trailersFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 3 || decoded[2] != trailers[2] {
+		t.Fatalf("trailersFromBytes() = %v, want %v", decoded, trailers)
+	}
+	if _, err := trailersFromBytes(buf.Bytes()[:100]); err == nil {
+		t.Fatal("trailersFromBytes() of a truncated trailer should fail")
+	}
+}
+
+func TestQuorumQueryErrorAnswers(t *testing.T) {
+	key := func(n uint64) string { return fmt.Sprint(n) }
+	notFound := errors.New("tag not found")
+	withQuorumNodes(t, []string{"a", "b", "c"}, 0)
+	query := func(answers map[string]error) (uint64, error) {
+		return quorumQuery("tag", func(ip string) (uint64, error) {
+			if answers[ip] != nil {
+				return 0, answers[ip]
+			}
+			return 7, nil
+		}, key)
+	}
+
+	// Agreeing that the tag is unknown is an answer, not a disagreement
+	_, err := query(map[string]error{"a": notFound, "b": notFound, "c": errNodeUnreachable})
+	if err != notFound {
+		t.Fatalf("majority not found: got %v, want %v", err, notFound)
+	}
+	_, err = query(map[string]error{"a": notFound, "c": errNodeUnreachable})
+	if !errors.Is(err, errQuorumNotReached) || isNodeUnreachable(err) {
+		t.Fatalf("split answers: got %v, want a disagreement", err)
+	}
+	_, err = query(map[string]error{"a": errNodeUnreachable, "b": errNodeUnreachable, "c": errNodeUnreachable})
+	if !errors.Is(err, errQuorumNotReached) || !isNodeUnreachable(err) {
+		t.Fatalf("every node down: got %v, want an unreachable quorum", err)
+	}
+}
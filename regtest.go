@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Regtest settings, set by the -regtest_* flags
+var REGTEST_BLOCK_TIME time.Duration = 15 * time.Second
+var REGTEST_HEIGHT uint64 = 100
+var REGTEST_SEED int64 = 1
+
+const REGTEST_FAUCET_AMOUNT = 10000000000 // 10 MCM
+
+// REGTEST_NODE is the simulated node used in -regtest mode
+var REGTEST_NODE *FakeNode
+
+// regtestMu serializes mining so the tfile always matches the chain
+var regtestMu sync.Mutex
+
+// InitRegtest builds the simulated chain that replaces the node and writes its tfile
+func InitRegtest() error {
+	mlog(2, "§bInitRegtest(): §7Building simulated chain of §e%d§7 blocks (seed §e%d§7)", REGTEST_HEIGHT, REGTEST_SEED)
+	REGTEST_NODE = NewFakeNode(REGTEST_SEED, REGTEST_HEIGHT)
+
+	if err := os.MkdirAll(filepath.Dir(TFILE_PATH), 0755); err != nil {
+		return err
+	}
+	if err := REGTEST_NODE.WriteTfile(TFILE_PATH); err != nil {
+		return err
+	}
+	mlog(2, "§bInitRegtest(): §7Simulated tfile written to §8%s", TFILE_PATH)
+
+	for i, tag := range REGTEST_NODE.Tags() {
+		mlog(4, "§bInitRegtest(): §7Funded tag #%d: §60x%s", i, hex.EncodeToString(tag))
+	}
+
+	if REGTEST_BLOCK_TIME > 0 {
+		go func() {
+			ticker := time.NewTicker(REGTEST_BLOCK_TIME)
+			defer ticker.Stop()
+			for range ticker.C {
+				if _, err := regtestMine(1); err != nil {
+					mlog(2, "§bInitRegtest(): §4Error mining block: §c%s", err)
+				}
+			}
+		}()
+	}
+
+	return nil
+}
+
+// regtestMine mines count blocks and rewrites the tfile. The sync loop picks
+// up the new tip on its next refresh, like it does with a real node.
+func regtestMine(count int) ([]go_mcminterface.Block, error) {
+	regtestMu.Lock()
+	defer regtestMu.Unlock()
+
+	blocks := make([]go_mcminterface.Block, 0, count)
+	for i := 0; i < count; i++ {
+		block := REGTEST_NODE.MineBlock()
+		mlog(3, "§bregtestMine(): §7Mined block §e%d§7 with §e%d§7 transactions",
+			binary.LittleEndian.Uint64(block.Trailer.Bnum[:]), len(block.Body))
+		blocks = append(blocks, block)
+	}
+
+	return blocks, REGTEST_NODE.WriteTfile(TFILE_PATH)
+}
+
+// RegtestMineRequest is the request structure for the /regtest/mine endpoint
+type RegtestMineRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	Blocks            int               `json:"blocks,omitempty"`
+}
+
+// RegtestMineResponse is the response structure for the /regtest/mine endpoint
+type RegtestMineResponse struct {
+	BlockIdentifiers []BlockIdentifier `json:"block_identifiers"`
+}
+
+// regtestMineHandler mines blocks on demand
+func regtestMineHandler(w http.ResponseWriter, r *http.Request) {
+	var req RegtestMineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bregtestMineHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bregtestMineHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	count := 1
+	if req.Blocks > 0 && req.Blocks <= 100 {
+		count = req.Blocks
+	}
+
+	blocks, err := regtestMine(count)
+	if err != nil {
+		mlog(3, "§bregtestMineHandler(): §4Error mining: §c%s", err)
+		giveError(w, ErrInternalError)
+		return
+	}
+
+	response := RegtestMineResponse{
+		BlockIdentifiers: make([]BlockIdentifier, 0, len(blocks)),
+	}
+	for _, block := range blocks {
+		response.BlockIdentifiers = append(response.BlockIdentifiers, BlockIdentifier{
+			Index: int(binary.LittleEndian.Uint64(block.Trailer.Bnum[:])),
+			Hash:  fmt.Sprintf("0x%x", block.Trailer.Bhash[:]),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RegtestFaucetRequest is the request structure for the /regtest/faucet endpoint
+type RegtestFaucetRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	AccountIdentifier AccountIdentifier `json:"account_identifier"`
+	Amount            *Amount           `json:"amount,omitempty"`
+}
+
+// regtestFaucetHandler queues a transfer from the simulated miner to an account
+func regtestFaucetHandler(w http.ResponseWriter, r *http.Request) {
+	var req RegtestFaucetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bregtestFaucetHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bregtestFaucetHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	if len(req.AccountIdentifier.Address) != go_mcminterface.TXTAGLEN*2+2 {
+		mlog(3, "§bregtestFaucetHandler(): §4Invalid account format")
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+	tag, err := hex.DecodeString(req.AccountIdentifier.Address[2:])
+	if err != nil {
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+
+	var amount uint64 = REGTEST_FAUCET_AMOUNT
+	if req.Amount != nil {
+		amount, err = strconv.ParseUint(req.Amount.Value, 10, 64)
+		if err != nil {
+			giveError(w, ErrInvalidRequest)
+			return
+		}
+	}
+
+	tx, err := REGTEST_NODE.Faucet(tag, amount)
+	if err != nil {
+		mlog(3, "§bregtestFaucetHandler(): §4Faucet error: §c%s", err)
+		giveError(w, ErrInternalError)
+		return
+	}
+	mlog(3, "§bregtestFaucetHandler(): §7Queued §e%d§7 to §6%s", amount, req.AccountIdentifier.Address)
+
+	response := TransactionIdentifierResponse{
+		TransactionIdentifier: TransactionIdentifier{
+			Hash: fmt.Sprintf("0x%x", tx.GetID()),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
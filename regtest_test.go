@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+func TestFakeNodeDeterministic(t *testing.T) {
+	a, _ := NewFakeNode(7, 30).QueryLatestBlock()
+	b, _ := NewFakeNode(7, 30).QueryLatestBlock()
+	if a.Trailer.Bhash != b.Trailer.Bhash {
+		t.Fatal("the same seed built two different chains")
+	}
+	c, _ := NewFakeNode(8, 30).QueryLatestBlock()
+	if a.Trailer.Bhash == c.Trailer.Bhash {
+		t.Fatal("two seeds built the same chain")
+	}
+}
+
+func TestRegtestFaucetAndMine(t *testing.T) {
+	height, blockTime, tfilePath, regtest, online := REGTEST_HEIGHT, REGTEST_BLOCK_TIME, TFILE_PATH, Globals.Regtest, Globals.OnlineMode
+	REGTEST_HEIGHT, REGTEST_BLOCK_TIME, TFILE_PATH = 10, 0, filepath.Join(t.TempDir(), "d", "tfile.dat")
+	Globals.Regtest, Globals.OnlineMode = true, true
+	t.Cleanup(func() {
+		REGTEST_HEIGHT, REGTEST_BLOCK_TIME, TFILE_PATH = height, blockTime, tfilePath
+		Globals.Regtest, Globals.OnlineMode = regtest, online
+	})
+
+	if err := InitRegtest(); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewServer(REGTEST_NODE).Router()
+
+	tag := "0x" + hex.EncodeToString(REGTEST_NODE.Tags()[3])
+	var queued TransactionIdentifierResponse
+	code := post(t, handler, "/regtest/faucet", map[string]interface{}{
+		"account_identifier": map[string]interface{}{"address": tag},
+		"amount":             map[string]interface{}{"value": "12345"},
+	}, &queued)
+	if code != 0 {
+		t.Fatalf("/regtest/faucet: error %d", code)
+	}
+
+	var mined RegtestMineResponse
+	if code := post(t, handler, "/regtest/mine", map[string]interface{}{"blocks": 2}, &mined); code != 0 {
+		t.Fatalf("/regtest/mine: error %d", code)
+	}
+	if len(mined.BlockIdentifiers) != 2 || mined.BlockIdentifiers[0].Index != 11 || mined.BlockIdentifiers[1].Index != 12 {
+		t.Fatalf("/regtest/mine returned %+v, want blocks 11 and 12", mined.BlockIdentifiers)
+	}
+
+	// The tfile follows the simulated chain
+	trailer, err := readTfileTrailer(12, TFILE_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := "0x" + hex.EncodeToString(trailer.Bhash[:]); hash != mined.BlockIdentifiers[1].Hash {
+		t.Fatalf("tfile trailer 12 is %s, want %s", hash, mined.BlockIdentifiers[1].Hash)
+	}
+
+	block, err := REGTEST_NODE.QueryBlockFromNumber(11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, tx := range block.Body {
+		found = found || "0x"+hex.EncodeToString(tx.GetID()) == queued.TransactionIdentifier.Hash
+	}
+	if !found {
+		t.Fatalf("block %d does not include the faucet transaction", binary.LittleEndian.Uint64(block.Trailer.Bnum[:]))
+	}
+}
+
+func TestFakeNodeTransfers(t *testing.T) {
+	node := NewFakeNode(1, 5)
+	tags := node.Tags()
+	balance := node.pendingBalance(tags[0])
+
+	if _, err := node.NewTransfer(tags[0], tags[1], balance, FAKE_MIN_FEE); err == nil {
+		t.Fatal("transfer of more than the balance built")
+	}
+	tx, err := node.NewTransfer(tags[0], tags[1], 1000, FAKE_MIN_FEE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.GetChangeTotal() != balance-1000-FAKE_MIN_FEE || !isSigned(tx) {
+		t.Fatalf("transfer with a change of %d, signed %v", tx.GetChangeTotal(), isSigned(tx))
+	}
+
+	// Without its signature data the node refuses it
+	raw := tx.Bytes()
+	copy(raw[len(raw)-40-txSignatureSize:len(raw)-40], make([]byte, txSignatureSize))
+	if err := node.SubmitTransaction(go_mcminterface.TransactionFromBytes(raw)); err == nil {
+		t.Fatal("unsigned transaction accepted")
+	}
+	if err := node.SubmitTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -170,13 +170,18 @@ func searchTransactionsHandler(w http.ResponseWriter, r *http.Request) {
 				address = "0x" + hex.EncodeToString(decoded[:len(decoded)-2])
 			}
 
+			var related []OperationIdentifier
+			for _, rel := range op.RelatedOperations {
+				related = append(related, OperationIdentifier{Index: rel.Index})
+			}
 			btx.Operations = append(btx.Operations, Operation{
 				OperationIdentifier: OperationIdentifier{
 					Index: op.OperationIdentifier.Index,
 				},
-				Type:    op.Type,
-				Status:  op.Status,
-				Account: AccountIdentifier{Address: address},
+				RelatedOperations: related,
+				Type:              op.Type,
+				Status:            op.Status,
+				Account:           labeledAccountHex(address),
 				Amount: Amount{
 					Value: op.Amount.Value,
 					Currency: Currency{
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/gorilla/mux"
+)
+
+// Server serves the mesh API on top of a node client. Everything that talks
+// to the node hangs off Server, so that tests and -regtest can run mesh
+// against a FakeNode.
+type Server struct {
+	node    NodeClient
+	mempool *MempoolCache
+}
+
+// NewServer returns a server answering from node
+func NewServer(node NodeClient) *Server {
+	return &Server{
+		node:    node,
+		mempool: NewMempoolCache(node),
+	}
+}
+
+// Router returns the routes enabled by the current settings
+func (s *Server) Router() *mux.Router {
+	r := mux.NewRouter()
+
+	r.Use(corsMiddleware)
+	r.Use(maxRequestSizeMiddleware) // Add the new middleware
+
+	r.HandleFunc("/network/options", networkOptionsHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/network/list", networkListHandler).Methods("POST", "OPTIONS")
+	// Served from the tfile
+	r.HandleFunc("/blocks/trailers", trailersHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/blocks/tfile", tfileHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/labels", labelsHandler).Methods("POST", "OPTIONS")
+	if LABELS_ADMIN_TOKEN != "" {
+		r.HandleFunc("/admin/labels/set", labelsSetHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/admin/labels/delete", labelsDeleteHandler).Methods("POST", "OPTIONS")
+	}
+
+	if Globals.OnlineMode {
+		r.HandleFunc("/block", s.blockHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/block/transaction", s.blockTransactionHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/block/transaction/proof", s.blockTransactionProofHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/blocks", s.blocksHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/network/status", networkStatusHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/mempool", s.mempoolHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/mempool/transaction", s.mempoolTransactionHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/mempool/stats", s.mempoolStatsHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/account/balance", s.accountBalanceHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/call", s.callHandler).Methods("POST", "OPTIONS")
+	}
+
+	r.HandleFunc("/construction/derive", constructionDeriveHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/construction/preprocess", s.constructionPreprocessHandler).Methods("POST", "OPTIONS")
+	if Globals.OnlineMode {
+		r.HandleFunc("/construction/metadata", s.constructionMetadataHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/construction/payloads", constructionPayloadsHandler).Methods("POST", "OPTIONS")
+	}
+	r.HandleFunc("/construction/parse", constructionParseHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/construction/combine", constructionCombineHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/construction/hash", constructionHashHandler).Methods("POST", "OPTIONS")
+	if Globals.OnlineMode {
+		r.HandleFunc("/construction/submit", s.constructionSubmitHandler).Methods("POST", "OPTIONS")
+	}
+
+	if Globals.Regtest {
+		r.HandleFunc("/regtest/mine", regtestMineHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/regtest/faucet", regtestFaucetHandler).Methods("POST", "OPTIONS")
+	}
+
+	if Globals.EnableIndexer {
+		mlog(2, "§bRouter(): §2Indexer enabled, adding indexer routes")
+		r.HandleFunc("/search/transactions", searchTransactionsHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/events/blocks", eventsBlocksHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/account/lineage", accountLineageHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/wots/reuse", wotsReuseHandler).Methods("POST", "OPTIONS")
+	}
+
+	// Add statistics routes if ledger path is specified
+	if Globals.LedgerPath != "" {
+		mlog(2, "§bRouter(): §2Ledger path specified, adding statistics routes")
+		r.HandleFunc("/stats/richlist", richlistHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/stats/distribution", distributionHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/stats/ledger/changes", ledgerChangesHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/stats/ledger/snapshots", ledgerSnapshotsHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/stats/rank", rankHandler).Methods("POST", "OPTIONS")
+		r.HandleFunc("/stats/supply", supplyHandler).Methods("POST", "OPTIONS")
+		if !Globals.OnlineMode {
+			// Balances come from the ledger snapshot only
+			r.HandleFunc("/account/balance", s.accountBalanceHandler).Methods("POST", "OPTIONS")
+		}
+	}
+
+	return r
+}
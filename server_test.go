@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mochimo-mesh/merkle"
+)
+
+// newTestServer runs the online routes of mesh against a FakeNode of the
+// given height, with a tfile written from the same chain
+func newTestServer(t *testing.T, height uint64) (*FakeNode, *Server, http.Handler) {
+	t.Helper()
+	node := NewFakeNode(1, height)
+
+	tfile := filepath.Join(t.TempDir(), "tfile.dat")
+	if err := node.WriteTfile(tfile); err != nil {
+		t.Fatal(err)
+	}
+	online, tfilePath, mempoolPath, latest := Globals.OnlineMode, TFILE_PATH, TXCLEANFILE_PATH, Globals.LatestBlockNum
+	Globals.OnlineMode, TFILE_PATH, TXCLEANFILE_PATH = true, tfile, filepath.Join(t.TempDir(), "txclean.dat")
+	t.Cleanup(func() {
+		Globals.OnlineMode, TFILE_PATH, TXCLEANFILE_PATH, Globals.LatestBlockNum = online, tfilePath, mempoolPath, latest
+	})
+
+	// What Sync() reads from the tfile, without its background refreshes
+	blockmap, err := readBlockMap(5000, tfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setBlockMap(blockmap)
+
+	server := NewServer(node)
+	return node, server, server.Router()
+}
+
+// post sends body to path and decodes the answer into out. It returns the
+// code of the API error, 0 on success.
+func post(t *testing.T, handler http.Handler, path string, body map[string]interface{}, out interface{}) int {
+	t.Helper()
+	body["network_identifier"] = Constants.NetworkIdentifier
+	request, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serve(t, handler, path, request, out)
+}
+
+func serve(t *testing.T, handler http.Handler, path string, request []byte, out interface{}) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(request)))
+	return decodeAnswer(t, recorder, path, out)
+}
+
+func decodeAnswer(t *testing.T, recorder *httptest.ResponseRecorder, path string, out interface{}) int {
+	t.Helper()
+	var apiError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	answer := recorder.Body.Bytes()
+	if err := json.Unmarshal(answer, &apiError); err == nil && apiError.Message != "" {
+		return apiError.Code
+	}
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("%s: status %d", path, recorder.Code)
+	}
+	if out != nil {
+		if err := json.Unmarshal(answer, out); err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+	}
+	return 0
+}
+
+func TestFakeNodeGenesis(t *testing.T) {
+	node := NewFakeNode(1, 10)
+	genesis, err := node.QueryBlockFromNumber(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bnum := binary.LittleEndian.Uint64(genesis.Trailer.Bnum[:]); bnum != 0 {
+		t.Fatalf("QueryBlockFromNumber(0) returned block %d, want the genesis block", bnum)
+	}
+	latest, err := node.QueryLatestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bnum := binary.LittleEndian.Uint64(latest.Trailer.Bnum[:]); bnum != 10 {
+		t.Fatalf("QueryLatestBlock() returned block %d, want 10", bnum)
+	}
+	if _, err := node.QueryBlockFromNumber(11); err == nil {
+		t.Fatal("QueryBlockFromNumber() past the tip should fail")
+	}
+}
+
+func TestGetBlockByNumberGenesis(t *testing.T) {
+	_, server, _ := newTestServer(t, 10)
+	block, err := server.getBlockByNumber(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bnum := binary.LittleEndian.Uint64(block.Trailer.Bnum[:]); bnum != 0 {
+		t.Fatalf("getBlockByNumber(0) returned block %d", bnum)
+	}
+}
+
+func TestBlockHandler(t *testing.T) {
+	node, _, handler := newTestServer(t, 20)
+
+	var response BlockResponse
+	code := post(t, handler, "/block", map[string]interface{}{"block_identifier": map[string]interface{}{"index": 5}}, &response)
+	if code != 0 {
+		t.Fatalf("/block index 5: status %d", code)
+	}
+	want, _ := node.QueryBlockFromNumber(5)
+	if response.Block.BlockIdentifier.Index != 5 || response.Block.BlockIdentifier.Hash != fmt.Sprintf("0x%x", want.Trailer.Bhash[:]) {
+		t.Fatalf("/block index 5 returned %+v", response.Block.BlockIdentifier)
+	}
+	// The miner reward comes first as a transaction of its own
+	if len(response.Block.Transactions) != len(want.Body)+1 || response.Block.Transactions[0].Operations[0].Type != "REWARD" {
+		t.Fatalf("/block index 5 has %d transactions, want the reward and %d", len(response.Block.Transactions), len(want.Body))
+	}
+
+	// By hash, then the tip when no identifier is given
+	code = post(t, handler, "/block", map[string]interface{}{"block_identifier": map[string]interface{}{"hash": response.Block.BlockIdentifier.Hash}}, &response)
+	if code != 0 || response.Block.BlockIdentifier.Index != 5 {
+		t.Fatalf("/block by hash: status %d, block %+v", code, response.Block.BlockIdentifier)
+	}
+	code = post(t, handler, "/block", map[string]interface{}{"block_identifier": map[string]interface{}{}}, &response)
+	if code != 0 || response.Block.BlockIdentifier.Index != 20 {
+		t.Fatalf("/block latest: status %d, block %+v", code, response.Block.BlockIdentifier)
+	}
+
+	if code := post(t, handler, "/block", map[string]interface{}{"block_identifier": map[string]interface{}{"index": 21}}, nil); code == 0 {
+		t.Fatal("/block past the tip should fail")
+	}
+}
+
+func TestBlockHandlerWrongNetwork(t *testing.T) {
+	_, _, handler := newTestServer(t, 5)
+	request := []byte(`{"network_identifier":{"blockchain":"bitcoin","network":"mainnet"},"block_identifier":{"index":1}}`)
+	if code := serve(t, handler, "/block", request, nil); code != ErrWrongNetwork.Code {
+		t.Fatalf("/block with a foreign network identifier: error %d, want %d", code, ErrWrongNetwork.Code)
+	}
+}
+
+func TestMempoolHandlers(t *testing.T) {
+	node, server, handler := newTestServer(t, 5)
+	tx, err := node.Faucet(node.Tags()[0], 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.mempool.Refresh()
+	id := "0x" + hex.EncodeToString(tx.GetID())
+
+	var mempool MempoolResponse
+	if code := post(t, handler, "/mempool", map[string]interface{}{}, &mempool); code != 0 {
+		t.Fatalf("/mempool: status %d", code)
+	}
+	found := false
+	for _, identifier := range mempool.TransactionIdentifiers {
+		found = found || identifier.Hash == id
+	}
+	if !found {
+		t.Fatalf("/mempool does not list the faucet transaction %s: %+v", id, mempool.TransactionIdentifiers)
+	}
+
+	var transaction MempoolTransactionResponse
+	code := post(t, handler, "/mempool/transaction", map[string]interface{}{"transaction_identifier": map[string]interface{}{"hash": id}}, &transaction)
+	if code != 0 || transaction.Transaction.TransactionIdentifier.Hash != id {
+		t.Fatalf("/mempool/transaction: status %d, transaction %+v", code, transaction.Transaction.TransactionIdentifier)
+	}
+}
+
+func TestBlockTransactionProofHandler(t *testing.T) {
+	node, _, handler := newTestServer(t, 20)
+	block, _ := node.QueryBlockFromNumber(6)
+	if len(block.Body) == 0 {
+		t.Fatal("block 6 of the fake chain has no transactions")
+	}
+	tx := block.Body[len(block.Body)-1]
+	id := "0x" + hex.EncodeToString(tx.GetID())
+
+	request := func(blockIdentifier map[string]interface{}, id string) (BlockTransactionProofResponse, int, string) {
+		body, _ := json.Marshal(map[string]interface{}{
+			"network_identifier":     Constants.NetworkIdentifier,
+			"block_identifier":       blockIdentifier,
+			"transaction_identifier": map[string]interface{}{"hash": id},
+		})
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/block/transaction/proof", bytes.NewReader(body)))
+		var response BlockTransactionProofResponse
+		code := decodeAnswer(t, recorder, "/block/transaction/proof", &response)
+		return response, code, recorder.Header().Get("Cache-Control")
+	}
+
+	Globals.LatestBlockNum = 20
+	response, code, cache := request(map[string]interface{}{"index": 6}, id)
+	if code != 0 {
+		t.Fatalf("/block/transaction/proof: error %d", code)
+	}
+	if cache != "no-cache" {
+		t.Fatalf("proof of a block with 14 confirmations cached: %q", cache)
+	}
+
+	// Checked against the trailer of the tfile, not the one of the response
+	trusted, err := readTfileTrailer(6, TFILE_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof := merkle.Proof{Index: response.Index}
+	proof.Header, _ = hex.DecodeString(response.Header[2:])
+	for _, tx := range response.Transactions {
+		raw, _ := hex.DecodeString(tx[2:])
+		proof.Transactions = append(proof.Transactions, raw)
+	}
+	if err := merkle.VerifyTrailer(tx.GetID(), proof, trusted.Bytes()); err != nil {
+		t.Fatalf("proof does not verify: %s", err)
+	}
+
+	Globals.LatestBlockNum = 6 + PROOF_CACHE_DEPTH
+	if _, _, cache := request(map[string]interface{}{"index": 6}, id); cache == "no-cache" {
+		t.Fatal("proof of a buried block not cached")
+	}
+
+	// By hash, and index 0 is the tip like for /block
+	if response, code, _ := request(map[string]interface{}{"hash": fmt.Sprintf("0x%x", block.Trailer.Bhash[:])}, id); code != 0 || response.BlockIdentifier.Index != 6 {
+		t.Fatalf("proof by hash: error %d in block %d", code, response.BlockIdentifier.Index)
+	}
+	tip, _ := node.QueryLatestBlock()
+	if len(tip.Body) == 0 {
+		t.Fatal("the tip of the fake chain has no transactions")
+	}
+	tipID := "0x" + hex.EncodeToString(tip.Body[0].GetID())
+	if response, code, _ := request(map[string]interface{}{"index": 0}, tipID); code != 0 || response.BlockIdentifier.Index != 20 {
+		t.Fatalf("proof with index 0: error %d in block %d, want the tip", code, response.BlockIdentifier.Index)
+	}
+}
+
+func TestBlockHandlerBlockTypes(t *testing.T) {
+	node, _, handler := newTestServer(t, 260)
+
+	// The archive holds the whole neogenesis block file, ledger included
+	dir := writeNodeArchive(t, node)
+	raw := neogenesisFile(256, node.blocks[255].Trailer.Bhash, []uint64{100, 200, 300})
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("b%016x.bc", 256)), raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := OpenNodeArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := NODE_ARCHIVE
+	NODE_ARCHIVE = archive
+	t.Cleanup(func() { NODE_ARCHIVE = previous })
+
+	blockAt := func(index int) Block {
+		var response BlockResponse
+		if code := post(t, handler, "/block", map[string]interface{}{"block_identifier": map[string]interface{}{"index": index}}, &response); code != 0 {
+			t.Fatalf("/block index %d: error %d", index, code)
+		}
+		return response.Block
+	}
+
+	if kind := blockAt(6).Metadata["block_type"]; kind != "standard" {
+		t.Fatalf("block 6 is %v", kind)
+	}
+	neogenesis := blockAt(256)
+	if neogenesis.Metadata["block_type"] != "neogenesis" || len(neogenesis.Transactions) != 0 {
+		t.Fatalf("block 256 is %v with %d transactions", neogenesis.Metadata["block_type"], len(neogenesis.Transactions))
+	}
+	ledger, _ := neogenesis.Metadata["ledger"].(map[string]interface{})
+	if ledger["entries"] != 3.0 || ledger["total_supply"] != 600.0 {
+		t.Fatalf("block 256 ledger %v, want 3 entries and 600", ledger)
+	}
+
+	// Genesis is requested by hash, an index of 0 asks for the tip
+	var genesis BlockResponse
+	request := []byte(`{"network_identifier":{"blockchain":"` + Constants.NetworkIdentifier.Blockchain + `","network":"` + Constants.NetworkIdentifier.Network + `"},"block_identifier":{"hash":"` + fmt.Sprintf("0x%x", node.blocks[0].Trailer.Bhash[:]) + `"}}`)
+	if code := serve(t, handler, "/block", request, &genesis); code != 0 || genesis.Block.Metadata["block_type"] != "genesis" {
+		t.Fatalf("/block genesis: error %d, type %v", code, genesis.Block.Metadata["block_type"])
+	}
+
+	// A block left without transactions is a pseudo-block
+	pseudo := node.blocks[7]
+	binary.LittleEndian.PutUint32(pseudo.Trailer.Tcount[:], 0)
+	pseudo.Body = nil
+	if kind := blockFromMochimo(pseudo).Metadata["block_type"]; kind != "pseudo" {
+		t.Fatalf("block without transactions is %v", kind)
+	}
+}
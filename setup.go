@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/NickP005/go_mcminterface"
@@ -19,21 +20,56 @@ func Setup() {
  * Loads the flags and prepares the program accordingly
  */
 func SetupFlags() bool {
+	// Worker process of the quorum reads of a node, see askNode
+	if ip := os.Getenv(nodeWorkerEnv); ip != "" {
+		Globals.LogLevel = 0
+		runNodeWorker(ip, os.Stdin, os.Stdout)
+		return false
+	}
+
 	solo_node := ""
+	quorum_nodes := ""
 
 	flag.StringVar(&SETTINGS_PATH, "settings", "interface_settings.json", "Path to the interface settings file")
 	flag.StringVar(&TFILE_PATH, "tfile", "mochimo/bin/d/tfile.dat", "Path to node's tfile.dat file")
 	flag.StringVar(&TXCLEANFILE_PATH, "txclean", "mochimo/bin/d/txclean.dat", "Path to node's txclean.dat file")
+	flag.DurationVar(&MEMPOOL_REFRESH_INTERVAL, "mempool_refresh", time.Second, "How often txclean.dat is checked for a new mempool")
 	flag.Float64Var(&SUGGESTED_FEE_PERC, "fp", 0.4, "The lower percentile of fees set in recent blocks")
 	flag.DurationVar(&REFRESH_SYNC_INTERVAL, "refresh_interval", 5*time.Second, "The interval in seconds to refresh the sync")
 	flag.StringVar(&Globals.LedgerPath, "ledger", "", "Path to the ledger.dat file for statistics")
 	flag.DurationVar(&LEDGER_CACHE_REFRESH_INTERVAL, "ledger_refresh", 900*time.Second, "The interval in seconds to refresh the ledger cache")
+	flag.IntVar(&LEDGER_TOP_K, "ledger_top_k", 10000, "How many of the richest and of the poorest ledger entries are kept in memory")
+	flag.StringVar(&LEDGER_SNAPSHOT_DIR, "ledger_snapshot_dir", "", "Folder of the ledger copies read by the statistics endpoints (default: system temporary folder)")
+	flag.IntVar(&LEDGER_CHANGES_HISTORY, "ledger_changes_history", 96, "How many ledger diffs /stats/ledger/changes keeps")
+	flag.StringVar(&LEDGER_ARCHIVE_PATH, "ledger_archive", "", "Folder of the archived ledger snapshots (disabled when empty)")
+	flag.DurationVar(&LEDGER_ARCHIVE_EVERY, "ledger_archive_every", 0, "Archive the ledger at this interval instead of once per neogenesis epoch (0)")
+	flag.IntVar(&LEDGER_ARCHIVE_KEEP, "ledger_archive_keep", 180, "Number of archived ledger snapshots kept (0 for no limit)")
+	flag.Uint64Var(&STATS_DUST_THRESHOLD, "stats_dust", 1000000, "Balance in nanoMCM below which an account counts as dust in /stats/distribution")
 	flag.IntVar(&Globals.LogLevel, "ll", 5, "Log level (1-5). Least to most verbose")
 	flag.StringVar(&solo_node, "solo", "", "Bypass settings and use a single node ip (e.g. 0.0.0.0")
 	flag.IntVar(&Globals.HTTPPort, "p", 8080, "Port to listen to")
 	flag.IntVar(&Globals.HTTPSPort, "ptls", 8443, "Port to listen to for TLS")
 	flag.IntVar(&go_mcminterface.Settings.DefaultPort, "np", 2095, "Port to connect to the node")
 	flag.BoolVar(&Globals.OnlineMode, "online", true, "Run in online mode")
+	flag.IntVar(&Globals.QuorumSize, "quorum", 0, "Number of nodes asked for tip, trailers and balances (0 or 1 disables quorum reads)")
+	flag.IntVar(&Globals.QuorumMin, "quorum_min", 0, "Number of nodes that must agree in quorum mode (default: simple majority)")
+	flag.StringVar(&quorum_nodes, "quorum_nodes", "", "Comma separated node ips for quorum reads (default: known peers)")
+	flag.DurationVar(&QUORUM_NODE_TIMEOUT, "quorum_timeout", 30*time.Second, "How long a quorum node has to answer a query")
+	flag.StringVar(&NODE_BC_PATH, "bcdir", "mochimo/bin/d/bc", "Path to node's block archive folder (empty disables reading blocks from disk)")
+	flag.Uint64Var(&NODE_BC_SCAN_DEPTH, "bcdir_scan_depth", 20000, "How many recent tfile trailers are searched for a block hash missing from the block map")
+	flag.BoolVar(&CHAIN_CHECK_HAIKU, "chain_check_haiku", true, "Require a haiku in every mined trailer when validating the tfile")
+	flag.IntVar(&BLOCK_VERIFY_RETRIES, "block_verify_retries", 3, "How many times a block failing verification is fetched again")
+	flag.StringVar(&BLOCK_STORE_PATH, "block_store", "", "Folder of the local block archive (disabled when empty)")
+	flag.BoolVar(&BLOCK_STORE_COMPRESS, "block_store_compress", false, "Gzip blocks in the local block archive")
+	flag.Int64Var(&BLOCK_STORE_MAX_MB, "block_store_max_mb", 1024, "Maximum size in MB of the local block archive (0 for no limit)")
+	flag.DurationVar(&BLOCK_STORE_MAX_AGE, "block_store_max_age", 0, "Maximum age of archived blocks (0 for no limit)")
+	flag.Uint64Var(&BLOCK_STORE_WINDOW, "block_store_window", 0, "Only keep archived blocks this many heights below the tip (0 for no limit)")
+	flag.BoolVar(&Globals.Regtest, "regtest", false, "Run against a local simulated chain instead of the Mochimo network")
+	flag.DurationVar(&REGTEST_BLOCK_TIME, "regtest_block_time", 15*time.Second, "Interval between simulated blocks in regtest mode (0 mines only on demand)")
+	flag.Uint64Var(&REGTEST_HEIGHT, "regtest_height", 100, "Initial height of the simulated chain in regtest mode")
+	flag.Int64Var(&REGTEST_SEED, "regtest_seed", 1, "Seed of the simulated chain in regtest mode")
+	flag.StringVar(&LABELS_PATH, "labels", "labels.json", "Path to the address labels file")
+	flag.StringVar(&LABELS_ADMIN_TOKEN, "labels_token", "", "Bearer token of the label admin API (empty disables it)")
 	flag.StringVar(&Globals.CertFile, "cert", "", "Path to SSL certificate file")
 	flag.StringVar(&Globals.KeyFile, "key", "", "Path to SSL private key file")
 	flag.BoolVar(&Globals.EnableIndexer, "indexer", false, "Enable the indexer")
@@ -55,6 +91,9 @@ func SetupFlags() bool {
 	if Globals.LedgerPath == "" {
 		Globals.LedgerPath = getEnv("MCM_LEDGER_PATH", "")
 	}
+	if LABELS_ADMIN_TOKEN == "" {
+		LABELS_ADMIN_TOKEN = getEnv("MCM_LABELS_TOKEN", "")
+	}
 
 	// Enable HTTPS only if both cert and key are provided
 	Globals.EnableHTTPS = Globals.CertFile != "" && Globals.KeyFile != ""
@@ -69,9 +108,50 @@ func SetupFlags() bool {
 		go_mcminterface.Settings.ForceQueryStartIPs = true
 	}
 
+	if Globals.Regtest {
+		// The simulated chain replaces the node: no quorum, always online
+		Globals.OnlineMode = true
+		Globals.QuorumSize = 0
+		// Simulated blocks are not mined, their nonce is random
+		CHAIN_CHECK_HAIKU = false
+		Constants.NetworkIdentifier.Network = "regtest"
+		if !isFlagSet("tfile") {
+			TFILE_PATH = "data/regtest/tfile.dat"
+		}
+	}
+
+	if quorum_nodes != "" {
+		for _, ip := range strings.Split(quorum_nodes, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				Globals.QuorumNodes = append(Globals.QuorumNodes, ip)
+			}
+		}
+	}
+	if Globals.QuorumSize > 1 {
+		if err := checkQuorumFlags(Globals.QuorumSize, Globals.QuorumMin); err != nil {
+			mlog(1, "§bSetupFlags(): §4Invalid quorum settings: §c%s", err)
+			return false
+		}
+		if solo_node != "" && len(Globals.QuorumNodes) == 0 {
+			mlog(2, "§bSetupFlags(): §6Quorum mode with -solo and no -quorum_nodes will only ask §9%s", solo_node)
+		}
+		mlog(2, "§bSetupFlags(): §2Quorum mode enabled: §9%d§2 nodes, §9%d§2 must agree", Globals.QuorumSize, quorumRequired(Globals.QuorumSize))
+	}
+
 	return true
 }
 
+// Helper function to check if a flag was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 // Helper function to get environment variables with default value
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
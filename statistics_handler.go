@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/NickP005/go_mcminterface"
@@ -14,17 +16,33 @@ import (
 // Constants for statistics functionality
 var LEDGER_CACHE_REFRESH_INTERVAL time.Duration = 900 * time.Second // 15 minutes default
 
-// LedgerCache holds the cached ledger data and related information
+// LedgerCache holds the cached ledger data and related information. A
+// cache is never modified once published, a refresh publishes a new one.
 type LedgerCache struct {
-	Ledger            *go_mcminterface.Ledger
+	snapshot          *ledgerSnapshot // Copy of the ledger file, address sorted
+	ledger            *ledgerView     // Richest and poorest entries and balance tally
+	Size              uint64
 	LastUpdated       time.Time
 	LastBlockNumber   uint64
+	LastBlockHash     [32]byte
 	CirculatingSupply uint64 // Total circulating supply in nanoMCM
-	mu                sync.RWMutex
+	Distribution      *LedgerDistribution
+	views             ledgerViews // Views without label categories, computed on first use
 }
 
-// Global ledger cache
-var GlobalLedgerCache LedgerCache
+// Global ledger cache, nil until the first refresh
+var GlobalLedgerCache atomic.Pointer[LedgerCache]
+
+// retiredLedgerCache is the cache replaced by the last refresh. Its
+// snapshot is kept for the requests still reading it, and removed at the
+// next refresh.
+var retiredLedgerCache struct {
+	cache *LedgerCache
+	mu    sync.Mutex
+}
+
+// ledgerRefreshMu serializes refreshes, which diff with the cached ledger
+var ledgerRefreshMu sync.Mutex
 
 // RichlistRequest is the request structure for the /stats/richlist endpoint
 type RichlistRequest struct {
@@ -32,6 +50,8 @@ type RichlistRequest struct {
 	Ascending         *bool             `json:"ascending,omitempty"`
 	Offset            *int64            `json:"offset,omitempty"`
 	Limit             *int64            `json:"limit,omitempty"`
+	BlockIdentifier   *BlockIdentifier  `json:"block_identifier,omitempty"`   // A past height is read from the ledger archive
+	ExcludeCategories []string          `json:"exclude_categories,omitempty"` // Label categories left out
 }
 
 // RichlistAccountBalance represents an account balance in the richlist
@@ -63,36 +83,80 @@ func RefreshLedgerCache() error {
 
 	mlog(3, "§bRefreshLedgerCache(): §7Loading ledger from §8%s", Globals.LedgerPath)
 
-	// Load ledger from file
-	ledger, err := go_mcminterface.LoadLedgerFromFile(Globals.LedgerPath)
+	ledgerRefreshMu.Lock()
+	defer ledgerRefreshMu.Unlock()
+
+	before, err := os.Stat(Globals.LedgerPath)
+	if err != nil {
+		mlog(3, "§bRefreshLedgerCache(): §4Error reading ledger: §c%s", err)
+		return err
+	}
+
+	// Stream the ledger and build the indexes in one pass
+	cache, err := loadLedgerCache(Globals.LedgerPath)
 	if err != nil {
 		mlog(3, "§bRefreshLedgerCache(): §4Error loading ledger: §c%s", err)
 		return err
 	}
+	published := false
+	defer func() {
+		if !published {
+			cache.snapshot.remove()
+		}
+	}()
 
-	// Sort ledger by balance for richlist
-	ledger.SortBalances()
+	// The block is found from when the ledger was written, which must not
+	// have changed while it was read
+	after, err := os.Stat(Globals.LedgerPath)
+	if err == nil && (!after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size()) {
+		err = fmt.Errorf("ledger file changed while it was read")
+	}
+	if err != nil {
+		mlog(3, "§bRefreshLedgerCache(): §4Error loading ledger: §c%s", err)
+		return err
+	}
+	cache.LastBlockNumber, cache.LastBlockHash, err = ledgerSnapshotBlock(before.ModTime(), TFILE_PATH)
+	if err != nil {
+		mlog(3, "§bRefreshLedgerCache(): §4Error finding the block of the ledger: §c%s", err)
+		return err
+	}
 
-	// Calculate total circulating supply
-	var totalSupply uint64 = 0
-	for _, entry := range ledger.Entries {
-		totalSupply += entry.Balance
+	cache.Distribution, err = computeLedgerDistribution(cache.ledger)
+	if err != nil {
+		mlog(3, "§bRefreshLedgerCache(): §4Error computing the distribution: §c%s", err)
+		return err
 	}
+	cache.LastUpdated = time.Now()
+	diffWithCachedLedger(cache)
 
-	mlog(3, "§bRefreshLedgerCache(): §2Ledger loaded successfully with §e%d§2 entries, total supply: §e%d", ledger.Size, totalSupply)
+	if LEDGER_ARCHIVE != nil && LEDGER_ARCHIVE.Due(cache.LastBlockNumber, cache.LastUpdated) {
+		if err := LEDGER_ARCHIVE.Archive(cache.snapshot.reader(), cache.LastBlockNumber, cache.LastBlockHash, cache.CirculatingSupply); err != nil {
+			mlog(3, "§bRefreshLedgerCache(): §4Error archiving ledger: §c%s", err)
+		}
+	}
 
-	// Update the global cache with a write lock
-	GlobalLedgerCache.mu.Lock()
-	defer GlobalLedgerCache.mu.Unlock()
+	mlog(3, "§bRefreshLedgerCache(): §2Ledger loaded successfully with §e%d§2 entries, total supply: §e%d", cache.Size, cache.CirculatingSupply)
 
-	GlobalLedgerCache.Ledger = ledger
-	GlobalLedgerCache.LastUpdated = time.Now()
-	GlobalLedgerCache.LastBlockNumber = Globals.LatestBlockNum
-	GlobalLedgerCache.CirculatingSupply = totalSupply
+	publishLedgerCache(cache)
+	published = true
 
 	return nil
 }
 
+// publishLedgerCache replaces the cached ledger. Readers keep the cache
+// they loaded until they are done with it: the snapshot of the replaced
+// cache is only removed when the next one is published.
+func publishLedgerCache(cache *LedgerCache) {
+	retiredLedgerCache.mu.Lock()
+	defer retiredLedgerCache.mu.Unlock()
+
+	previous := GlobalLedgerCache.Swap(cache)
+	if retiredLedgerCache.cache != nil {
+		retiredLedgerCache.cache.snapshot.remove()
+	}
+	retiredLedgerCache.cache = previous
+}
+
 // InitStatistics initializes the statistics functionality
 func InitStatistics() {
 	if Globals.LedgerPath == "" {
@@ -160,149 +224,80 @@ func richlistHandler(w http.ResponseWriter, r *http.Request) {
 		offset = *req.Offset
 	}
 
-	// Check if ledger cache is available
-	GlobalLedgerCache.mu.RLock()
-	defer GlobalLedgerCache.mu.RUnlock()
+	// Past richlists come from the archived ledger snapshots
+	if req.BlockIdentifier != nil && req.BlockIdentifier.Index > 0 && isPastLedgerHeight(uint64(req.BlockIdentifier.Index)) {
+		if LEDGER_ARCHIVE == nil {
+			mlog(3, "§brichlistHandler(): §4Ledger archive is disabled")
+			giveError(w, ErrServiceUnavailable)
+			return
+		}
+		info, entries, err := LEDGER_ARCHIVE.Richest(uint64(req.BlockIdentifier.Index))
+		if err != nil {
+			mlog(3, "§brichlistHandler(): §4No ledger snapshot for block §e%d§4: §c%s", req.BlockIdentifier.Index, err)
+			giveError(w, ErrBlockNotFound)
+			return
+		}
+		excluded := excludedTags(req.ExcludeCategories)
+		var excludedEntries []go_mcminterface.LedgerEntry
+		if len(excluded) > 0 {
+			for _, entry := range entries {
+				if isExcluded(excluded, entry) {
+					excludedEntries = append(excludedEntries, entry)
+				}
+			}
+		}
+		excludedCount, excludedBalance := excludedTotals(excludedEntries, excluded)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(RichlistResponse{
+			BlockIdentifier:   BlockIdentifier{Index: int(info.Block), Hash: info.Hash},
+			LastUpdated:       info.Time.Format(time.RFC3339),
+			Accounts:          richlistAccounts(excludeEntries(rankedEntries(entries), excludedEntries), ascending, offset, limit),
+			TotalAccounts:     info.Entries - excludedCount,
+			CirculatingSupply: Amount{Value: fmt.Sprintf("%d", info.Supply-excludedBalance), Currency: MCMCurrency},
+		})
+		return
+	}
 
-	if GlobalLedgerCache.Ledger == nil {
+	// Check if ledger cache is available
+	cache := GlobalLedgerCache.Load()
+	if cache == nil {
 		mlog(3, "§brichlistHandler(): §4Ledger cache not available")
 		giveError(w, ErrServiceUnavailable)
 		return
 	}
 
-	ledger := GlobalLedgerCache.Ledger
-
-	// Debug ledger information
-	mlog(3, "§brichlistHandler(): §7Ledger info: Size=§e%d§7, IsBalanceSorted=§e%v§7, IsAddressSorted=§e%v",
-		ledger.Size, ledger.IsBalanceSorted, ledger.IsAddressSorted)
-
-	// Ensure ledger is sorted by balance
-	if !ledger.IsBalanceSorted {
-		mlog(3, "§brichlistHandler(): §7Ledger not sorted by balance, sorting now")
-		GlobalLedgerCache.mu.RUnlock()
-		GlobalLedgerCache.mu.Lock()
-		ledger.SortBalances()
-		GlobalLedgerCache.mu.Unlock()
-		GlobalLedgerCache.mu.RLock()
+	// Get accounts based on sorting order, offset, and limit, the offset
+	// counting the accounts left once the excluded ones are left out
+	ledger, err := cache.viewWithout(req.ExcludeCategories)
+	var page []go_mcminterface.LedgerEntry
+	if err == nil {
+		page, err = ledger.page(offset, limit, ascending)
 	}
-
-	// Get accounts based on sorting order, offset, and limit
-	accounts := make([]RichlistAccountBalance, 0, limit)
-	totalAccounts := uint64(ledger.Size)
-
-	// The ledger is sorted in descending order (highest balance first)
-	// So for ascending order (lowest first), we need to reverse our access approach
-
-	// Calculate start and end indices based on ascending/descending order
-	var startIdx, endIdx int64
-
-	if ascending {
-		// For ascending order, start from the end of the sorted list (low balances)
-		startIdx = int64(ledger.Size) - 1 - offset
-		endIdx = startIdx - limit + 1
-		if endIdx < 0 {
-			endIdx = 0
-		}
-
-		// Log the calculated indices
-		mlog(3, "§brichlistHandler(): §7Using index range (ascending): start=§e%d§7, end=§e%d", startIdx, endIdx)
-
-		// Traverse backwards through the ledger for ascending order
-		for i := startIdx; i >= endIdx; i-- {
-			entry := ledger.Entries[i]
-
-			// Extract only the 20-byte address part (not the full address+pubkey)
-			addrLen := len(entry.Address)
-			mlog(4, "§brichlistHandler(): §7Processing entry #%d - Address length: §e%d", i, addrLen)
-
-			// Use just the first 20 bytes for the address (tag)
-			var addrTag []byte
-			if addrLen >= 20 {
-				addrTag = entry.Address[:20]
-			} else {
-				mlog(2, "§brichlistHandler(): §4Invalid address length §e%d§4 for entry #%d", addrLen, i)
-				addrTag = entry.Address[:addrLen]
-			}
-
-			addrHex := "0x" + BytesToHex(addrTag)
-
-			// Format balance correctly as a string
-			balanceStr := fmt.Sprintf("%d", entry.Balance)
-
-			mlog(4, "§brichlistHandler(): §7Address: §e%s§7, Balance: §e%s", addrHex, balanceStr)
-
-			accounts = append(accounts, RichlistAccountBalance{
-				AccountIdentifier: AccountIdentifier{
-					Address: addrHex,
-				},
-				Balance: Amount{
-					Value:    balanceStr,
-					Currency: MCMCurrency,
-				},
-			})
-		}
-	} else {
-		// For descending order (default, highest balances first)
-		startIdx = offset
-		endIdx = offset + limit
-		if endIdx > int64(ledger.Size) {
-			endIdx = int64(ledger.Size)
-		}
-
-		// Log the calculated indices
-		mlog(3, "§brichlistHandler(): §7Using index range (descending): start=§e%d§7, end=§e%d", startIdx, endIdx)
-
-		// Traverse forward through the ledger for descending order
-		for i := startIdx; i < endIdx; i++ {
-			entry := ledger.Entries[i]
-
-			// Extract only the 20-byte address part (not the full address+pubkey)
-			addrLen := len(entry.Address)
-			mlog(4, "§brichlistHandler(): §7Processing entry #%d - Address length: §e%d", i, addrLen)
-
-			// Use just the first 20 bytes for the address (tag)
-			var addrTag []byte
-			if addrLen >= 20 {
-				addrTag = entry.Address[:20]
-			} else {
-				mlog(2, "§brichlistHandler(): §4Invalid address length §e%d§4 for entry #%d", addrLen, i)
-				addrTag = entry.Address[:addrLen]
-			}
-
-			addrHex := "0x" + BytesToHex(addrTag)
-
-			// Format balance correctly as a string
-			balanceStr := fmt.Sprintf("%d", entry.Balance)
-
-			mlog(4, "§brichlistHandler(): §7Address: §e%s§7, Balance: §e%s", addrHex, balanceStr)
-
-			accounts = append(accounts, RichlistAccountBalance{
-				AccountIdentifier: AccountIdentifier{
-					Address: addrHex,
-				},
-				Balance: Amount{
-					Value:    balanceStr,
-					Currency: MCMCurrency,
-				},
-			})
-		}
+	if err != nil {
+		mlog(3, "§brichlistHandler(): §4Error reading the ledger snapshot: §c%s", err)
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+	accounts := make([]RichlistAccountBalance, 0, len(page))
+	for _, entry := range page {
+		accounts = append(accounts, richlistAccount(entry))
 	}
 
 	// Format circulating supply as Amount in Mochimo
 	var circulatingSupply Amount = Amount{
-		Value:    fmt.Sprintf("%d", GlobalLedgerCache.CirculatingSupply),
+		Value:    fmt.Sprintf("%d", ledger.tally.supply),
 		Currency: MCMCurrency,
 	}
 
 	// Build response
 	response := RichlistResponse{
 		BlockIdentifier: BlockIdentifier{
-			Index: int(GlobalLedgerCache.LastBlockNumber),
-			Hash:  "0x" + BytesToHex(Globals.LatestBlockHash[:]),
+			Index: int(cache.LastBlockNumber),
+			Hash:  "0x" + BytesToHex(cache.LastBlockHash[:]),
 		},
-		LastUpdated:       GlobalLedgerCache.LastUpdated.Format(time.RFC3339),
+		LastUpdated:       cache.LastUpdated.Format(time.RFC3339),
 		Accounts:          accounts,
-		TotalAccounts:     totalAccounts,
+		TotalAccounts:     ledger.tally.count,
 		CirculatingSupply: circulatingSupply,
 	}
 
@@ -310,3 +305,37 @@ func richlistHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// richlistAccounts returns a page of a ranked ledger, highest first,
+// counting from the lowest balance when ascending
+func richlistAccounts(ledger rankedLedger, ascending bool, offset int64, limit int64) []RichlistAccountBalance {
+	accounts := make([]RichlistAccountBalance, 0, limit)
+
+	// The ledger is sorted in descending order (highest balance first)
+	// So for ascending order (lowest first), we walk it backwards
+	n := int64(ledger.Len())
+	for k := offset; k < n && int64(len(accounts)) < limit; k++ {
+		i := k
+		if ascending {
+			i = n - 1 - k
+		}
+		accounts = append(accounts, richlistAccount(ledger.At(int(i))))
+	}
+
+	return accounts
+}
+
+// richlistAccount formats a ledger entry for the richlist
+func richlistAccount(entry go_mcminterface.LedgerEntry) RichlistAccountBalance {
+	// Use just the first 20 bytes for the address (tag)
+	account := labeledAccount(entry.Address[:])
+	mlog(4, "§brichlistAccount(): §7Address: §e%s§7, Balance: §e%d", account.Address, entry.Balance)
+
+	return RichlistAccountBalance{
+		AccountIdentifier: account,
+		Balance: Amount{
+			Value:    fmt.Sprintf("%d", entry.Balance),
+			Currency: MCMCurrency,
+		},
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// STATS_DUST_THRESHOLD is the balance in nanoMCM below which an account is dust
+var STATS_DUST_THRESHOLD uint64 = 1000000 // 0.001 MCM
+
+// distributionTopN are the holder counts whose share of the supply is reported
+var distributionTopN = []int{10, 100, 1000}
+
+// DistributionBucket counts the holders with a balance in [MinMCM, MaxMCM)
+type DistributionBucket struct {
+	MinMCM  uint64  `json:"min_mcm"`
+	MaxMCM  *uint64 `json:"max_mcm"` // nil for the last, open bucket
+	Holders uint64  `json:"holders"`
+	Balance Amount  `json:"balance"`
+}
+
+// TopHolderShare is the share of the supply held by the N richest accounts
+type TopHolderShare struct {
+	Top        int     `json:"top"`
+	Percentage float64 `json:"percentage"`
+}
+
+// LedgerDistribution describes how the supply is spread across accounts
+type LedgerDistribution struct {
+	Buckets       []DistributionBucket `json:"buckets"`
+	TopShares     []TopHolderShare     `json:"top_shares"`
+	Gini          float64              `json:"gini"`
+	MedianBalance Amount               `json:"median_balance"`
+	DustAccounts  uint64               `json:"dust_accounts"`
+	DustThreshold Amount               `json:"dust_threshold"`
+}
+
+// computeLedgerDistribution derives the distribution of a ledger view.
+// Buckets, dust and top shares are exact, and so is the median, which is
+// selected from the snapshot. The Gini coefficient is estimated from the
+// balance histogram.
+func computeLedgerDistribution(ledger *ledgerView) (*LedgerDistribution, error) {
+	distribution := &LedgerDistribution{
+		Buckets:       []DistributionBucket{},
+		TopShares:     []TopHolderShare{},
+		MedianBalance: Amount{Value: "0", Currency: MCMCurrency},
+		DustThreshold: Amount{Value: fmt.Sprintf("%d", STATS_DUST_THRESHOLD), Currency: MCMCurrency},
+	}
+	n := ledger.Len()
+	if n == 0 {
+		return distribution, nil
+	}
+	tally := &ledger.tally
+
+	// Buckets are powers of ten in MCM: [0, 1), [1, 10), [10, 100), ...
+	last := len(tally.decades) - 1
+	for last > 0 && tally.decades[last].holders == 0 {
+		last--
+	}
+	for b := 0; b <= last; b++ {
+		bucket := DistributionBucket{
+			Holders: tally.decades[b].holders,
+			Balance: Amount{Value: fmt.Sprintf("%d", tally.decades[b].balance), Currency: MCMCurrency},
+		}
+		if b > 0 {
+			bucket.MinMCM = pow10(b - 1)
+		}
+		if b < last {
+			max := pow10(b)
+			bucket.MaxMCM = &max
+		}
+		distribution.Buckets = append(distribution.Buckets, bucket)
+	}
+	distribution.DustAccounts = tally.dust
+
+	// Share of the N richest accounts
+	for _, top := range distributionTopN {
+		sum, err := ledger.topSum(top)
+		if err != nil {
+			return nil, err
+		}
+		share := TopHolderShare{Top: top}
+		if tally.supply > 0 {
+			share.Percentage = float64(sum) / float64(tally.supply) * 100
+		}
+		distribution.TopShares = append(distribution.TopShares, share)
+	}
+
+	// Median, in the middle of the ranking
+	median, _, err := ledger.selectBalance(int64(n / 2))
+	if err != nil {
+		return nil, err
+	}
+	if n%2 == 0 {
+		below, _, err := ledger.selectBalance(int64(n/2 - 1))
+		if err != nil {
+			return nil, err
+		}
+		median = below/2 + median/2
+	}
+	distribution.MedianBalance.Value = fmt.Sprintf("%d", median)
+
+	distribution.Gini = tally.gini()
+	return distribution, nil
+}
+
+// pow10 returns 10^k
+func pow10(k int) uint64 {
+	result := uint64(1)
+	for i := 0; i < k; i++ {
+		result *= 10
+	}
+	return result
+}
+
+// DistributionRequest is the request structure for the /stats/distribution endpoint
+type DistributionRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	ExcludeCategories []string          `json:"exclude_categories,omitempty"` // Label categories left out
+}
+
+// DistributionResponse is the response structure for the /stats/distribution endpoint
+type DistributionResponse struct {
+	BlockIdentifier   BlockIdentifier `json:"block_identifier"`
+	LastUpdated       string          `json:"last_updated"`
+	TotalAccounts     uint64          `json:"total_accounts"`
+	CirculatingSupply Amount          `json:"circulating_supply"`
+	LedgerDistribution
+}
+
+// distributionHandler handles the /stats/distribution endpoint
+func distributionHandler(w http.ResponseWriter, r *http.Request) {
+	var req DistributionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bdistributionHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bdistributionHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	cache := GlobalLedgerCache.Load()
+	if cache == nil || cache.Distribution == nil {
+		mlog(3, "§bdistributionHandler(): §4Ledger cache not available")
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+
+	// Leaving accounts out needs the distribution computed again, once per
+	// categories for the cached ledger
+	ledger, distribution, err := cache.distributionWithout(req.ExcludeCategories)
+	if err != nil {
+		mlog(3, "§bdistributionHandler(): §4Error reading the ledger snapshot: §c%s", err)
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+
+	response := DistributionResponse{
+		BlockIdentifier: BlockIdentifier{
+			Index: int(cache.LastBlockNumber),
+			Hash:  "0x" + BytesToHex(cache.LastBlockHash[:]),
+		},
+		LastUpdated:        cache.LastUpdated.Format(time.RFC3339),
+		TotalAccounts:      ledger.tally.count,
+		CirculatingSupply:  Amount{Value: fmt.Sprintf("%d", ledger.tally.supply), Currency: MCMCurrency},
+		LedgerDistribution: *distribution,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// gini is the mean absolute difference form of the Gini coefficient
+func gini(balances []uint64) float64 {
+	var total, differences float64
+	for _, a := range balances {
+		total += float64(a)
+		for _, b := range balances {
+			differences += math.Abs(float64(a) - float64(b))
+		}
+	}
+	n := float64(len(balances))
+	return differences / (2 * n * total)
+}
+
+// balancesDistribution loads the balances, one tag each, and computes
+// their distribution
+func balancesDistribution(t *testing.T, balances []uint64) *LedgerDistribution {
+	t.Helper()
+	entries := make([]go_mcminterface.LedgerEntry, len(balances))
+	for i, balance := range balances {
+		entries[i] = ledgerEntry(byte(i+1), 1, balance)
+	}
+	distribution, err := computeLedgerDistribution(loadEntries(t, entries).ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return distribution
+}
+
+func TestComputeLedgerDistribution(t *testing.T) {
+	balances := []uint64{50e9, 5e9, 2e9, 5e8, 5e5}
+	var supply uint64
+	for _, balance := range balances {
+		supply += balance
+	}
+	withTopK(t, 10000)
+	distribution := balancesDistribution(t, balances)
+
+	// [0, 1), [1, 10) and [10, ...) MCM
+	want := []struct {
+		min     uint64
+		max     *uint64
+		holders uint64
+		balance uint64
+	}{{0, ptrUint64(1), 2, 5e8 + 5e5}, {1, ptrUint64(10), 2, 7e9}, {10, nil, 1, 50e9}}
+	if len(distribution.Buckets) != len(want) {
+		t.Fatalf("buckets %+v", distribution.Buckets)
+	}
+	for i, bucket := range distribution.Buckets {
+		w := want[i]
+		if bucket.MinMCM != w.min || (bucket.MaxMCM == nil) != (w.max == nil) || (w.max != nil && *bucket.MaxMCM != *w.max) ||
+			bucket.Holders != w.holders || bucket.Balance.Value != fmt.Sprint(w.balance) {
+			t.Errorf("bucket %d is %+v, want %+v", i, bucket, w)
+		}
+	}
+
+	if distribution.DustAccounts != 1 || distribution.MedianBalance.Value != "2000000000" {
+		t.Fatalf("%d dust accounts, median %s", distribution.DustAccounts, distribution.MedianBalance.Value)
+	}
+	if math.Abs(distribution.Gini-gini(balances)) > 1e-9 {
+		t.Fatalf("gini %v, want %v", distribution.Gini, gini(balances))
+	}
+	// Fewer holders than every top N: each holds the whole supply
+	if len(distribution.TopShares) != len(distributionTopN) || distribution.TopShares[0].Percentage != 100 {
+		t.Fatalf("top shares %+v", distribution.TopShares)
+	}
+
+	even := balancesDistribution(t, []uint64{40, 30, 20, 10})
+	if even.MedianBalance.Value != "25" || math.Abs(even.Gini-gini([]uint64{40, 30, 20, 10})) > 1e-9 {
+		t.Fatalf("median %s, gini %v of an even ledger", even.MedianBalance.Value, even.Gini)
+	}
+	if empty := balancesDistribution(t, nil); len(empty.Buckets) != 0 || empty.Gini != 0 {
+		t.Fatalf("distribution of an empty ledger %+v", empty)
+	}
+}
+
+func TestTopShares(t *testing.T) {
+	balances := make([]uint64, 150)
+	var supply uint64
+	for i := range balances {
+		balances[i] = uint64(150 - i)
+		supply += balances[i]
+	}
+	top10 := float64(150+141) * 10 / 2
+	top100 := float64(150+51) * 100 / 2
+	// Also with the richest past the first 5 read from the snapshot
+	for _, k := range []int{10000, 5} {
+		withTopK(t, k)
+		distribution := balancesDistribution(t, balances)
+		if share := distribution.TopShares[0]; share.Top != 10 || math.Abs(share.Percentage-top10/float64(supply)*100) > 1e-9 {
+			t.Fatalf("top 10 share %+v with %d entries in memory, want %v%%", share, k, top10/float64(supply)*100)
+		}
+		if share := distribution.TopShares[1]; share.Top != 100 || math.Abs(share.Percentage-top100/float64(supply)*100) > 1e-9 {
+			t.Fatalf("top 100 share %+v with %d entries in memory, want %v%%", share, k, top100/float64(supply)*100)
+		}
+		if distribution.MedianBalance.Value != "75" {
+			t.Fatalf("median %s with %d entries in memory, want 75", distribution.MedianBalance.Value, k)
+		}
+	}
+}
+
+func TestGiniEstimate(t *testing.T) {
+	withTopK(t, 10)
+	// Many balances sharing histogram buckets
+	balances := make([]uint64, 250)
+	for i := range balances {
+		balances[i] = uint64(i*i)*1e6 + 12345
+	}
+	if distribution := balancesDistribution(t, balances); math.Abs(distribution.Gini-gini(balances)) > 0.01 {
+		t.Fatalf("gini %v, want about %v", distribution.Gini, gini(balances))
+	}
+}
+
+func TestDistributionHandler(t *testing.T) {
+	node, _, _ := newTestServer(t, 10)
+	entries := []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, 50e9), ledgerEntry(2, 1, 5e9), ledgerEntry(3, 1, 5e5)}
+	withLedger(t, node, 8, entries)
+	handler := NewServer(node).Router()
+
+	var response DistributionResponse
+	if code := post(t, handler, "/stats/distribution", map[string]interface{}{}, &response); code != 0 {
+		t.Fatalf("/stats/distribution: error %d", code)
+	}
+	if response.TotalAccounts != 3 || response.CirculatingSupply.Value != fmt.Sprint(uint64(55e9+5e5)) || response.BlockIdentifier.Index != 8 {
+		t.Fatalf("%d accounts, supply %s at block %d", response.TotalAccounts, response.CirculatingSupply.Value, response.BlockIdentifier.Index)
+	}
+	if response.DustAccounts != 1 || len(response.Buckets) != 3 {
+		t.Fatalf("distribution %+v", response.LedgerDistribution)
+	}
+}
+
+func ptrUint64(v uint64) *uint64 { return &v }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// RankRequest is the request structure for the /stats/rank endpoint
+type RankRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	AccountIdentifier AccountIdentifier `json:"account_identifier"`
+	ExcludeCategories []string          `json:"exclude_categories,omitempty"` // Label categories left out
+}
+
+// RankResponse is the response structure for the /stats/rank endpoint
+type RankResponse struct {
+	BlockIdentifier   BlockIdentifier   `json:"block_identifier"`
+	LastUpdated       string            `json:"last_updated"`
+	AccountIdentifier AccountIdentifier `json:"account_identifier"`
+	Balance           Amount            `json:"balance"`
+	Rank              uint32            `json:"rank"`
+	Percentile        float64           `json:"percentile"` // share of accounts ranked below
+	TotalAccounts     uint64            `json:"total_accounts"`
+	Estimated         bool              `json:"estimated"` // rank and percentile interpolated from the balance histogram
+}
+
+// rankHandler handles the /stats/rank endpoint
+func rankHandler(w http.ResponseWriter, r *http.Request) {
+	var req RankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§brankHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§brankHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	// Tag or full WOTS address
+	if len(req.AccountIdentifier.Address) != go_mcminterface.TXTAGLEN*2+2 &&
+		len(req.AccountIdentifier.Address) != go_mcminterface.TXADDRLEN*2+2 {
+		mlog(3, "§brankHandler(): §4Invalid account format")
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+	address, err := hex.DecodeString(req.AccountIdentifier.Address[2:])
+	if err != nil {
+		giveError(w, ErrInvalidAccountFormat)
+		return
+	}
+
+	cache := GlobalLedgerCache.Load()
+	if cache == nil {
+		mlog(3, "§brankHandler(): §4Ledger cache not available")
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+
+	entry, ok, err := cache.snapshot.search(address)
+	if err != nil {
+		mlog(3, "§brankHandler(): §4Error reading the ledger snapshot: §c%s", err)
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+	if !ok {
+		mlog(4, "§brankHandler(): §4Address §60x%x§4 not in the ledger", address)
+		giveError(w, ErrAccountNotFound)
+		return
+	}
+
+	// Excluded accounts are left out of the ranking
+	ledger, err := cache.viewWithout(req.ExcludeCategories)
+	if err != nil {
+		mlog(3, "§brankHandler(): §4Error reading the ledger snapshot: §c%s", err)
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+	if isExcluded(ledger.excluded, entry) {
+		mlog(4, "§brankHandler(): §4Address §60x%x§4 is in an excluded category", address)
+		giveError(w, ErrAccountNotFound)
+		return
+	}
+
+	// The rank is one more than the number of higher balances, equal
+	// balances sharing a rank
+	higher, below, estimated := ledger.rank(entry.Balance)
+	total := ledger.tally.count
+
+	response := RankResponse{
+		BlockIdentifier: BlockIdentifier{
+			Index: int(cache.LastBlockNumber),
+			Hash:  "0x" + BytesToHex(cache.LastBlockHash[:]),
+		},
+		LastUpdated:       cache.LastUpdated.Format(time.RFC3339),
+		AccountIdentifier: labeledAccount(entry.Address[:]),
+		Balance:           Amount{Value: fmt.Sprintf("%d", entry.Balance), Currency: MCMCurrency},
+		Rank:              uint32(higher + 1),
+		Percentile:        float64(below) / float64(total) * 100,
+		TotalAccounts:     total,
+		Estimated:         estimated,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
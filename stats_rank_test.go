@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+func TestRankHandler(t *testing.T) {
+	node, _, _ := newTestServer(t, 10)
+	withLedger(t, node, 9, []go_mcminterface.LedgerEntry{
+		ledgerEntry(1, 1, 300), ledgerEntry(2, 1, 500), ledgerEntry(3, 1, 100), ledgerEntry(4, 1, 300),
+	})
+	handler := NewServer(node).Router()
+	rank := func(address string) (RankResponse, int) {
+		var response RankResponse
+		code := post(t, handler, "/stats/rank", map[string]interface{}{"account_identifier": map[string]string{"address": address}}, &response)
+		return response, code
+	}
+
+	tests := []struct {
+		tag        byte
+		rank       uint32
+		percentile float64
+	}{{2, 1, 75}, {1, 2, 25}, {4, 2, 25}, {3, 4, 0}}
+	for _, test := range tests {
+		response, code := rank("0x" + hex.EncodeToString(ledgerTag(test.tag)))
+		if code != 0 || response.Rank != test.rank || response.Percentile != test.percentile || response.TotalAccounts != 4 || response.BlockIdentifier.Index != 9 {
+			t.Errorf("rank of tag %d: error %d, %+v, want rank %d and percentile %v", test.tag, code, response, test.rank, test.percentile)
+		}
+	}
+
+	// A full address ranks like its tag
+	entry := ledgerEntry(2, 1, 0)
+	if response, code := rank("0x" + hex.EncodeToString(entry.Address[:])); code != 0 || response.Rank != 1 {
+		t.Fatalf("rank of a full address: error %d, rank %d", code, response.Rank)
+	}
+	if _, code := rank("0x" + hex.EncodeToString(ledgerTag(9))); code != ErrAccountNotFound.Code {
+		t.Fatalf("rank of a tag not in the ledger: error %d, want %d", code, ErrAccountNotFound.Code)
+	}
+	if _, code := rank("0x1234"); code != ErrInvalidAccountFormat.Code {
+		t.Fatalf("rank of a short address: error %d, want %d", code, ErrInvalidAccountFormat.Code)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"mochimo-mesh/blocktype"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// Mochimo block reward schedule, in nanoMCM. The reward grows from block 1
+// to T2, then decreases until T3, after which blocks carry no reward.
+// Neogenesis and pseudo-blocks are not mined and carry no reward.
+const (
+	rewardBase1  uint64 = 5000000000 // 5 MCM
+	rewardDelta1 uint64 = 56000      // added per block until T1
+	rewardT1     uint64 = 17185
+	rewardBase2  uint64 = 5917392000 // 5.917392 MCM
+	rewardDelta2 uint64 = 150000     // added per block until T2
+	rewardT2     uint64 = 373761
+	rewardBase3  uint64 = 59523942000 // 59.523942 MCM
+	rewardDelta3 uint64 = 28488       // removed per block until T3
+	rewardT3     uint64 = 2097152     // 0x200000, end of the emission
+)
+
+// EMISSION_CURVE_POINTS is how many points of the projected emission are reported
+var EMISSION_CURVE_POINTS uint64 = 64
+
+// blockReward returns the reward of a mined block at bnum
+func blockReward(bnum uint64) uint64 {
+	switch {
+	case bnum == 0 || bnum >= rewardT3:
+		return 0
+	case bnum < rewardT1:
+		return rewardBase1 + rewardDelta1*(bnum-1)
+	case bnum < rewardT2:
+		return rewardBase2 + rewardDelta2*(bnum-rewardT1)
+	default:
+		return rewardBase3 - rewardDelta3*(bnum-rewardT2)
+	}
+}
+
+// EmissionPoint is the scheduled supply up to a block, assuming that every
+// block that can be mined is mined
+type EmissionPoint struct {
+	Block      uint64 `json:"block"`
+	Reward     Amount `json:"reward"`
+	Cumulative Amount `json:"cumulative"`
+}
+
+var emissionCurve struct {
+	points []EmissionPoint
+	max    uint64
+	once   sync.Once
+}
+
+// getEmissionCurve computes the scheduled emission once, sampled in
+// EMISSION_CURVE_POINTS points up to the end of the emission
+func getEmissionCurve() ([]EmissionPoint, uint64) {
+	emissionCurve.once.Do(func() {
+		step := rewardT3 / EMISSION_CURVE_POINTS
+		if step == 0 {
+			step = 1
+		}
+		var cumulative uint64
+		for bnum := uint64(1); bnum <= rewardT3; bnum++ {
+			if bnum&0xFF != 0 {
+				cumulative += blockReward(bnum)
+			}
+			if bnum%step == 0 || bnum == rewardT3 {
+				emissionCurve.points = append(emissionCurve.points, EmissionPoint{
+					Block:      bnum,
+					Reward:     Amount{Value: fmt.Sprintf("%d", blockReward(bnum)), Currency: MCMCurrency},
+					Cumulative: Amount{Value: fmt.Sprintf("%d", cumulative), Currency: MCMCurrency},
+				})
+			}
+		}
+		emissionCurve.max = cumulative
+	})
+	return emissionCurve.points, emissionCurve.max
+}
+
+// minedSupply is the sum of the rewards of the mined blocks in the tfile,
+// extended incrementally as the tfile grows
+var minedSupply struct {
+	next       uint64   // first block not counted yet
+	lastHash   [32]byte // hash of block next-1, to detect reorganisations
+	total      uint64
+	mined      uint64
+	pseudo     uint64
+	neogenesis uint64
+	mu         sync.Mutex
+}
+
+// MinedSupplyStatus is a copy of the counters of minedSupply
+type MinedSupplyStatus struct {
+	Height     uint64
+	Hash       [32]byte
+	Total      uint64
+	Mined      uint64
+	Pseudo     uint64
+	Neogenesis uint64
+}
+
+// refreshMinedSupply counts the blocks added to the tfile since the last call
+func refreshMinedSupply() (MinedSupplyStatus, error) {
+	minedSupply.mu.Lock()
+	defer minedSupply.mu.Unlock()
+
+	tfile, err := os.Open(TFILE_PATH)
+	if err != nil {
+		return MinedSupplyStatus{}, err
+	}
+	defer tfile.Close()
+
+	// Start over if the last counted block is not in the tfile anymore
+	if minedSupply.next > 0 {
+		trailer, err := readTfileTrailer(minedSupply.next-1, TFILE_PATH)
+		if err != nil || trailer.Bhash != minedSupply.lastHash {
+			mlog(3, "§brefreshMinedSupply(): §6Tfile changed below block §e%d§6, counting again", minedSupply.next)
+			minedSupply.next, minedSupply.total, minedSupply.mined, minedSupply.pseudo, minedSupply.neogenesis = 0, 0, 0, 0, 0
+		}
+	}
+
+	if _, err := tfile.Seek(int64(minedSupply.next)*BTRAILER_SIZE, io.SeekStart); err != nil {
+		return MinedSupplyStatus{}, err
+	}
+	reader := bufio.NewReaderSize(tfile, 1024*BTRAILER_SIZE)
+	for {
+		var trailer go_mcminterface.BTRAILER
+		if err := binary.Read(reader, binary.LittleEndian, &trailer); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return MinedSupplyStatus{}, err
+		}
+		switch blocktype.ClassifyTrailer(trailer) {
+		case blocktype.Standard:
+			minedSupply.mined++
+			minedSupply.total += blockReward(binary.LittleEndian.Uint64(trailer.Bnum[:]))
+		case blocktype.Pseudo:
+			minedSupply.pseudo++
+		case blocktype.Neogenesis:
+			minedSupply.neogenesis++
+		}
+		minedSupply.next++
+		minedSupply.lastHash = trailer.Bhash
+	}
+
+	if minedSupply.next == 0 {
+		return MinedSupplyStatus{}, fmt.Errorf("empty tfile")
+	}
+	return MinedSupplyStatus{
+		Height:     minedSupply.next - 1,
+		Hash:       minedSupply.lastHash,
+		Total:      minedSupply.total,
+		Mined:      minedSupply.mined,
+		Pseudo:     minedSupply.pseudo,
+		Neogenesis: minedSupply.neogenesis,
+	}, nil
+}
+
+// genesisSupply is the ledger of the genesis block, read once from the node archive
+var genesisSupply struct {
+	value *uint64
+	mu    sync.Mutex
+}
+
+func getGenesisSupply() *uint64 {
+	genesisSupply.mu.Lock()
+	defer genesisSupply.mu.Unlock()
+
+	if genesisSupply.value == nil && NODE_ARCHIVE != nil {
+		if raw, err := NODE_ARCHIVE.ReadRaw(0); err == nil {
+			supply := blocktype.SummarizeLedger(raw, BTRAILER_SIZE).TotalSupply
+			genesisSupply.value = &supply
+		}
+	}
+	return genesisSupply.value
+}
+
+// SupplyRequest is the request structure for the /stats/supply endpoint
+type SupplyRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+}
+
+// SupplyResponse is the response structure for the /stats/supply endpoint
+type SupplyResponse struct {
+	BlockIdentifier    BlockIdentifier `json:"block_identifier"`
+	TotalMinedSupply   Amount          `json:"total_mined_supply"`
+	GenesisSupply      *Amount         `json:"genesis_supply,omitempty"`
+	CirculatingSupply  *Amount         `json:"circulating_supply,omitempty"`
+	LedgerBlock        *int            `json:"ledger_block,omitempty"`
+	UnaccountedSupply  *Amount         `json:"unaccounted_supply,omitempty"` // genesis + mined - circulating
+	CurrentBlockReward Amount          `json:"current_block_reward"`
+	MaxSupply          Amount          `json:"max_supply"` // genesis (when known) + every reward
+	MinedBlocks        uint64          `json:"mined_blocks"`
+	PseudoBlocks       uint64          `json:"pseudo_blocks"`
+	NeogenesisBlocks   uint64          `json:"neogenesis_blocks"`
+	EmissionCurve      []EmissionPoint `json:"emission_curve"`
+	LastUpdated        string          `json:"last_updated"`
+}
+
+// supplyHandler handles the /stats/supply endpoint
+func supplyHandler(w http.ResponseWriter, r *http.Request) {
+	var req SupplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bsupplyHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bsupplyHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	status, err := refreshMinedSupply()
+	if err != nil {
+		mlog(3, "§bsupplyHandler(): §4Error reading tfile: §c%s", err)
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+	curve, scheduled := getEmissionCurve()
+
+	response := SupplyResponse{
+		BlockIdentifier: BlockIdentifier{
+			Index: int(status.Height),
+			Hash:  "0x" + BytesToHex(status.Hash[:]),
+		},
+		TotalMinedSupply:   Amount{Value: fmt.Sprintf("%d", status.Total), Currency: MCMCurrency},
+		CurrentBlockReward: Amount{Value: fmt.Sprintf("%d", blockReward(status.Height+1)), Currency: MCMCurrency},
+		MinedBlocks:        status.Mined,
+		PseudoBlocks:       status.Pseudo,
+		NeogenesisBlocks:   status.Neogenesis,
+		EmissionCurve:      curve,
+		LastUpdated:        time.Now().Format(time.RFC3339),
+	}
+
+	issued := new(big.Int).SetUint64(status.Total)
+	maxSupply := new(big.Int).SetUint64(scheduled)
+	genesis := getGenesisSupply()
+	if genesis != nil {
+		response.GenesisSupply = &Amount{Value: fmt.Sprintf("%d", *genesis), Currency: MCMCurrency}
+		issued.Add(issued, new(big.Int).SetUint64(*genesis))
+		maxSupply.Add(maxSupply, new(big.Int).SetUint64(*genesis))
+	}
+	response.MaxSupply = Amount{Value: maxSupply.String(), Currency: MCMCurrency}
+
+	if cache := GlobalLedgerCache.Load(); cache != nil {
+		circulating := cache.CirculatingSupply
+		ledgerBlock := int(cache.LastBlockNumber)
+		response.CirculatingSupply = &Amount{Value: fmt.Sprintf("%d", circulating), Currency: MCMCurrency}
+		response.LedgerBlock = &ledgerBlock
+		// Only comparable when the genesis ledger is known
+		if genesis != nil {
+			unaccounted := new(big.Int).Sub(issued, new(big.Int).SetUint64(circulating))
+			response.UnaccountedSupply = &Amount{Value: unaccounted.String(), Currency: MCMCurrency}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"mochimo-mesh/blocktype"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+func TestBlockReward(t *testing.T) {
+	tests := []struct {
+		bnum, reward uint64
+	}{
+		{0, 0},
+		{1, rewardBase1},
+		{2, rewardBase1 + rewardDelta1},
+		{rewardT1 - 1, rewardBase1 + rewardDelta1*(rewardT1-2)},
+		{rewardT1, rewardBase2},
+		{rewardT2 - 1, rewardBase2 + rewardDelta2*(rewardT2-1-rewardT1)},
+		{rewardT2, rewardBase3},
+		{rewardT3 - 1, rewardBase3 - rewardDelta3*(rewardT3-1-rewardT2)},
+		{rewardT3, 0},
+		{rewardT3 + 1000, 0},
+	}
+	for _, test := range tests {
+		if reward := blockReward(test.bnum); reward != test.reward {
+			t.Errorf("blockReward(%d) = %d, want %d", test.bnum, reward, test.reward)
+		}
+	}
+}
+
+func TestEmissionCurve(t *testing.T) {
+	curve, max := getEmissionCurve()
+	if uint64(len(curve)) != EMISSION_CURVE_POINTS {
+		t.Fatalf("%d points, want %d", len(curve), EMISSION_CURVE_POINTS)
+	}
+
+	// Every block that can be mined, neogenesis blocks left out
+	var want uint64
+	for bnum := uint64(1); bnum < rewardT3; bnum++ {
+		if bnum&0xFF != 0 {
+			want += blockReward(bnum)
+		}
+	}
+	last := curve[len(curve)-1]
+	if max != want || last.Block != rewardT3 || last.Cumulative.Value != fmt.Sprint(want) {
+		t.Fatalf("curve ends at block %d with %s, maximum %d, want block %d and %d", last.Block, last.Cumulative.Value, max, rewardT3, want)
+	}
+	for i := 1; i < len(curve); i++ {
+		if curve[i].Block <= curve[i-1].Block {
+			t.Fatalf("point %d at block %d after block %d", i, curve[i].Block, curve[i-1].Block)
+		}
+	}
+}
+
+// withoutMinedSupply starts the count of the mined supply over, so that it
+// reads the tfile of the test
+func withoutMinedSupply(t *testing.T) {
+	reset := func() {
+		minedSupply.mu.Lock()
+		minedSupply.next, minedSupply.lastHash = 0, [32]byte{}
+		minedSupply.total, minedSupply.mined, minedSupply.pseudo, minedSupply.neogenesis = 0, 0, 0, 0
+		minedSupply.mu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// countBlocks counts the kinds of the blocks of node up to its tip, and the
+// rewards of the mined ones
+func countBlocks(t *testing.T, node *FakeNode) MinedSupplyStatus {
+	t.Helper()
+	tip, _ := node.QueryLatestBlock()
+	var status MinedSupplyStatus
+	for bnum := uint64(0); bnum <= binary.LittleEndian.Uint64(tip.Trailer.Bnum[:]); bnum++ {
+		block, err := node.QueryBlockFromNumber(bnum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch blocktype.Classify(block) {
+		case blocktype.Standard:
+			status.Mined++
+			status.Total += blockReward(bnum)
+		case blocktype.Pseudo:
+			status.Pseudo++
+		case blocktype.Neogenesis:
+			status.Neogenesis++
+		}
+		status.Height, status.Hash = bnum, block.Trailer.Bhash
+	}
+	return status
+}
+
+func TestRefreshMinedSupply(t *testing.T) {
+	node, _, _ := newTestServer(t, 300)
+	withoutMinedSupply(t)
+
+	status, err := refreshMinedSupply()
+	if want := countBlocks(t, node); err != nil || status != want {
+		t.Fatalf("refreshMinedSupply() = %+v, %v, want %+v", status, err, want)
+	}
+	if status.Neogenesis != 1 || status.Mined == 0 {
+		t.Fatalf("the fake chain counts %+v", status)
+	}
+
+	// Blocks added to the tfile are counted on top
+	for i := 0; i < 5; i++ {
+		node.MineBlock()
+	}
+	if err := node.WriteTfile(TFILE_PATH); err != nil {
+		t.Fatal(err)
+	}
+	status, err = refreshMinedSupply()
+	if want := countBlocks(t, node); err != nil || status != want {
+		t.Fatalf("after 5 more blocks, refreshMinedSupply() = %+v, %v, want %+v", status, err, want)
+	}
+
+	// Another chain replaces the counted blocks
+	other := NewFakeNode(2, 200)
+	if err := other.WriteTfile(TFILE_PATH); err != nil {
+		t.Fatal(err)
+	}
+	status, err = refreshMinedSupply()
+	if want := countBlocks(t, other); err != nil || status != want {
+		t.Fatalf("after a reorganisation, refreshMinedSupply() = %+v, %v, want %+v", status, err, want)
+	}
+}
+
+func TestSupplyHandler(t *testing.T) {
+	node, _, _ := newTestServer(t, 20)
+	withoutMinedSupply(t)
+	withLedger(t, node, 18, []go_mcminterface.LedgerEntry{ledgerEntry(1, 1, 300), ledgerEntry(2, 1, 500)})
+	handler := NewServer(node).Router()
+
+	var response SupplyResponse
+	if code := post(t, handler, "/stats/supply", map[string]interface{}{}, &response); code != 0 {
+		t.Fatalf("/stats/supply: error %d", code)
+	}
+	want := countBlocks(t, node)
+	if response.BlockIdentifier.Index != 20 || response.BlockIdentifier.Hash != fmt.Sprintf("0x%x", want.Hash[:]) {
+		t.Fatalf("supply at block %+v", response.BlockIdentifier)
+	}
+	if response.TotalMinedSupply.Value != fmt.Sprint(want.Total) || response.MinedBlocks != want.Mined || response.PseudoBlocks != want.Pseudo {
+		t.Fatalf("mined supply %s in %d mined and %d pseudo blocks, want %+v", response.TotalMinedSupply.Value, response.MinedBlocks, response.PseudoBlocks, want)
+	}
+	if response.CurrentBlockReward.Value != fmt.Sprint(blockReward(21)) {
+		t.Fatalf("current block reward %s, want the reward of block 21", response.CurrentBlockReward.Value)
+	}
+	if response.CirculatingSupply == nil || response.CirculatingSupply.Value != "800" || response.LedgerBlock == nil || *response.LedgerBlock != 18 {
+		t.Fatalf("circulating supply %+v at ledger block %v, want 800 at block 18", response.CirculatingSupply, response.LedgerBlock)
+	}
+	if uint64(len(response.EmissionCurve)) != EMISSION_CURVE_POINTS {
+		t.Fatalf("%d emission points", len(response.EmissionCurve))
+	}
+}
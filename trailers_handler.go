@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"mochimo-mesh/lightclient"
+)
+
+// Largest ranges served in one request
+const (
+	TRAILERS_MAX_RANGE  = 10000  // decoded trailers for /blocks/trailers
+	TFILE_RAW_MAX_RANGE = 100000 // raw trailers for /blocks/tfile (16 MB)
+)
+
+// TrailersRequest is the request structure for the /blocks/trailers and /blocks/tfile endpoints
+type TrailersRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	StartIndex        uint64            `json:"start_index"`
+	Count             uint64            `json:"count,omitempty"`
+	Format            string            `json:"format,omitempty"` // "json" (default) or "ndjson"
+}
+
+// TrailerInfo is a decoded block trailer
+type TrailerInfo struct {
+	BlockIdentifier       BlockIdentifier `json:"block_identifier"`
+	ParentBlockIdentifier BlockIdentifier `json:"parent_block_identifier"`
+	Mfee                  uint64          `json:"mfee"`
+	Tcount                uint32          `json:"tcount"`
+	Time0                 int64           `json:"time0"`
+	Stime                 int64           `json:"stime"`
+	Difficulty            uint32          `json:"difficulty"`
+	Mroot                 string          `json:"mroot"`
+	Nonce                 string          `json:"nonce"`
+}
+
+func trailerInfo(t lightclient.Trailer) TrailerInfo {
+	parent := int(t.Bnum) - 1
+	if t.Bnum == 0 {
+		parent = 0
+	}
+	return TrailerInfo{
+		BlockIdentifier: BlockIdentifier{
+			Index: int(t.Bnum),
+			Hash:  "0x" + hex.EncodeToString(t.Bhash[:]),
+		},
+		ParentBlockIdentifier: BlockIdentifier{
+			Index: parent,
+			Hash:  "0x" + hex.EncodeToString(t.Phash[:]),
+		},
+		Mfee:       t.Mfee,
+		Tcount:     t.Tcount,
+		Time0:      int64(t.Time0) * 1000, // Convert to milliseconds
+		Stime:      int64(t.Stime) * 1000,
+		Difficulty: t.Difficulty,
+		Mroot:      "0x" + hex.EncodeToString(t.Mroot[:]),
+		Nonce:      "0x" + hex.EncodeToString(t.Nonce[:]),
+	}
+}
+
+// openTrailerRange decodes and checks a range request, returning a reader
+// over the requested part of the tfile
+func openTrailerRange(w http.ResponseWriter, r *http.Request, caller string, maxRange uint64) (TrailersRequest, *os.File, *io.SectionReader, bool) {
+	var req TrailersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§b%s(): §4Error decoding request: §c%s", caller, err)
+		giveError(w, ErrInvalidRequest)
+		return req, nil, nil, false
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§b%s(): §4Wrong network identifier", caller)
+		giveError(w, ErrWrongNetwork)
+		return req, nil, nil, false
+	}
+
+	if req.Count == 0 {
+		req.Count = 100
+	}
+	if req.Count > maxRange {
+		mlog(3, "§b%s(): §4Requested §e%d§4 trailers, max is §e%d", caller, req.Count, maxRange)
+		giveError(w, ErrInvalidRequest)
+		return req, nil, nil, false
+	}
+
+	tfile, err := os.Open(TFILE_PATH)
+	if err != nil {
+		mlog(3, "§b%s(): §4Error opening tfile: §c%s", caller, err)
+		giveError(w, ErrServiceUnavailable)
+		return req, nil, nil, false
+	}
+	fi, err := tfile.Stat()
+	if err != nil {
+		tfile.Close()
+		giveError(w, ErrInternalError)
+		return req, nil, nil, false
+	}
+
+	// Clamp the range to the complete trailers in the tfile
+	available := uint64(fi.Size() / BTRAILER_SIZE)
+	if req.StartIndex >= available {
+		tfile.Close()
+		mlog(3, "§b%s(): §4Start §e%d§4 is past the tip §e%d", caller, req.StartIndex, available-1)
+		giveError(w, ErrBlockNotFound)
+		return req, nil, nil, false
+	}
+	if req.StartIndex+req.Count > available {
+		req.Count = available - req.StartIndex
+	}
+
+	section := io.NewSectionReader(tfile, int64(req.StartIndex)*BTRAILER_SIZE, int64(req.Count)*BTRAILER_SIZE)
+	return req, tfile, section, true
+}
+
+// trailersHandler streams a range of decoded trailers as JSON or NDJSON
+func trailersHandler(w http.ResponseWriter, r *http.Request) {
+	req, tfile, section, ok := openTrailerRange(w, r, "trailersHandler", TRAILERS_MAX_RANGE)
+	if !ok {
+		return
+	}
+	defer tfile.Close()
+
+	mlog(4, "§btrailersHandler(): §7Sending §e%d§7 trailers from §9%d§7 to §9%s", req.Count, req.StartIndex, r.RemoteAddr)
+
+	ndjson := req.Format == "ndjson" || r.Header.Get("Accept") == "application/x-ndjson"
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+
+	if !ndjson {
+		out.WriteString(`{"trailers":[`)
+	}
+	raw := make([]byte, BTRAILER_SIZE)
+	for i := uint64(0); i < req.Count; i++ {
+		if _, err := io.ReadFull(section, raw); err != nil {
+			mlog(3, "§btrailersHandler(): §4Error reading tfile: §c%s", err)
+			break
+		}
+		trailer, _ := lightclient.ParseTrailer(raw)
+		if !ndjson && i > 0 {
+			out.WriteByte(',')
+		}
+		// Encode adds a newline, which is the NDJSON separator and valid JSON whitespace
+		enc.Encode(trailerInfo(trailer))
+	}
+	if !ndjson {
+		out.WriteString("]}\n")
+	}
+}
+
+// tfileHandler streams a raw range of the tfile, 160 bytes per block
+func tfileHandler(w http.ResponseWriter, r *http.Request) {
+	req, tfile, section, ok := openTrailerRange(w, r, "tfileHandler", TFILE_RAW_MAX_RANGE)
+	if !ok {
+		return
+	}
+	defer tfile.Close()
+
+	mlog(4, "§btfileHandler(): §7Sending §e%d§7 raw trailers from §9%d§7 to §9%s", req.Count, req.StartIndex, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatUint(req.Count*BTRAILER_SIZE, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"tfile_%d_%d.dat\"", req.StartIndex, req.StartIndex+req.Count-1))
+	if _, err := io.Copy(w, section); err != nil {
+		mlog(3, "§btfileHandler(): §4Error sending tfile range: §c%s", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func trailersRequest(start, count uint64, format string) []byte {
+	request, _ := json.Marshal(TrailersRequest{
+		NetworkIdentifier: Constants.NetworkIdentifier,
+		StartIndex:        start,
+		Count:             count,
+		Format:            format,
+	})
+	return request
+}
+
+func TestTrailersHandler(t *testing.T) {
+	node, _, handler := newTestServer(t, 20)
+
+	var response struct {
+		Trailers []TrailerInfo `json:"trailers"`
+	}
+	if code := serve(t, handler, "/blocks/trailers", trailersRequest(3, 5, ""), &response); code != 0 {
+		t.Fatalf("/blocks/trailers: error %d", code)
+	}
+	if len(response.Trailers) != 5 {
+		t.Fatalf("/blocks/trailers returned %d trailers, want 5", len(response.Trailers))
+	}
+	for i, trailer := range response.Trailers {
+		block, _ := node.QueryBlockFromNumber(uint64(3 + i))
+		if trailer.BlockIdentifier.Index != 3+i || trailer.BlockIdentifier.Hash != fmt.Sprintf("0x%x", block.Trailer.Bhash[:]) {
+			t.Fatalf("trailer %d is %+v", i, trailer.BlockIdentifier)
+		}
+		if trailer.ParentBlockIdentifier.Hash != fmt.Sprintf("0x%x", block.Trailer.Phash[:]) {
+			t.Fatalf("trailer %d has parent %+v", i, trailer.ParentBlockIdentifier)
+		}
+	}
+
+	// The range is clamped to the tip
+	if code := serve(t, handler, "/blocks/trailers", trailersRequest(18, 100, ""), &response); code != 0 || len(response.Trailers) != 3 {
+		t.Fatalf("/blocks/trailers past the tip: error %d, %d trailers", code, len(response.Trailers))
+	}
+	if code := serve(t, handler, "/blocks/trailers", trailersRequest(21, 1, ""), nil); code != ErrBlockNotFound.Code {
+		t.Fatalf("/blocks/trailers from past the tip: error %d, want %d", code, ErrBlockNotFound.Code)
+	}
+	if code := serve(t, handler, "/blocks/trailers", trailersRequest(0, TRAILERS_MAX_RANGE+1, ""), nil); code != ErrInvalidRequest.Code {
+		t.Fatalf("/blocks/trailers over the maximum range: error %d, want %d", code, ErrInvalidRequest.Code)
+	}
+}
+
+func TestTrailersHandlerNDJSON(t *testing.T) {
+	_, _, handler := newTestServer(t, 10)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/blocks/trailers", bytes.NewReader(trailersRequest(0, 0, "ndjson"))))
+	if recorder.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Content-Type %q", recorder.Header().Get("Content-Type"))
+	}
+
+	// One trailer per line, up to the tip since the default count is larger
+	index := 0
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var trailer TrailerInfo
+		if err := json.Unmarshal(scanner.Bytes(), &trailer); err != nil {
+			t.Fatalf("line %d: %s", index, err)
+		}
+		if trailer.BlockIdentifier.Index != index {
+			t.Fatalf("line %d is block %d", index, trailer.BlockIdentifier.Index)
+		}
+		index++
+	}
+	if index != 11 {
+		t.Fatalf("%d lines, want 11", index)
+	}
+}
+
+func TestTfileHandler(t *testing.T) {
+	_, _, handler := newTestServer(t, 20)
+	tfile, err := os.ReadFile(TFILE_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/blocks/tfile", bytes.NewReader(trailersRequest(4, 6, ""))))
+	if recorder.Header().Get("Content-Type") != "application/octet-stream" || recorder.Header().Get("Content-Length") != fmt.Sprint(6*BTRAILER_SIZE) {
+		t.Fatalf("headers %v", recorder.Header())
+	}
+	if !bytes.Equal(recorder.Body.Bytes(), tfile[4*BTRAILER_SIZE:10*BTRAILER_SIZE]) {
+		t.Fatal("/blocks/tfile returned other bytes than the tfile")
+	}
+
+	// Clamped to the complete trailers, a partial one being written is left out
+	f, err := os.OpenFile(TFILE_PATH, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 50))
+	f.Close()
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/blocks/tfile", bytes.NewReader(trailersRequest(15, 100, ""))))
+	if !bytes.Equal(recorder.Body.Bytes(), tfile[15*BTRAILER_SIZE:]) {
+		t.Fatalf("/blocks/tfile past the tip returned %d bytes", recorder.Body.Len())
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// errWotsCheckUnavailable is returned when the spends of an address cannot
+// be read: the key may have signed already, so the check fails closed
+var errWotsCheckUnavailable = errors.New("WOTS+ reuse check unavailable")
+
+// wotsReuseError is the API error of a failed checkWotsReuse
+func wotsReuseError(err error) APIError {
+	if errors.Is(err, errWotsCheckUnavailable) {
+		return ErrServiceUnavailable
+	}
+	return ErrWotsReuse
+}
+
+// checkWotsReuse fails if the WOTS+ address hash already signed a
+// transaction other than txID, on chain (when the indexer is enabled) or in
+// the mempool. txID may be empty when the transaction is not built yet.
+// It also fails, with errWotsCheckUnavailable, when the indexer or the
+// mempool cannot be read.
+func (s *Server) checkWotsReuse(addrHash string, txID string) error {
+	addrHash = strings.ToLower(strings.TrimPrefix(addrHash, "0x"))
+	txID = strings.ToLower(strings.TrimPrefix(txID, "0x"))
+
+	if Globals.EnableIndexer {
+		if INDEXER_DB == nil {
+			return fmt.Errorf("%w: indexer database not connected", errWotsCheckUnavailable)
+		}
+		spends, err := INDEXER_DB.GetWotsSpends(addrHash)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errWotsCheckUnavailable, err)
+		}
+		for _, spend := range spends {
+			if spend.TransactionID != txID {
+				return fmt.Errorf("address 0x%s already spent by 0x%s in block %d", addrHash, spend.TransactionID, spend.BlockHeight)
+			}
+		}
+	}
+
+	if Globals.OnlineMode {
+		mempool, err := s.mempool.Snapshot()
+		if err != nil {
+			return fmt.Errorf("%w: %s", errWotsCheckUnavailable, err)
+		}
+		for i, tx := range mempool.Entries {
+			source := tx.GetSourceAddress()
+			pendingID := strings.TrimPrefix(mempool.IDs[i], "0x")
+			if hex.EncodeToString(source.Address[go_mcminterface.TXTAGLEN:]) == addrHash && pendingID != txID {
+				return fmt.Errorf("address 0x%s already signed pending transaction 0x%s", addrHash, pendingID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// WotsReuseRequest is the request structure for the /wots/reuse endpoint
+type WotsReuseRequest struct {
+	NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	Offset            *int64            `json:"offset,omitempty"`
+	Limit             *int64            `json:"limit,omitempty"`
+}
+
+// WotsReuseIncident is a WOTS+ address that signed more than one transaction
+type WotsReuseIncident struct {
+	AddressHash  string                 `json:"address_hash"`
+	Transactions []WotsReuseTransaction `json:"transactions"`
+}
+
+// WotsReuseTransaction is one of the transactions of an incident
+type WotsReuseTransaction struct {
+	BlockIdentifier       BlockIdentifier       `json:"block_identifier"`
+	TransactionIdentifier TransactionIdentifier `json:"transaction_identifier"`
+}
+
+// WotsReuseResponse is the response structure for the /wots/reuse endpoint
+type WotsReuseResponse struct {
+	Incidents []WotsReuseIncident `json:"incidents"`
+}
+
+// wotsReuseHandler reports the addresses that signed more than one transaction on chain
+func wotsReuseHandler(w http.ResponseWriter, r *http.Request) {
+	var req WotsReuseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mlog(3, "§bwotsReuseHandler(): §4Error decoding request: §c%s", err)
+		giveError(w, ErrInvalidRequest)
+		return
+	}
+
+	if req.NetworkIdentifier.Blockchain != Constants.NetworkIdentifier.Blockchain ||
+		req.NetworkIdentifier.Network != Constants.NetworkIdentifier.Network {
+		mlog(3, "§bwotsReuseHandler(): §4Wrong network identifier")
+		giveError(w, ErrWrongNetwork)
+		return
+	}
+
+	var limit int64 = 10
+	if req.Limit != nil && *req.Limit > 0 && *req.Limit <= 100 {
+		limit = *req.Limit
+	}
+	var offset int64 = 0
+	if req.Offset != nil && *req.Offset > 0 {
+		offset = *req.Offset
+	}
+
+	if !Globals.EnableIndexer || INDEXER_DB == nil {
+		mlog(3, "§bwotsReuseHandler(): §4Indexer is not enabled")
+		giveError(w, ErrServiceUnavailable)
+		return
+	}
+
+	spends, err := INDEXER_DB.GetWotsReuseIncidents(offset, limit)
+	if err != nil {
+		mlog(3, "§bwotsReuseHandler(): §4Error getting incidents: §c%s", err)
+		giveError(w, ErrInternalError)
+		return
+	}
+
+	// Spends come grouped by address
+	response := WotsReuseResponse{Incidents: []WotsReuseIncident{}}
+	for _, spend := range spends {
+		n := len(response.Incidents)
+		if n == 0 || response.Incidents[n-1].AddressHash != "0x"+spend.AddressHash {
+			response.Incidents = append(response.Incidents, WotsReuseIncident{AddressHash: "0x" + spend.AddressHash})
+			n++
+		}
+		response.Incidents[n-1].Transactions = append(response.Incidents[n-1].Transactions, WotsReuseTransaction{
+			BlockIdentifier:       BlockIdentifier{Index: int(spend.BlockHeight)},
+			TransactionIdentifier: TransactionIdentifier{Hash: "0x" + spend.TransactionID},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/NickP005/go_mcminterface"
+)
+
+// mempoolDown is a node whose mempool cannot be read
+type mempoolDown struct{ *FakeNode }
+
+func (mempoolDown) QueryMempool() ([]go_mcminterface.TXENTRY, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestCheckWotsReuse(t *testing.T) {
+	node, server, _ := newTestServer(t, 5)
+	tx, err := node.Faucet(node.Tags()[1], 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := tx.GetSourceAddress()
+	hash := hex.EncodeToString(source.Address[go_mcminterface.TXTAGLEN:])
+	server.mempool.Refresh()
+
+	err = server.checkWotsReuse(hash, "")
+	if err == nil || wotsReuseError(err) != ErrWotsReuse {
+		t.Fatalf("second signature of a pending address: %v", err)
+	}
+	if err := server.checkWotsReuse("0x"+hash, hex.EncodeToString(tx.GetID())); err != nil {
+		t.Fatalf("the pending transaction itself refused: %s", err)
+	}
+	if err := server.checkWotsReuse(hex.EncodeToString(make([]byte, 20)), ""); err != nil {
+		t.Fatalf("unused address refused: %s", err)
+	}
+}
+
+func TestCheckWotsReuseFailsClosed(t *testing.T) {
+	node, _, _ := newTestServer(t, 5)
+	tx, err := node.Faucet(node.Tags()[1], 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(mempoolDown{node})
+	handler := server.Router()
+	if err := server.mempool.Refresh(); err == nil {
+		t.Fatal("unreadable mempool refreshed")
+	}
+
+	err = server.checkWotsReuse(hex.EncodeToString(make([]byte, 20)), "")
+	if !errors.Is(err, errWotsCheckUnavailable) {
+		t.Fatalf("unreadable mempool: %v, want the check unavailable", err)
+	}
+	code := post(t, handler, "/construction/submit", map[string]interface{}{"signed_transaction": hex.EncodeToString(tx.Bytes())}, nil)
+	if code != ErrServiceUnavailable.Code {
+		t.Fatalf("/construction/submit with an unreadable mempool: error %d, want %d", code, ErrServiceUnavailable.Code)
+	}
+
+	// Indexer enabled but not connected
+	enabled, online := Globals.EnableIndexer, Globals.OnlineMode
+	Globals.EnableIndexer, Globals.OnlineMode = true, false
+	t.Cleanup(func() { Globals.EnableIndexer, Globals.OnlineMode = enabled, online })
+	if err := server.checkWotsReuse(hex.EncodeToString(make([]byte, 20)), ""); !errors.Is(err, errWotsCheckUnavailable) {
+		t.Fatalf("indexer without database: %v, want the check unavailable", err)
+	}
+}
+
+func TestPreprocessFailsClosed(t *testing.T) {
+	node, server, handler := newTestServer(t, 5)
+	if err := server.mempool.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	preprocess := func(sourceTag string, metadata map[string]interface{}) int {
+		metadata["block_to_live"] = 0
+		metadata["change_pk"] = "0x" + hex.EncodeToString(make([]byte, 20))
+		operations := []map[string]interface{}{
+			{"operation_identifier": map[string]int{"index": 0}, "type": "SOURCE_TRANSFER", "account": map[string]string{"address": sourceTag}},
+			{"operation_identifier": map[string]int{"index": 1}, "type": "DESTINATION_TRANSFER", "account": map[string]string{"address": "0x" + hex.EncodeToString(node.Tags()[2])}},
+			{"operation_identifier": map[string]int{"index": 2}, "type": "FEE"},
+		}
+		return post(t, handler, "/construction/preprocess", map[string]interface{}{"operations": operations, "metadata": metadata}, nil)
+	}
+
+	if code := preprocess("0x"+hex.EncodeToString(node.Tags()[1]), map[string]interface{}{}); code != 0 {
+		t.Fatalf("source resolved from its tag: error %d", code)
+	}
+	unknown := "0x" + hex.EncodeToString(make([]byte, 20))
+	if code := preprocess(unknown, map[string]interface{}{}); code != ErrServiceUnavailable.Code {
+		t.Fatalf("unresolvable source tag: error %d, want %d", code, ErrServiceUnavailable.Code)
+	}
+	if code := preprocess(unknown, map[string]interface{}{"source_pk": unknown}); code != 0 {
+		t.Fatalf("source hash given in metadata: error %d", code)
+	}
+}